@@ -20,17 +20,31 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"os"
+	"strconv"
 
 	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal"
 	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/convert"
-	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/share"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/customrule"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/handlers"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/mirror"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/output"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/policyserver"
 	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/support"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/pkg/converter"
 
+	"github.com/olekukonko/tablewriter"
+	"github.com/olekukonko/tablewriter/tw"
 	"github.com/urfave/cli/v3"
+	"sigs.k8s.io/yaml"
 )
 
+// reportColumnWidth is the maximum width of the columns of the conversion report table.
+const reportColumnWidth = 50
+
 const appDescription = `
 nvrules2kw converts NeuVector Admission Control rules into Kubewarden ClusterAdmissionPolicy YAMLs.
 
@@ -49,17 +63,17 @@ func main() {
 			Flags: []cli.Flag{
 				&cli.StringFlag{
 					Name:  "policyserver",
-					Value: "default",
+					Value: converter.DefaultPolicyServer,
 					Usage: "Name of the PolicyServer to bind the generated policies to",
 				},
 				&cli.StringFlag{
 					Name:  "vulreportnamespace",
-					Value: "sbomscanner",
+					Value: converter.DefaultVulReportNamespace,
 					Usage: "Namespace where the vulnerability report is stored",
 				},
 				&cli.StringFlag{
 					Name:  "platform",
-					Value: "amd64",
+					Value: converter.DefaultPlatform,
 					Usage: "Architecture of the platform, must use values listed in the Go Language document for GOARCH (e.g.: amd64, arm64, s390x).",
 				},
 				&cli.BoolFlag{
@@ -74,20 +88,126 @@ func main() {
 				},
 				&cli.StringFlag{
 					Name:  "mode",
-					Value: "protect",
+					Value: converter.ModeProtect,
 					Usage: "Execution mode of the policies: 'protect' or 'monitor'",
 				},
 				&cli.BoolFlag{
 					Name:  "show-summary",
 					Usage: "Display a summary table of the conversion results",
 				},
+				&cli.BoolFlag{
+					Name:  "build-custom-wasm",
+					Usage: "Compile the generated Rego policies to Wasm modules annotated with the Kubewarden metadata",
+				},
+				&cli.BoolFlag{
+					Name:  "run-rego-tests",
+					Usage: "Run the unit tests generated for the custom rules against their Rego policy, and report the failures in the summary",
+				},
+				&cli.StringFlag{
+					Name:  "custom-module-registry",
+					Usage: "Registry of the modules built from the Rego policies (e.g.: registry://ghcr.io/acme/policies)",
+				},
+				&cli.StringFlag{
+					Name:  "custom-module-version",
+					Value: converter.DefaultCustomModuleVersion,
+					Usage: "Tag of the modules built from the Rego policies, used with --custom-module-registry",
+				},
+				&cli.StringFlag{
+					Name:  "rego-dir",
+					Value: customrule.DefaultRegoDir,
+					Usage: "Directory of the Rego policies generated for the rules without Kubewarden module",
+				},
+				&cli.StringFlag{
+					Name:  "rego-layout",
+					Value: customrule.LayoutFlat,
+					Usage: "Layout of the Rego policies: 'flat' (nv_rule_ID.rego files) or 'scaffold' (an opa-policy-template project per rule)",
+				},
+				&cli.StringFlag{
+					Name:  "handlers-dir",
+					Usage: "Directory of the handler plugins, YAML files mapping criteria to Kubewarden modules",
+				},
+				&cli.StringSliceFlag{
+					Name:  "module",
+					Usage: "Override the module of the handlers, as name=uri (e.g.: pod-privileged=registry://registry.internal/policies/pod-privileged:v1.0.2)",
+				},
+				&cli.StringFlag{
+					Name:  "modules-file",
+					Usage: "YAML file of module overrides, mapping module names to URIs; the --module flags take precedence",
+				},
+				&cli.StringSliceFlag{
+					Name:  "registry-mirror",
+					Usage: "Rewrite the modules of a registry to its mirror, as registry=mirror (e.g.: ghcr.io=registry.internal:5000)",
+				},
+				&cli.StringFlag{
+					Name:  "pull-script",
+					Usage: "Write a kwctl script seeding the registry mirrors with the modules of the policies to this file",
+				},
+				&cli.BoolFlag{
+					Name:  "prefer-namespaced",
+					Usage: "Generate an AdmissionPolicy or AdmissionPolicyGroup in the namespace of the rules targeting a single namespace",
+				},
+				&cli.StringFlag{
+					Name:  "resources-file",
+					Usage: "YAML file of the resources the policies apply to and their operations, by applicable resource type and by rule",
+				},
+				&cli.BoolFlag{
+					Name:  "consolidate",
+					Usage: "Merge the policies of the rules only differing by their namespaces into a policy selecting all their namespaces",
+				},
+				&cli.StringFlag{
+					Name:  "group-strategy",
+					Value: converter.GroupStrategyGroup,
+					Usage: "Policies of the rules with several criteria: 'group' (a policy group), 'split' (a policy per module when equivalent) or 'auto' (a group only for several modules)",
+				},
+				&cli.StringFlag{
+					Name:  "message-template",
+					Usage: "Go template of the rejection message of the policies, with the rule {{.ID}}, {{.Comment}} and {{.Criteria}} summary (e.g.: 'blocked by NeuVector rule {{.ID}}: {{.Comment}}')",
+				},
+				&cli.StringFlag{
+					Name:  "policyserver-manifests",
+					Usage: "Write the PolicyServer of --policyserver, and the RBAC its service account needs to run the policies, to this file",
+				},
+				&cli.StringFlag{
+					Name:  "policyserver-namespace",
+					Value: converter.DefaultPolicyServerNamespace,
+					Usage: "Namespace of the service account of the PolicyServer, the namespace of the Kubewarden controller",
+				},
+				&cli.StringFlag{
+					Name:  "policyserver-image",
+					Value: converter.DefaultPolicyServerImage,
+					Usage: "Image of the PolicyServer, used with --policyserver-manifests",
+				},
+				&cli.Int32Flag{
+					Name:  "policyserver-replicas",
+					Value: 1,
+					Usage: "Number of replicas of the PolicyServer, used with --policyserver-manifests",
+				},
+				&cli.StringSliceFlag{
+					Name:  "policyserver-source-authority",
+					Usage: "PEM certificate of a registry of the modules, as host=path (e.g.: registry.internal:5000=ca.pem)",
+				},
+				&cli.StringSliceFlag{
+					Name:  "policyserver-insecure-source",
+					Usage: "Registry the PolicyServer pulls the modules from without TLS verification (e.g.: registry.internal:5000)",
+				},
+				&cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "List the files the conversion would write, without writing them",
+				},
 			},
 			Before: func(ctx context.Context, cmd *cli.Command) (context.Context, error) {
+				// Unlike the library, the command line requires a mode
 				mode := cmd.String("mode")
-				if mode != "protect" && mode != "monitor" {
-					return ctx, fmt.Errorf("invalid mode: %s. Allowed values are \"protect\" or \"monitor\"", mode)
+				if mode == "" {
+					return ctx, fmt.Errorf("invalid mode: %s. Allowed values are \"%s\" or \"%s\"",
+						mode, converter.ModeProtect, converter.ModeMonitor)
 				}
-				return ctx, nil
+				return ctx, converter.Options{
+					Mode:            mode,
+					RegoLayout:      cmd.String("rego-layout"),
+					GroupStrategy:   cmd.String("group-strategy"),
+					MessageTemplate: cmd.String("message-template"),
+				}.Validate()
 			},
 			Action: func(ctx context.Context, cmd *cli.Command) error {
 				args := cmd.Args().Slice()
@@ -96,27 +216,100 @@ func main() {
 				}
 
 				ruleFile := args[len(args)-1]
-				policyServer := cmd.String("policyserver")
-				backgroundAudit := cmd.Bool("backgroundaudit")
 				outputFile := cmd.String("output")
-				mode := cmd.String("mode")
-				showSummary := cmd.Bool("show-summary")
-				vulReportNamespace := cmd.String("vulreportnamespace")
-				platform := cmd.String("platform")
-
-				converter := convert.NewRuleConverter(share.ConversionConfig{
-					OutputFile:         outputFile,
-					Mode:               mode,
-					PolicyServer:       policyServer,
-					BackgroundAudit:    backgroundAudit,
-					ShowSummary:        showSummary,
-					VulReportNamespace: vulReportNamespace,
-					Platform:           platform,
-				})
+				dryRun := cmd.Bool("dry-run")
+				// The Rego artifacts, the logs and the summary aren't mixed with the policies streamed to stdout
+				streaming := outputFile == output.Stdout && !dryRun
+				moduleOverrides, err := loadModuleOverrides(cmd.String("modules-file"), cmd.StringSlice("module"))
+				if err != nil {
+					return err
+				}
+				registryMirrors, err := parseRegistryMirrors(cmd.StringSlice("registry-mirror"))
+				if err != nil {
+					return err
+				}
+				policyServerManifests, err := loadPolicyServerOptions(cmd)
+				if err != nil {
+					return err
+				}
 
-				if err := converter.Convert(ctx, ruleFile); err != nil {
+				var logOutput io.Writer = os.Stdout
+				if streaming {
+					logOutput = os.Stderr
+				}
+				logger := slog.New(slog.NewTextHandler(logOutput, nil))
+
+				result, err := convertFile(ctx, ruleFile, converter.Options{
+					Mode:                  cmd.String("mode"),
+					PolicyServer:          cmd.String("policyserver"),
+					BackgroundAudit:       cmd.Bool("backgroundaudit"),
+					VulReportNamespace:    cmd.String("vulreportnamespace"),
+					Platform:              cmd.String("platform"),
+					BuildCustomWasm:       cmd.Bool("build-custom-wasm"),
+					RunRegoTests:          cmd.Bool("run-rego-tests"),
+					CustomModuleRegistry:  cmd.String("custom-module-registry"),
+					CustomModuleVersion:   cmd.String("custom-module-version"),
+					RegoDir:               cmd.String("rego-dir"),
+					RegoLayout:            cmd.String("rego-layout"),
+					SkipRego:              streaming,
+					HandlersDir:           cmd.String("handlers-dir"),
+					ModuleOverrides:       moduleOverrides,
+					RegistryMirrors:       registryMirrors,
+					PreferNamespaced:      cmd.Bool("prefer-namespaced"),
+					ResourcesFile:         cmd.String("resources-file"),
+					Consolidate:           cmd.Bool("consolidate"),
+					GroupStrategy:         cmd.String("group-strategy"),
+					MessageTemplate:       cmd.String("message-template"),
+					PolicyServerManifests: policyServerManifests,
+					Logger:                logger,
+				})
+				if err != nil {
 					return fmt.Errorf("error processing rules: %w", err)
 				}
+
+				writer := output.NewWriter(outputFile, dryRun)
+				if err = writeResult(writer, result, outputFile, cmd.String("policyserver-manifests"),
+					cmd.String("pull-script")); err != nil {
+					return err
+				}
+
+				if cmd.Bool("show-summary") {
+					if err = renderReport(logOutput, result.Report); err != nil {
+						return fmt.Errorf("failed to render results table: %w", err)
+					}
+				}
+
+				if outputFile == output.Stdout || dryRun {
+					return nil
+				}
+				if result.RegoCount > 0 {
+					logger.InfoContext(ctx, "rego policies generated",
+						"count", result.RegoCount,
+						"directory", cmd.String("rego-dir"),
+					)
+				}
+				if len(result.Policies) > 0 {
+					logger.InfoContext(ctx, "Conversion done", "output_file", outputFile)
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "validate",
+			Usage:     "Validate the settings of Kubewarden policies against the settings schema of their module",
+			UsageText: `validate [POLICIES_FILE] - the policies YAML, such as the convert output ('-' for stdin)`,
+			Action: func(_ context.Context, cmd *cli.Command) error {
+				args := cmd.Args().Slice()
+				if len(args) == 0 {
+					return errors.New("policies file is required")
+				}
+
+				count, err := validatePolicies(args[len(args)-1])
+				if err != nil {
+					return fmt.Errorf("invalid policies:\n%w", err)
+				}
+				//nolint: forbidigo // it's fine to print to stdout
+				fmt.Printf("%d policies validated\n", count)
 				return nil
 			},
 		},
@@ -150,3 +343,169 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// loadModuleOverrides returns the module overrides of the modules file, and of the --module flags
+// which take precedence.
+func loadModuleOverrides(modulesFile string, moduleFlags []string) (map[string]string, error) {
+	overrides := map[string]string{}
+	if modulesFile != "" {
+		data, err := os.ReadFile(modulesFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read modules file: %w", err)
+		}
+		if err = yaml.UnmarshalStrict(data, &overrides); err != nil {
+			return nil, fmt.Errorf("failed to decode modules file: %w", err)
+		}
+	}
+
+	for _, flag := range moduleFlags {
+		name, uri, err := handlers.ParseModuleOverride(flag)
+		if err != nil {
+			return nil, err
+		}
+		overrides[name] = uri
+	}
+	return overrides, nil
+}
+
+// parseRegistryMirrors returns the registry mirrors of the --registry-mirror flags.
+func parseRegistryMirrors(mirrorFlags []string) (map[string]string, error) {
+	mirrors := map[string]string{}
+	for _, flag := range mirrorFlags {
+		registry, target, err := mirror.ParseMirror(flag)
+		if err != nil {
+			return nil, err
+		}
+		mirrors[registry] = target
+	}
+	return mirrors, nil
+}
+
+// loadPolicyServerOptions returns the options of the PolicyServer manifests, nil unless they're written to a file.
+func loadPolicyServerOptions(cmd *cli.Command) (*converter.PolicyServerOptions, error) {
+	if cmd.String("policyserver-manifests") == "" {
+		return nil, nil //nolint:nilnil // no PolicyServer manifests
+	}
+
+	sourceAuthorities, err := loadSourceAuthorities(cmd.StringSlice("policyserver-source-authority"))
+	if err != nil {
+		return nil, err
+	}
+	return &converter.PolicyServerOptions{
+		Namespace:         cmd.String("policyserver-namespace"),
+		Image:             cmd.String("policyserver-image"),
+		Replicas:          cmd.Int32("policyserver-replicas"),
+		SourceAuthorities: sourceAuthorities,
+		InsecureSources:   cmd.StringSlice("policyserver-insecure-source"),
+	}, nil
+}
+
+// loadSourceAuthorities returns the PEM certificates of the --policyserver-source-authority flags, by registry host.
+func loadSourceAuthorities(authorityFlags []string) (map[string][]string, error) {
+	var authorities map[string][]string
+	for _, flag := range authorityFlags {
+		host, path, err := policyserver.ParseSourceAuthority(flag)
+		if err != nil {
+			return nil, err
+		}
+		certificate, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read source authority: %w", err)
+		}
+		if authorities == nil {
+			authorities = map[string][]string{}
+		}
+		authorities[host] = append(authorities[host], string(certificate))
+	}
+	return authorities, nil
+}
+
+// convertFile converts the rules of the file with the conversion library.
+func convertFile(ctx context.Context, ruleFile string, opts converter.Options) (*converter.Result, error) {
+	file, err := os.Open(ruleFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %q: %w", ruleFile, err)
+	}
+	defer file.Close()
+
+	return converter.Convert(ctx, file, opts)
+}
+
+// writeResult writes the Rego artifacts and the policies of the conversion, the PolicyServer manifests and the
+// pull script when their file is set.
+func writeResult(
+	writer output.Writer,
+	result *converter.Result,
+	outputFile string,
+	policyServerFile string,
+	pullScript string,
+) error {
+	for _, artifact := range result.Artifacts {
+		if err := writer.WriteFile(artifact.Path, artifact.Data); err != nil {
+			return fmt.Errorf("failed to write rego policy: %w", err)
+		}
+	}
+
+	// Custom rules generate Rego files only, so policies may be empty
+	if len(result.Policies) > 0 {
+		if err := output.WriteObjects(writer, result.Policies, outputFile); err != nil {
+			return fmt.Errorf("failed to write output YAML: %w", err)
+		}
+	}
+
+	if policyServerFile != "" && len(result.PolicyServerManifests) > 0 {
+		if err := output.WriteObjects(writer, result.PolicyServerManifests, policyServerFile); err != nil {
+			return fmt.Errorf("failed to write PolicyServer manifests: %w", err)
+		}
+	}
+
+	if pullScript != "" && len(result.Modules) > 0 {
+		if err := writer.WriteFile(pullScript, []byte(result.PullScript())); err != nil {
+			return fmt.Errorf("failed to write pull script: %w", err)
+		}
+	}
+	return nil
+}
+
+// renderReport renders the conversion report of the rules as a table.
+func renderReport(out io.Writer, report []converter.RuleReport) error {
+	table := tablewriter.NewTable(out,
+		tablewriter.WithConfig(tablewriter.Config{
+			Row: tw.CellConfig{
+				Formatting:   tw.CellFormatting{AutoWrap: tw.WrapNormal},
+				Alignment:    tw.CellAlignment{Global: tw.AlignLeft},
+				ColMaxWidths: tw.CellWidth{Global: reportColumnWidth},
+			},
+		}),
+	)
+	table.Header([]string{"ID", "STATUS", "NOTES"})
+	for _, entry := range report {
+		data := []string{
+			strconv.FormatUint(uint64(entry.RuleID), 10),
+			string(entry.Status),
+			entry.Notes,
+		}
+		if err := table.Append(data); err != nil {
+			return fmt.Errorf("failed to append data: %w", err)
+		}
+	}
+
+	if err := table.Render(); err != nil {
+		return fmt.Errorf("failed to render table: %w", err)
+	}
+	return nil
+}
+
+// validatePolicies validates the settings of the policies of the file, or of stdin.
+func validatePolicies(policiesFile string) (int, error) {
+	if policiesFile == "-" {
+		return convert.ValidatePolicies(os.Stdin)
+	}
+
+	file, err := os.Open(policiesFile)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open policies file: %w", err)
+	}
+	defer file.Close()
+	return convert.ValidatePolicies(file)
+}
@@ -0,0 +1,222 @@
+package convert
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	policiesv1 "github.com/kubewarden/adm-controller/api/policies/v1"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/policy"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/share"
+	nvapis "github.com/neuvector/neuvector/controller/api"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RuleIDsAnnotation is the annotation of the consolidated policies listing the IDs of the rules they enforce.
+const RuleIDsAnnotation = "neuvector.com/rule-ids"
+
+// consolidatedPolicy is a policy enforcing one or more rules.
+type consolidatedPolicy struct {
+	policy      Policy
+	fingerprint string
+	rules       []*nvapis.RESTAdmissionRule
+}
+
+// consolidatePolicies merges the policies identical but for their name and their namespace selector, such as
+// the policies of rules only differing by their namespaces, into a policy selecting the namespaces of all of
+// them. The policies are only merged when the union of their namespace selectors is a namespace selector, the
+// policy of a rule with several namespace criteria is merged with the same selectors only. The merged policies are
+// named after the first rule, they list the IDs of their rules with the RuleIDsAnnotation, and the message of the
+// policy groups is rendered for all of them with the message template. It returns the policies, in the order of
+// their first rule, and the names of the merged policies by rule ID.
+func consolidatePolicies(
+	policies []Policy,
+	rules []*nvapis.RESTAdmissionRule,
+	config share.ConversionConfig,
+) ([]Policy, map[uint32][]string, error) {
+	var consolidated []*consolidatedPolicy
+	for idx, candidate := range policies {
+		fingerprint, err := policyFingerprint(candidate)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		merged := false
+		for _, target := range consolidated {
+			if target.fingerprint != fingerprint {
+				continue
+			}
+			selector, ok := mergeNamespaceSelectors(namespaceSelector(target.policy), namespaceSelector(candidate))
+			if !ok {
+				continue
+			}
+			setNamespaceSelector(target.policy, selector)
+			target.rules = append(target.rules, rules[idx])
+			merged = true
+			break
+		}
+		if !merged {
+			consolidated = append(consolidated, &consolidatedPolicy{
+				policy:      candidate,
+				fingerprint: fingerprint,
+				rules:       []*nvapis.RESTAdmissionRule{rules[idx]},
+			})
+		}
+	}
+
+	result := make([]Policy, 0, len(consolidated))
+	mergedPolicies := map[uint32][]string{}
+	for _, target := range consolidated {
+		result = append(result, target.policy)
+		if len(target.rules) == 1 {
+			continue
+		}
+
+		ids := make([]string, 0, len(target.rules))
+		for _, rule := range target.rules {
+			ids = append(ids, strconv.FormatUint(uint64(rule.ID), 10))
+		}
+		metadata := policyMetadata(target.policy)
+		metav1.SetMetaDataAnnotation(metadata, RuleIDsAnnotation, strings.Join(ids, ","))
+		message, err := policy.RulesMessage(target.rules, config)
+		if err != nil {
+			return nil, nil, err
+		}
+		setGroupMessage(target.policy, message)
+		for _, rule := range target.rules {
+			mergedPolicies[rule.ID] = append(mergedPolicies[rule.ID], metadata.Name)
+		}
+	}
+	return result, mergedPolicies, nil
+}
+
+// policyFingerprint returns the policy without its name, its namespace selector and its group message:
+// the policies with the same fingerprint only differ by the rules they enforce and the namespaces they select.
+func policyFingerprint(policy Policy) (string, error) {
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal policy: %w", err)
+	}
+
+	var fields map[string]any
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return "", fmt.Errorf("failed to unmarshal policy: %w", err)
+	}
+	if metadata, ok := fields["metadata"].(map[string]any); ok {
+		delete(metadata, "name")
+	}
+	if spec, ok := fields["spec"].(map[string]any); ok {
+		delete(spec, "namespaceSelector")
+		delete(spec, "message")
+	}
+
+	// The keys of the maps are marshalled in sorted order
+	data, err = json.Marshal(fields)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal policy fingerprint: %w", err)
+	}
+	return string(data), nil
+}
+
+// mergeNamespaceSelectors returns the namespace selector selecting the namespaces of both selectors, if any.
+// A nil selector selects every namespace. The selectors are merged when they're equal, or when they match
+// the same label key against values.
+func mergeNamespaceSelectors(a, b *metav1.LabelSelector) (*metav1.LabelSelector, bool) {
+	if a == nil || b == nil {
+		return nil, true
+	}
+	if reflect.DeepEqual(a, b) {
+		return a, true
+	}
+
+	reqA, okA := singleRequirement(a)
+	reqB, okB := singleRequirement(b)
+	if !okA || !okB || reqA.Key != reqB.Key {
+		return nil, false
+	}
+	if reqA.Operator == metav1.LabelSelectorOpNotIn && reqB.Operator == metav1.LabelSelectorOpIn {
+		reqA, reqB = reqB, reqA
+	}
+
+	merged := metav1.LabelSelectorRequirement{Key: reqA.Key, Operator: metav1.LabelSelectorOpNotIn}
+	switch {
+	case reqA.Operator == metav1.LabelSelectorOpIn && reqB.Operator == metav1.LabelSelectorOpIn:
+		// In A or in B: in A or B
+		merged.Operator = metav1.LabelSelectorOpIn
+		merged.Values = slices.Compact(slices.Sorted(slices.Values(slices.Concat(reqA.Values, reqB.Values))))
+	case reqA.Operator == metav1.LabelSelectorOpIn:
+		// In A or not in B: not in B but A
+		merged.Values = slices.DeleteFunc(slices.Clone(reqB.Values), func(value string) bool {
+			return slices.Contains(reqA.Values, value)
+		})
+	default:
+		// Not in A or not in B: not in both A and B
+		merged.Values = slices.DeleteFunc(slices.Clone(reqA.Values), func(value string) bool {
+			return !slices.Contains(reqB.Values, value)
+		})
+	}
+
+	if merged.Operator == metav1.LabelSelectorOpNotIn && len(merged.Values) == 0 {
+		return nil, true
+	}
+	return &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{merged}}, true
+}
+
+// singleRequirement returns the requirement of a selector matching a single label key against values.
+func singleRequirement(selector *metav1.LabelSelector) (metav1.LabelSelectorRequirement, bool) {
+	if len(selector.MatchLabels) > 0 || len(selector.MatchExpressions) != 1 {
+		return metav1.LabelSelectorRequirement{}, false
+	}
+
+	requirement := selector.MatchExpressions[0]
+	if requirement.Operator != metav1.LabelSelectorOpIn && requirement.Operator != metav1.LabelSelectorOpNotIn {
+		return metav1.LabelSelectorRequirement{}, false
+	}
+	return requirement, true
+}
+
+func policyMetadata(policy Policy) *metav1.ObjectMeta {
+	switch p := policy.(type) {
+	case *policiesv1.ClusterAdmissionPolicy:
+		return &p.ObjectMeta
+	case *policiesv1.AdmissionPolicy:
+		return &p.ObjectMeta
+	case *policiesv1.ClusterAdmissionPolicyGroup:
+		return &p.ObjectMeta
+	case *policiesv1.AdmissionPolicyGroup:
+		return &p.ObjectMeta
+	}
+	return &metav1.ObjectMeta{}
+}
+
+// namespaceSelector returns the namespace selector of the policy, nil for the namespaced policies.
+func namespaceSelector(policy Policy) *metav1.LabelSelector {
+	switch p := policy.(type) {
+	case *policiesv1.ClusterAdmissionPolicy:
+		return p.Spec.NamespaceSelector
+	case *policiesv1.ClusterAdmissionPolicyGroup:
+		return p.Spec.NamespaceSelector
+	}
+	return nil
+}
+
+func setNamespaceSelector(policy Policy, selector *metav1.LabelSelector) {
+	switch p := policy.(type) {
+	case *policiesv1.ClusterAdmissionPolicy:
+		p.Spec.NamespaceSelector = selector
+	case *policiesv1.ClusterAdmissionPolicyGroup:
+		p.Spec.NamespaceSelector = selector
+	}
+}
+
+func setGroupMessage(policy Policy, message string) {
+	switch p := policy.(type) {
+	case *policiesv1.ClusterAdmissionPolicyGroup:
+		p.Spec.Message = message
+	case *policiesv1.AdmissionPolicyGroup:
+		p.Spec.Message = message
+	}
+}
@@ -0,0 +1,151 @@
+package convert
+
+import (
+	"testing"
+
+	policiesv1 "github.com/kubewarden/adm-controller/api/policies/v1"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/share"
+	nvapis "github.com/neuvector/neuvector/controller/api"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func namespaceNameSelector(operator metav1.LabelSelectorOperator, namespaces ...string) *metav1.LabelSelector {
+	return &metav1.LabelSelector{
+		MatchExpressions: []metav1.LabelSelectorRequirement{
+			{Key: "kubernetes.io/metadata.name", Operator: operator, Values: namespaces},
+		},
+	}
+}
+
+func TestMergeNamespaceSelectors(t *testing.T) {
+	in := metav1.LabelSelectorOpIn
+	notIn := metav1.LabelSelectorOpNotIn
+
+	tests := []struct {
+		name             string
+		a                *metav1.LabelSelector
+		b                *metav1.LabelSelector
+		expectedSelector *metav1.LabelSelector
+		expectedMerged   bool
+	}{
+		{
+			name:           "every namespace",
+			a:              nil,
+			b:              namespaceNameSelector(in, "foo"),
+			expectedMerged: true,
+		},
+		{
+			name:             "namespaces of both",
+			a:                namespaceNameSelector(in, "foo", "bar"),
+			b:                namespaceNameSelector(in, "baz", "foo"),
+			expectedSelector: namespaceNameSelector(in, "bar", "baz", "foo"),
+			expectedMerged:   true,
+		},
+		{
+			name:             "namespaces excluded by both",
+			a:                namespaceNameSelector(notIn, "foo", "bar"),
+			b:                namespaceNameSelector(notIn, "bar", "baz"),
+			expectedSelector: namespaceNameSelector(notIn, "bar"),
+			expectedMerged:   true,
+		},
+		{
+			name:           "no namespace excluded by both",
+			a:              namespaceNameSelector(notIn, "foo"),
+			b:              namespaceNameSelector(notIn, "bar"),
+			expectedMerged: true,
+		},
+		{
+			name:             "namespaces excluded but the selected ones",
+			a:                namespaceNameSelector(notIn, "foo", "bar"),
+			b:                namespaceNameSelector(in, "foo"),
+			expectedSelector: namespaceNameSelector(notIn, "bar"),
+			expectedMerged:   true,
+		},
+		{
+			name: "equal selectors of several label keys",
+			a: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "kubernetes.io/metadata.name", Operator: in, Values: []string{"foo"}},
+				{Key: "name", Operator: in, Values: []string{"foo"}},
+			}},
+			b: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "kubernetes.io/metadata.name", Operator: in, Values: []string{"foo"}},
+				{Key: "name", Operator: in, Values: []string{"foo"}},
+			}},
+			expectedSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "kubernetes.io/metadata.name", Operator: in, Values: []string{"foo"}},
+				{Key: "name", Operator: in, Values: []string{"foo"}},
+			}},
+			expectedMerged: true,
+		},
+		{
+			name: "selectors of several label keys",
+			a: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "kubernetes.io/metadata.name", Operator: in, Values: []string{"foo"}},
+				{Key: "name", Operator: in, Values: []string{"foo"}},
+			}},
+			b:              namespaceNameSelector(in, "bar"),
+			expectedMerged: false,
+		},
+		{
+			name: "selectors of different label keys",
+			a:    namespaceNameSelector(in, "foo"),
+			b: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "name", Operator: in, Values: []string{"bar"}},
+			}},
+			expectedMerged: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selector, merged := mergeNamespaceSelectors(tt.a, tt.b)
+			require.Equal(t, tt.expectedMerged, merged)
+			require.Equal(t, tt.expectedSelector, selector)
+		})
+	}
+}
+
+func TestConsolidatePolicies(t *testing.T) {
+	group := func(name string, mode string, namespaces ...string) *policiesv1.ClusterAdmissionPolicyGroup {
+		group := &policiesv1.ClusterAdmissionPolicyGroup{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+		}
+		group.Spec.Message = "violate NeuVector rule (id=" + name + ")"
+		group.Spec.Mode = policiesv1.PolicyMode(mode)
+		group.Spec.Expression = "trusted_repos() && pod_privileged()"
+		group.Spec.Policies = policiesv1.PolicyGroupMembersWithContext{
+			"trusted_repos": {PolicyGroupMember: policiesv1.PolicyGroupMember{
+				Module:   "registry://ghcr.io/kubewarden/policies/trusted-repos:v2.0.1",
+				Settings: runtime.RawExtension{Raw: []byte(`{"images":{"reject":["nginx"]}}`)},
+			}},
+		}
+		group.Spec.NamespaceSelector = namespaceNameSelector(metav1.LabelSelectorOpIn, namespaces...)
+		return group
+	}
+
+	policies, mergedPolicies, err := consolidatePolicies(
+		[]Policy{
+			group("1000", "protect", "foo"),
+			group("1001", "monitor", "bar"),
+			group("1002", "protect", "bar"),
+		},
+		[]*nvapis.RESTAdmissionRule{{ID: 1000}, {ID: 1001}, {ID: 1002}},
+		share.ConversionConfig{},
+	)
+	require.NoError(t, err)
+	require.Len(t, policies, 2)
+	require.Equal(t, map[uint32][]string{1000: {"1000"}, 1002: {"1000"}}, mergedPolicies)
+
+	merged, ok := policies[0].(*policiesv1.ClusterAdmissionPolicyGroup)
+	require.True(t, ok)
+	require.Equal(t, "violate NeuVector rules (ids=1000,1002)", merged.Spec.Message)
+	require.Equal(t, "1000,1002", merged.Annotations[RuleIDsAnnotation])
+	require.Equal(t, namespaceNameSelector(metav1.LabelSelectorOpIn, "bar", "foo"), merged.Spec.NamespaceSelector)
+
+	other, ok := policies[1].(*policiesv1.ClusterAdmissionPolicyGroup)
+	require.True(t, ok)
+	require.Equal(t, "violate NeuVector rule (id=1001)", other.Spec.Message)
+	require.Empty(t, other.Annotations)
+}
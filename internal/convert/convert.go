@@ -17,54 +17,63 @@ limitations under the License.
 package convert
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"os"
-	"strconv"
+	"slices"
+	"strings"
 
 	policiesv1 "github.com/kubewarden/adm-controller/api/policies/v1"
 	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/customrule"
 	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/handlers"
 	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/metacriterion"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/mirror"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/output"
 	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/policy"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/policyserver"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/resources"
 	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/share"
 	nvapis "github.com/neuvector/neuvector/controller/api"
-	"github.com/olekukonko/tablewriter"
-	"github.com/olekukonko/tablewriter/tw"
-	"sigs.k8s.io/yaml"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 type RuleConverter struct {
 	config         share.ConversionConfig
 	policyFactory  *policy.Factory
+	regoWriter     *customrule.RegoWriter
 	logger         *slog.Logger
-	showSummary    bool
 	handlers       map[string]share.PolicyHandler
 	metaCriterions map[string]metacriterion.MetaCriterion
 }
 
+// ConversionResult holds the policies generated for the NeuVector rules, the number of rules converted to
+// a Rego policy and the conversion summary of every rule.
 type ConversionResult struct {
 	Policies  []Policy
 	RegoCount int
-	Summary   []summaryEntry
+	Summary   []SummaryEntry
+	// Modules are the modules referenced by the policies, with their registry mirror
+	Modules []mirror.Module
+	// PolicyServerManifests are the PolicyServer of the policies and the RBAC of its service account, when
+	// generated
+	PolicyServerManifests []runtime.Object
 }
 
 const (
-	defaultColumnWidth = 50
 	defaultNVRuleIDMax = 1000
 
-	summaryEntryStatusOK      = "OK"
-	summaryEntryStatusSkipped = "Skipped"
+	SummaryStatusOK      = "OK"
+	SummaryStatusSkipped = "Skipped"
 )
 
 func NewRuleConverter(config share.ConversionConfig) *RuleConverter {
 	rc := &RuleConverter{
 		config:        config,
 		policyFactory: policy.NewFactory(),
-		showSummary:   config.ShowSummary,
+		regoWriter:    customrule.NewRegoWriter(&output.FileWriter{}, config.RegoDir, config.RegoLayout),
 		logger:        slog.New(slog.NewTextHandler(os.Stdout, nil)),
 	}
 
@@ -75,6 +84,16 @@ func NewRuleConverter(config share.ConversionConfig) *RuleConverter {
 	return rc
 }
 
+// SetWriter sets the writer of the Rego artifacts generated by the conversion, the filesystem by default.
+func (r *RuleConverter) SetWriter(writer output.Writer) {
+	r.regoWriter = customrule.NewRegoWriter(writer, r.config.RegoDir, r.config.RegoLayout)
+}
+
+// SetLogger sets the logger of the conversion.
+func (r *RuleConverter) SetLogger(logger *slog.Logger) {
+	r.logger = logger
+}
+
 func (r *RuleConverter) initHandlers() {
 	r.handlers = map[string]share.PolicyHandler{
 		handlers.RuleShareIPC:                  handlers.NewHostNamespaceHandler(),
@@ -113,51 +132,86 @@ func (r *RuleConverter) initHandlers() {
 			r.config.VulReportNamespace,
 			r.config.Platform,
 		),
+		handlers.RuleImageCompliance: handlers.NewImageComplianceHandler(
+			r.config.VulReportNamespace,
+			r.config.Platform,
+		),
+		handlers.RuleModules: handlers.NewModulesHandler(
+			r.config.VulReportNamespace,
+			r.config.Platform,
+		),
 	}
 }
 
-func (r *RuleConverter) initMetaCriterions() {
-	r.metaCriterions = map[string]metacriterion.MetaCriterion{
-		metacriterion.RulePSPBestPractices: metacriterion.NewPSPBestPracticeMetaCriterion(),
+// LoadHandlerPlugins registers the handlers declared by the plugin files of the directory.
+// A plugin declaring a built-in criterion replaces its handler, to enforce it with another module.
+func (r *RuleConverter) LoadHandlerPlugins(dir string) error {
+	pluginHandlers, err := handlers.LoadPluginHandlers(dir)
+	if err != nil {
+		return err
+	}
+
+	for criterion, handler := range pluginHandlers {
+		r.handlers[criterion] = handler
 	}
+	return nil
 }
 
-func (r *RuleConverter) Convert(ctx context.Context, ruleFile string) error {
-	loader := NewRuleParser(ruleFile)
-	admissionRules, err := loader.ParseRules()
+// LoadResources loads the resources file configuring the resources the policies apply to, and their operations.
+func (r *RuleConverter) LoadResources(path string) error {
+	config, err := resources.Load(path)
 	if err != nil {
-		return fmt.Errorf("failed to parse NeuVector Admission rules: %w", err)
+		return err
 	}
 
-	result := r.convertRules(ctx, admissionRules.Rules)
+	r.config.Resources = config
+	return nil
+}
 
-	// Write all generated policies to the output file, but only if there are one or more policies
-	// Custom rules generate Rego files only, so policies may be empty
-	if len(result.Policies) > 0 {
-		if err = r.outputPolicies(result.Policies, r.config.OutputFile); err != nil {
-			return fmt.Errorf("failed to write output YAML: %w", err)
+// SetModuleOverrides overrides the modules of the handlers by module name, to pin another version
+// or registry of a module. The overrides are checked compatible with the settings generated by the handlers.
+func (r *RuleConverter) SetModuleOverrides(overrides map[string]string) error {
+	names := slices.Sorted(maps.Keys(overrides))
+	for _, name := range names {
+		module := overrides[name]
+		key := handlers.ModuleOverrideKey(name)
+		overridden := false
+
+		if key == share.ExtractModuleName(handlers.PolicyCELPolicyURI) {
+			if err := handlers.CheckModuleOverride(handlers.PolicyCELPolicyURI, module); err != nil {
+				return err
+			}
+			r.config.CELPolicyModule = module
+			overridden = true
 		}
-	}
 
-	if r.showSummary {
-		err = r.renderResultsTable(result.Summary)
-		if err != nil {
-			return fmt.Errorf("failed to render results table: %w", err)
+		for _, handler := range r.handlers {
+			overrider, ok := handler.(moduleOverrider)
+			if !ok || handler.GetModule() == "" || share.ExtractModuleName(handler.GetModule()) != key {
+				continue
+			}
+			if err := overrider.OverrideModule(module); err != nil {
+				return err
+			}
+			overridden = true
 		}
-	}
 
-	if result.RegoCount > 0 {
-		r.logger.InfoContext(ctx, "rego policies generated",
-			"count", result.RegoCount,
-			"directory", "rego_policies/",
-		)
+		if !overridden {
+			return fmt.Errorf("no handler uses the module %s", name)
+		}
 	}
+	return nil
+}
 
-	if r.config.OutputFile != "-" && len(result.Policies) > 0 {
-		r.logger.InfoContext(ctx, "Conversion done", "output_file", r.config.OutputFile)
-	}
+// moduleOverrider is implemented by the handlers whose module can be overridden.
+type moduleOverrider interface {
+	OverrideModule(module string) error
+}
 
-	return nil
+func (r *RuleConverter) initMetaCriterions() {
+	r.metaCriterions = map[string]metacriterion.MetaCriterion{
+		metacriterion.RulePSPBestPractices: metacriterion.NewPSPBestPracticeMetaCriterion(),
+	}
 }
 
 // expandMetaCriterion processes and expands meta criteria in admission rules.
@@ -192,60 +246,465 @@ func (r *RuleConverter) containsCustomRule(rule *nvapis.RESTAdmissionRule) bool
 	return false
 }
 
-func (r *RuleConverter) convertRules(
+// regoPolicyCriteria returns the handler and the criteria of the rule which have no Kubewarden module yet,
+// and must be converted to a Rego policy through the custom rule path.
+func (r *RuleConverter) regoPolicyCriteria(
+	rule *nvapis.RESTAdmissionRule,
+) (share.RegoPolicyHandler, []*nvapis.RESTAdmRuleCriterion) {
+	var (
+		regoHandler share.RegoPolicyHandler
+		criteria    []*nvapis.RESTAdmRuleCriterion
+	)
+
+	for _, criterion := range rule.Criteria {
+		handler, ok := r.handlers[criterion.Name].(share.RegoPolicyHandler)
+		if ok && handler.RequiresRegoPolicy() {
+			regoHandler = handler
+			criteria = append(criteria, criterion)
+		}
+	}
+	return regoHandler, criteria
+}
+
+// convertRegoRule converts a rule whose criteria have no Kubewarden module to a Rego policy.
+// Only the namespace criterion can be combined with such criteria, it's checked by the Rego policy itself: the
+// policy may be deployed without the custom module policy and its namespace selector.
+func (r *RuleConverter) convertRegoRule(
+	rule *nvapis.RESTAdmissionRule,
+	regoHandler share.RegoPolicyHandler,
+	criteria []*nvapis.RESTAdmRuleCriterion,
+) (string, error) {
+	if err := r.validateRule(rule); err != nil {
+		return "", err
+	}
+
+	for _, criterion := range rule.Criteria {
+		if criterion.Name != handlers.RuleNamespace && !slices.Contains(criteria, criterion) {
+			return "", fmt.Errorf(
+				"%s: %s cannot be combined with %s",
+				share.MsgUnsupportedRuleCriteria,
+				criteria[0].Name,
+				criterion.Name,
+			)
+		}
+	}
+
+	regoCode, err := regoHandler.BuildRegoPolicy(rule, criteria)
+	if err != nil {
+		return "", fmt.Errorf("failed to build rego policy: %w", err)
+	}
+	return regoCode, nil
+}
+
+// convertToRego converts the rules that can't be enforced by the Kubewarden modules to a Rego policy,
+// compiled to an annotated Wasm module when requested. It returns false if the rule isn't converted to Rego,
+// and the notes of the Rego unit tests of the custom rules.
+func (r *RuleConverter) convertToRego(ctx context.Context, rule *nvapis.RESTAdmissionRule) (bool, string, error) {
+	var (
+		regoCode              string
+		testCode              string
+		contextAwareResources []policiesv1.ContextAwareResource
+		err                   error
+	)
+
+	regoHandler, regoCriteria := r.regoPolicyCriteria(rule)
+	switch {
+	case r.containsCustomRule(rule):
+		regoCode, testCode, err = r.generateCustomRego(rule)
+	case regoHandler != nil:
+		regoCode, err = r.convertRegoRule(rule, regoHandler, regoCriteria)
+		if handler, ok := regoHandler.(share.PolicyHandler); ok {
+			contextAwareResources = handler.GetContextAwareResources()
+		}
+	default:
+		return false, "", nil
+	}
+	if err != nil {
+		return true, "", err
+	}
+
+	testNotes, err := r.writeRegoPolicy(ctx, rule.ID, regoCode, testCode, contextAwareResources)
+	return true, testNotes, err
+}
+
+// generateCustomRego generates the Rego policy of the custom criteria of the rule, and their unit tests.
+func (r *RuleConverter) generateCustomRego(rule *nvapis.RESTAdmissionRule) (string, string, error) {
+	regoCode, err := customrule.GenerateRegoPolicy(rule)
+	if err != nil {
+		return "", "", err
+	}
+
+	testCode, err := customrule.GenerateRegoTests(rule)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate rego tests: %w", err)
+	}
+	return regoCode, testCode, nil
+}
+
+// writeRegoPolicy writes the Rego policy generated for the rule, its unit tests when any, and its annotated
+// Wasm module when requested. It returns the notes of the unit tests when they're run.
+// The rule is skipped instead when the Rego artifacts aren't written.
+func (r *RuleConverter) writeRegoPolicy(
+	ctx context.Context,
+	ruleID uint32,
+	regoCode string,
+	testCode string,
+	contextAwareResources []policiesv1.ContextAwareResource,
+) (string, error) {
+	if r.config.SkipRego {
+		return "", errors.New(share.MsgRegoPolicySkipped)
+	}
+
+	builder := policy.BaseBuilder{}
+	rules := builder.BuildRules(ruleID, []string{handlers.ResourceWorkload}, r.config)
+	metadata := customrule.NewMetadata(ruleID, rules, contextAwareResources)
+	if err := r.regoWriter.WritePolicy(ruleID, regoCode, metadata); err != nil {
+		return "", err
+	}
+
+	var testNotes string
+	if testCode != "" {
+		if err := r.regoWriter.WriteTests(ruleID, testCode); err != nil {
+			return "", err
+		}
+		if r.config.RunRegoTests {
+			testNotes = r.runRegoTests(ctx, regoCode, testCode)
+		}
+	}
+
+	if !r.config.BuildCustomWasm {
+		return testNotes, nil
+	}
+
+	wasmModule, err := customrule.BuildWasmPolicy(ctx, regoCode, metadata)
+	if err != nil {
+		return "", fmt.Errorf("failed to build wasm policy: %w", err)
+	}
+	return testNotes, r.regoWriter.WriteWasm(ruleID, wasmModule)
+}
+
+// runRegoTests runs the unit tests of the Rego policy and returns their summary notes.
+// The tests not run don't fail the conversion, the policy is still written.
+func (r *RuleConverter) runRegoTests(ctx context.Context, regoCode string, testCode string) string {
+	result, err := customrule.RunRegoTests(ctx, regoCode, testCode)
+	switch {
+	case err != nil:
+		return fmt.Sprintf("%s: %s", share.MsgRegoTestsNotRun, err)
+	case len(result.Failed) > 0:
+		return fmt.Sprintf("%s: %s", share.MsgRegoTestsFailed, strings.Join(result.Failed, ", "))
+	default:
+		return share.MsgRegoTestsPassed
+	}
+}
+
+// withTestNotes appends the notes of the Rego unit tests to the summary notes of the rule.
+func withTestNotes(notes string, testNotes string) string {
+	if testNotes == "" {
+		return notes
+	}
+	return fmt.Sprintf("%s, %s", notes, testNotes)
+}
+
+// withSplitNotes appends the policies of the rule to its summary notes, when its policy group is split.
+func withSplitNotes(notes string, policies []Policy) string {
+	if len(policies) < 2 {
+		return notes
+	}
+
+	names := make([]string, 0, len(policies))
+	for _, policy := range policies {
+		names = append(names, policyName(policy))
+	}
+	return fmt.Sprintf("%s, %s %s", notes, share.MsgPolicyGroupSplit, strings.Join(names, ", "))
+}
+
+// splitsCustomCriteria returns true if the custom criteria of the rule are enforced by a custom module member
+// of the policy group, next to the Kubewarden modules enforcing the built-in criteria.
+// The policy group can only reference the custom module when its registry is known.
+func (r *RuleConverter) splitsCustomCriteria(rule *nvapis.RESTAdmissionRule) bool {
+	if r.config.CustomModuleRegistry == "" {
+		return false
+	}
+
+	var hasCustom, hasBuiltin bool
+	for _, criterion := range rule.Criteria {
+		switch {
+		case customrule.IsCustomRule(criterion.Name):
+			hasCustom = true
+		case criterion.Name == handlers.RuleNamespace:
+		default:
+			handler, ok := r.handlers[criterion.Name].(share.RegoPolicyHandler)
+			if ok && handler.RequiresRegoPolicy() {
+				return false
+			}
+			hasBuiltin = true
+		}
+	}
+	return hasCustom && hasBuiltin
+}
+
+// convertMixedRule converts a rule combining custom and built-in criteria to a policy group, or to a policy per
+// module when it's split. Only the custom criteria are converted to a Rego policy, the built-in ones keep their
+// Kubewarden module. It also returns the notes of the Rego unit tests of the custom criteria.
+func (r *RuleConverter) convertMixedRule(
+	ctx context.Context,
+	rule *nvapis.RESTAdmissionRule,
+) ([]Policy, string, error) {
+	if err := r.validateRule(rule); err != nil {
+		return nil, "", err
+	}
+
+	customRule := *rule
+	customRule.Criteria = nil
+	for _, criterion := range rule.Criteria {
+		if customrule.IsCustomRule(criterion.Name) {
+			customRule.Criteria = append(customRule.Criteria, criterion)
+		}
+	}
+
+	regoCode, testCode, err := r.generateCustomRego(&customRule)
+	if err != nil {
+		return nil, "", err
+	}
+	testNotes, err := r.writeRegoPolicy(ctx, rule.ID, regoCode, testCode, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	convertedPolicies, err := r.convertRule(ctx, rule)
+	return convertedPolicies, testNotes, err
+}
+
+// ConvertRules converts the NeuVector rules to Kubewarden policies. The Rego policies of the rules without
+// Kubewarden module are written with the converter writer, the policies are returned to the caller.
+func (r *RuleConverter) ConvertRules(
 	ctx context.Context,
 	nvRules []*nvapis.RESTAdmissionRule,
 ) ConversionResult {
 	var (
-		convertedPolicy Policy
-		policies        []Policy
-		regoCount       int
-		err             error
-		summary         []summaryEntry
+		convertedPolicy   Policy
+		convertedPolicies []Policy
+		policies          []Policy
+		policyRules       []*nvapis.RESTAdmissionRule
+		regoCount         int
+		isRego            bool
+		testNotes         string
+		err               error
+		summary           []SummaryEntry
 	)
 
 	for _, rule := range nvRules {
 		if err = r.expandMetaCriterion(rule); err != nil {
-			summary = append(summary, summaryEntry{id: rule.ID, status: summaryEntryStatusSkipped, notes: err.Error()})
+			summary = append(summary, SummaryEntry{ID: rule.ID, Status: SummaryStatusSkipped, Notes: err.Error()})
 			continue
 		}
-		if r.containsCustomRule(rule) {
-			err = customrule.BuildRegoPolicy(rule)
+		if r.splitsCustomCriteria(rule) {
+			convertedPolicies, testNotes, err = r.convertMixedRule(ctx, rule)
 			if err != nil {
 				summary = append(
 					summary,
-					summaryEntry{id: rule.ID, status: summaryEntryStatusSkipped, notes: err.Error()},
+					SummaryEntry{ID: rule.ID, Status: SummaryStatusSkipped, Notes: err.Error()},
 				)
 				continue
 			}
+			summary = append(summary, SummaryEntry{
+				ID:     rule.ID,
+				Status: SummaryStatusOK,
+				Notes:  withTestNotes(withSplitNotes(share.MsgMixedRulePolicyGenerated, convertedPolicies), testNotes),
+			})
+			for _, convertedPolicy = range convertedPolicies {
+				policies = append(policies, convertedPolicy)
+				policyRules = append(policyRules, rule)
+			}
+			regoCount++
+			continue
+		}
+		if isRego, testNotes, err = r.convertToRego(ctx, rule); err != nil {
+			summary = append(summary, SummaryEntry{ID: rule.ID, Status: SummaryStatusSkipped, Notes: err.Error()})
+			continue
+		}
+		if isRego {
+			notes := share.MsgRegoPolicyGenerated
+			if r.config.BuildCustomWasm {
+				notes = share.MsgWasmPolicyGenerated
+			}
+			if r.config.CustomModuleRegistry != "" {
+				convertedPolicy, err = r.convertCustomModuleRule(rule)
+				if err != nil {
+					summary = append(
+						summary,
+						SummaryEntry{ID: rule.ID, Status: SummaryStatusSkipped, Notes: err.Error()},
+					)
+					continue
+				}
+				policies = append(policies, convertedPolicy)
+				policyRules = append(policyRules, rule)
+				notes = share.MsgCustomModulePolicyGenerated
+			}
 			summary = append(
 				summary,
-				summaryEntry{
-					id:     rule.ID,
-					status: summaryEntryStatusOK,
-					notes:  "Rego policy generated (no policy YAML for custom rule)",
-				},
+				SummaryEntry{ID: rule.ID, Status: SummaryStatusOK, Notes: withTestNotes(notes, testNotes)},
 			)
 			regoCount++
 			continue
 		}
-		convertedPolicy, err = r.convertRule(ctx, rule)
+		convertedPolicies, err = r.convertRule(ctx, rule)
 		if err != nil {
-			summary = append(summary, summaryEntry{id: rule.ID, status: summaryEntryStatusSkipped, notes: err.Error()})
+			summary = append(summary, SummaryEntry{ID: rule.ID, Status: SummaryStatusSkipped, Notes: err.Error()})
 			continue
 		}
-		summary = append(
-			summary,
-			summaryEntry{id: rule.ID, status: summaryEntryStatusOK, notes: share.MsgRuleConvertedSuccessfully},
-		)
-		policies = append(policies, convertedPolicy)
+		summary = append(summary, SummaryEntry{
+			ID:     rule.ID,
+			Status: SummaryStatusOK,
+			Notes:  withSplitNotes(r.conversionNotes(ctx, rule), convertedPolicies),
+		})
+		for _, convertedPolicy = range convertedPolicies {
+			policies = append(policies, convertedPolicy)
+			policyRules = append(policyRules, rule)
+		}
+	}
+
+	if r.config.Consolidate {
+		policies, summary = r.consolidate(ctx, policies, policyRules, summary)
 	}
 
 	return ConversionResult{
-		Policies:  policies,
-		RegoCount: regoCount,
-		Summary:   summary,
+		Policies:              policies,
+		RegoCount:             regoCount,
+		Summary:               summary,
+		Modules:               r.mirrorModules(policies),
+		PolicyServerManifests: r.policyServerManifests(ctx, policies),
+	}
+}
+
+// policyServerManifests returns the PolicyServer of the policies and the RBAC of its service account, granting
+// the access to the context aware resources of the policies and to the Kubernetes API their modules call.
+// Nothing is generated unless configured.
+func (r *RuleConverter) policyServerManifests(ctx context.Context, policies []Policy) []runtime.Object {
+	if r.config.PolicyServerManifests == nil {
+		return nil
+	}
+
+	var (
+		contextAwareResources []policiesv1.ContextAwareResource
+		moduleNames           []string
+	)
+	for _, convertedPolicy := range policies {
+		switch p := convertedPolicy.(type) {
+		case *policiesv1.ClusterAdmissionPolicy:
+			contextAwareResources = append(contextAwareResources, p.Spec.ContextAwareResources...)
+			moduleNames = append(moduleNames, share.ExtractModuleName(p.Spec.Module))
+		case *policiesv1.AdmissionPolicy:
+			moduleNames = append(moduleNames, share.ExtractModuleName(p.Spec.Module))
+		case *policiesv1.ClusterAdmissionPolicyGroup:
+			for _, member := range p.Spec.Policies {
+				contextAwareResources = append(contextAwareResources, member.ContextAwareResources...)
+				moduleNames = append(moduleNames, share.ExtractModuleName(member.Module))
+			}
+		case *policiesv1.AdmissionPolicyGroup:
+			for _, member := range p.Spec.Policies {
+				moduleNames = append(moduleNames, share.ExtractModuleName(member.Module))
+			}
+		}
+	}
+
+	rules, err := policyserver.ContextAwareRules(contextAwareResources)
+	if err != nil {
+		r.logger.ErrorContext(ctx, "failed to generate the PolicyServer manifests", "error", err)
+		return nil
+	}
+	for _, name := range slices.Sorted(maps.Keys(r.handlers)) {
+		handler, ok := r.handlers[name].(share.APIAccessPolicyHandler)
+		if ok && slices.Contains(moduleNames, share.ExtractModuleName(r.handlers[name].GetModule())) {
+			rules = append(rules, handler.GetAPIAccessRules()...)
+		}
+	}
+	return policyserver.Manifests(r.config.PolicyServer, *r.config.PolicyServerManifests, rules)
+}
+
+// consolidate merges the identical policies of the rules, and notes the policy they're merged into in the summary
+// of their rules. The policies are returned as is if they can't be compared.
+func (r *RuleConverter) consolidate(
+	ctx context.Context,
+	policies []Policy,
+	policyRules []*nvapis.RESTAdmissionRule,
+	summary []SummaryEntry,
+) ([]Policy, []SummaryEntry) {
+	consolidated, mergedPolicies, err := consolidatePolicies(policies, policyRules, r.config)
+	if err != nil {
+		r.logger.WarnContext(ctx, "policies not consolidated", "error", err)
+		return policies, summary
+	}
+
+	for idx, entry := range summary {
+		if names, ok := mergedPolicies[entry.ID]; ok && entry.Status == SummaryStatusOK {
+			summary[idx].Notes = fmt.Sprintf("%s, %s %s",
+				entry.Notes, share.MsgPolicyConsolidated, strings.Join(names, ", "))
+		}
+	}
+	return consolidated, summary
+}
+
+// mirrorModules rewrites the modules of the policies and of the policy group members to their registry mirror.
+// It returns the modules referenced by the policies, in the order of the policies.
+func (r *RuleConverter) mirrorModules(policies []Policy) []mirror.Module {
+	var modules []mirror.Module
+	addModule := func(source string) string {
+		module := mirror.Module{Source: source}
+		if rewritten := mirror.Rewrite(source, r.config.RegistryMirrors); rewritten != source {
+			module.Mirror = rewritten
+		}
+		if !slices.Contains(modules, module) {
+			modules = append(modules, module)
+		}
+		if module.Mirror != "" {
+			return module.Mirror
+		}
+		return source
+	}
+
+	for _, convertedPolicy := range policies {
+		switch p := convertedPolicy.(type) {
+		case *policiesv1.ClusterAdmissionPolicy:
+			p.Spec.Module = addModule(p.Spec.Module)
+		case *policiesv1.AdmissionPolicy:
+			p.Spec.Module = addModule(p.Spec.Module)
+		case *policiesv1.ClusterAdmissionPolicyGroup:
+			for _, name := range slices.Sorted(maps.Keys(p.Spec.Policies)) {
+				member := p.Spec.Policies[name]
+				member.Module = addModule(member.Module)
+				p.Spec.Policies[name] = member
+			}
+		case *policiesv1.AdmissionPolicyGroup:
+			for _, name := range slices.Sorted(maps.Keys(p.Spec.Policies)) {
+				member := p.Spec.Policies[name]
+				member.Module = addModule(member.Module)
+				p.Spec.Policies[name] = member
+			}
+		}
 	}
+	return modules
+}
+
+// conversionNotes returns the summary notes of a converted rule, including the warnings of the handlers
+// whose conversion lost precision. The warnings are logged too.
+func (r *RuleConverter) conversionNotes(ctx context.Context, rule *nvapis.RESTAdmissionRule) string {
+	var warnings []string
+	for _, criterion := range rule.Criteria {
+		if handler, ok := r.handlers[criterion.Name].(share.WarningPolicyHandler); ok {
+			warnings = append(warnings, handler.ConversionWarnings(criterion)...)
+		}
+	}
+
+	if len(warnings) == 0 {
+		return share.MsgRuleConvertedSuccessfully
+	}
+
+	for _, warning := range warnings {
+		r.logger.WarnContext(ctx, "conversion lost precision", "id", rule.ID, "warning", warning)
+	}
+	return fmt.Sprintf("%s, %s: %s", share.MsgRuleConvertedSuccessfully, share.MsgConversionWarnings,
+		strings.Join(warnings, "; "))
 }
 
 func (r *RuleConverter) validateRule(rule *nvapis.RESTAdmissionRule) error {
@@ -291,82 +750,58 @@ func (r *RuleConverter) validateRule(rule *nvapis.RESTAdmissionRule) error {
 	return nil
 }
 
-func (r *RuleConverter) convertRule(ctx context.Context, rule *nvapis.RESTAdmissionRule) (Policy, error) {
+// convertRule converts the rule to its policy, or to a policy per module when its policy group is split.
+func (r *RuleConverter) convertRule(ctx context.Context, rule *nvapis.RESTAdmissionRule) ([]Policy, error) {
 	err := r.validateRule(rule)
 	if err != nil {
 		return nil, err
 	}
 
-	policyObj, err := r.policyFactory.GeneratePolicy(rule, r.config)
+	policyObjs, err := r.policyFactory.GeneratePolicies(rule, r.config)
 	if err != nil {
 		r.logger.InfoContext(ctx, "error when generating Kubewarden policy", "error", err)
 		return nil, fmt.Errorf("%s: %w", share.MsgRuleGenerateKWPolicyError, err)
 	}
 
-	// Type assert to convert to our Policy interface
-	var policy Policy
-	switch p := policyObj.(type) {
-	case *policiesv1.ClusterAdmissionPolicy:
-		policy = p
-	case *policiesv1.ClusterAdmissionPolicyGroup:
-		policy = p
-	default:
-		return nil, errors.New("unexpected policy type")
-	}
-
-	return policy, nil
-}
-
-func (r *RuleConverter) renderResultsTable(summary []summaryEntry) error {
-	table := tablewriter.NewTable(os.Stdout,
-		tablewriter.WithConfig(tablewriter.Config{
-			Row: tw.CellConfig{
-				Formatting:   tw.CellFormatting{AutoWrap: tw.WrapNormal},
-				Alignment:    tw.CellAlignment{Global: tw.AlignLeft},
-				ColMaxWidths: tw.CellWidth{Global: defaultColumnWidth},
-			},
-		}),
-	)
-	table.Header([]string{"ID", "STATUS", "NOTES"})
-	for _, entry := range summary {
-		data := []string{
-			strconv.FormatUint(uint64(entry.id), 10),
-			entry.status,
-			entry.notes,
-		}
-		err := table.Append(data)
-		if err != nil {
-			return fmt.Errorf("failed to append data: %w", err)
+	policies := make([]Policy, 0, len(policyObjs))
+	for _, policyObj := range policyObjs {
+		// Type assert to convert to our Policy interface
+		var policy Policy
+		switch p := policyObj.(type) {
+		case *policiesv1.ClusterAdmissionPolicy:
+			policy = p
+		case *policiesv1.ClusterAdmissionPolicyGroup:
+			policy = p
+		case *policiesv1.AdmissionPolicy:
+			policy = p
+		case *policiesv1.AdmissionPolicyGroup:
+			policy = p
+		default:
+			return nil, errors.New("unexpected policy type")
 		}
-	}
 
-	err := table.Render()
-	if err != nil {
-		return fmt.Errorf("failed to render table: %w", err)
+		if err = ValidatePolicySettings(policy); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", rule.ID, err)
+		}
+		policies = append(policies, policy)
 	}
-
-	return nil
+	return policies, nil
 }
 
-func (r *RuleConverter) outputPolicies(policies []Policy, filePath string) error {
-	var buf bytes.Buffer
-
-	for idx, policy := range policies {
-		yamlBytes, err := yaml.Marshal(policy)
-		if err != nil {
-			return fmt.Errorf("failed to marshal policy at index %d: %w", idx, err)
-		}
-
-		buf.Write(yamlBytes)
-		if idx < len(policies)-1 {
-			buf.WriteString("\n---\n")
-		}
+// convertCustomModuleRule generates the ClusterAdmissionPolicy, or the namespaced AdmissionPolicy, referencing
+// the module built from the Rego policy.
+func (r *RuleConverter) convertCustomModuleRule(rule *nvapis.RESTAdmissionRule) (Policy, error) {
+	policyObj, err := r.policyFactory.GenerateCustomModulePolicy(rule, r.config)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", share.MsgRuleGenerateKWPolicyError, err)
 	}
 
-	if filePath == "-" {
-		_, err := os.Stdout.Write(buf.Bytes())
-		return err
+	switch p := policyObj.(type) {
+	case *policiesv1.ClusterAdmissionPolicy:
+		return p, nil
+	case *policiesv1.AdmissionPolicy:
+		return p, nil
+	default:
+		return nil, errors.New("unexpected policy type")
 	}
-
-	return os.WriteFile(filePath, buf.Bytes(), 0600)
 }
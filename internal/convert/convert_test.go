@@ -5,16 +5,25 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	policiesv1 "github.com/kubewarden/adm-controller/api/policies/v1"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/customrule"
 	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/handlers"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/metacriterion"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/mirror"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/output"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/policyserver"
 	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/share"
 	nvapis "github.com/neuvector/neuvector/controller/api"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func initMockHandlers() map[string]share.PolicyHandler {
@@ -224,7 +233,7 @@ func TestValidateAndFilterRule(t *testing.T) {
 	}
 }
 
-// TestConvertRules_MockRulesYaml verifies that convertRules behaves correctly
+// TestConvertRules_MockRulesYaml verifies that ConvertRules behaves correctly
 // for the combined NvAdmissionControlSecurityRule manifest under test/mock/rules.yaml.
 func TestConvertRules_MockRulesYaml(t *testing.T) {
 	t.Helper()
@@ -233,7 +242,6 @@ func TestConvertRules_MockRulesYaml(t *testing.T) {
 		Mode:               ModeProtect,
 		PolicyServer:       PolicyServer,
 		BackgroundAudit:    BackgroundAudit,
-		OutputFile:         OutputFile,
 		VulReportNamespace: "default",
 		Platform:           "amd64",
 	}
@@ -248,7 +256,7 @@ func TestConvertRules_MockRulesYaml(t *testing.T) {
 	require.NotNil(t, rulesData)
 	require.Len(t, rulesData.Rules, 4, "rules.yaml should produce four admission rules")
 
-	result := converter.convertRules(context.Background(), rulesData.Rules)
+	result := converter.ConvertRules(context.Background(), rulesData.Rules)
 
 	// First two rules are standard rules -> 2 YAML policies.
 	// Third rule contains customPath criteria -> 1 rego-only policy.
@@ -260,31 +268,31 @@ func TestConvertRules_MockRulesYaml(t *testing.T) {
 	for i := range 3 {
 		assert.Equal(
 			t,
-			summaryEntryStatusOK,
-			result.Summary[i].status,
+			SummaryStatusOK,
+			result.Summary[i].Status,
 			"expected rule %d to be converted successfully",
-			result.Summary[i].id,
+			result.Summary[i].ID,
 		)
-		assert.NotEmpty(t, result.Summary[i].notes)
+		assert.NotEmpty(t, result.Summary[i].Notes)
 	}
 
 	assert.Equal(
 		t,
-		summaryEntryStatusSkipped,
-		result.Summary[3].status,
+		SummaryStatusSkipped,
+		result.Summary[3].Status,
 		"expected rule %d (allow action) to be skipped",
-		result.Summary[3].id,
+		result.Summary[3].ID,
 	)
-	assert.NotEmpty(t, result.Summary[3].notes)
+	assert.NotEmpty(t, result.Summary[3].Notes)
 	assert.Contains(
 		t,
-		result.Summary[3].notes,
+		result.Summary[3].Notes,
 		share.MsgOnlyDenyRuleSupported,
 		"expected skip reason to mention only deny rules are supported",
 	)
 }
 
-// TestOutputPolicies_Stdout reads the test policy and rule, and converts the rule to stdout.
+// TestOutputPolicies_Stdout converts the test rule and streams its policy to stdout as the CLI does.
 // Ensure the output is the same as the test policy, and no file is created.
 func TestOutputPolicies_Stdout(t *testing.T) {
 	testPolicy := "../../test/rules/single_criterion/share_host_ipc/not_allow_share_host_ipc/policy.yaml"
@@ -292,34 +300,20 @@ func TestOutputPolicies_Stdout(t *testing.T) {
 
 	testPolicyBytes, err := os.ReadFile(testPolicy)
 	require.NoError(t, err)
-
-	oldStdout := os.Stdout
-
-	r, w, err := os.Pipe()
+	rules, err := NewRuleParser(testRule).ParseRules()
 	require.NoError(t, err)
-	//nolint:reassign // reassign is needed to capture the output for testing purposes
-	os.Stdout = w
 
-	policyServer := "default"
 	converter := NewRuleConverter(share.ConversionConfig{
-		PolicyServer:    policyServer,
-		OutputFile:      "-",
+		PolicyServer:    "default",
 		Mode:            "protect",
 		BackgroundAudit: true,
-		ShowSummary:     false,
 	})
-	err = converter.Convert(context.Background(), testRule)
-	require.NoError(t, err)
-
-	w.Close()
-	//nolint:reassign // reassign is needed to capture the output for testing purposes
-	os.Stdout = oldStdout
+	result := converter.ConvertRules(context.Background(), rules.Rules)
 
-	var buf bytes.Buffer
-	_, err = io.Copy(&buf, r)
+	var out bytes.Buffer
+	err = output.WriteObjects(&output.StreamWriter{Out: &out}, result.Policies, output.Stdout)
 	require.NoError(t, err)
-
-	assert.Equal(t, buf.String(), string(testPolicyBytes))
+	assert.Equal(t, string(testPolicyBytes), out.String())
 
 	// Ensure no file is created, including the default output file name, and - for stdout.
 	assert.NoFileExists(t, "policies.yaml")
@@ -382,7 +376,9 @@ func TestConvertSingleCriterion_EnvVarSecret(t *testing.T) {
 func TestConvertSingleCriterion_ImageRule(t *testing.T) {
 	for _, ruleDir := range []string{
 		"../../test/rules/single_criterion/image/contains_any",
+		"../../test/rules/single_criterion/image/contains_any_wildcard",
 		"../../test/rules/single_criterion/image/not_contains_any",
+		"../../test/rules/single_criterion/image/not_regex",
 	} {
 		testRuleConversion(t, ruleDir)
 	}
@@ -401,8 +397,10 @@ func TestConvertSingleCriterion_LabelsRule(t *testing.T) {
 	for _, ruleDir := range []string{
 		"../../test/rules/single_criterion/labels/contains_all",
 		"../../test/rules/single_criterion/labels/contains_any",
+		"../../test/rules/single_criterion/labels/contains_any_key_value",
 		"../../test/rules/single_criterion/labels/contains_other_than",
 		"../../test/rules/single_criterion/labels/not_contains_any",
+		"../../test/rules/single_criterion/labels/regex",
 	} {
 		testRuleConversion(t, ruleDir)
 	}
@@ -422,6 +420,9 @@ func TestConvertSingleCriterion_AnnotationsRule(t *testing.T) {
 func TestConvertSingleCriterion_NamespaceRule(t *testing.T) {
 	for _, ruleDir := range []string{
 		"../../test/rules/namespace_selector/image_namespace_contain_any",
+		"../../test/rules/namespace_selector/image_namespace_not_contain_any",
+		"../../test/rules/namespace_selector/image_namespace_wildcard",
+		"../../test/rules/namespace_selector/image_namespace_multiple_criteria",
 	} {
 		testRuleConversion(t, ruleDir)
 	}
@@ -434,6 +435,202 @@ func TestConvertSingleCriterion_NamespaceRule(t *testing.T) {
 	}
 }
 
+// TestConvertRules_PreferNamespaced verifies that a rule targeting a single namespace is converted to a
+// namespaced AdmissionPolicy when namespaced policies are preferred.
+func TestConvertRules_PreferNamespaced(t *testing.T) {
+	ruleDir := "../../test/rules/namespace_selector/image_namespace_prefer_namespaced"
+
+	converter := NewRuleConverter(share.ConversionConfig{
+		Mode:             ModeProtect,
+		PolicyServer:     PolicyServer,
+		BackgroundAudit:  BackgroundAudit,
+		PreferNamespaced: true,
+	})
+
+	err := convertRuleFile(converter, filepath.Join(ruleDir, "rule.json"))
+	require.NoError(t, err)
+	defer os.Remove(OutputFile)
+
+	verifyWithYaml(t, ruleDir)
+}
+
+// TestConvertRules_Consolidate verifies that the rules only differing by their namespaces are converted to
+// a single policy selecting all their namespaces.
+func TestConvertRules_Consolidate(t *testing.T) {
+	ruleDir := "../../test/rules/consolidate/image_namespaces"
+
+	converter := NewRuleConverter(share.ConversionConfig{
+		Mode:            ModeProtect,
+		PolicyServer:    PolicyServer,
+		BackgroundAudit: BackgroundAudit,
+		Consolidate:     true,
+	})
+
+	err := convertRuleFile(converter, filepath.Join(ruleDir, "rule.json"))
+	require.NoError(t, err)
+	defer os.Remove(OutputFile)
+
+	verifyWithYaml(t, ruleDir)
+}
+
+func TestConvertRules_ConsolidateSummary(t *testing.T) {
+	converter := NewRuleConverter(share.ConversionConfig{
+		Mode:            ModeProtect,
+		PolicyServer:    PolicyServer,
+		BackgroundAudit: BackgroundAudit,
+		Consolidate:     true,
+	})
+
+	rule := func(id uint32, image string, namespaceOp string, namespace string) *nvapis.RESTAdmissionRule {
+		return &nvapis.RESTAdmissionRule{
+			ID:       id,
+			RuleType: nvapis.ValidatingDenyRuleType,
+			Criteria: []*nvapis.RESTAdmRuleCriterion{
+				{Name: handlers.RuleImage, Op: "containsAny", Value: image},
+				{Name: handlers.RuleNamespace, Op: namespaceOp, Value: namespace},
+			},
+		}
+	}
+	rules := []*nvapis.RESTAdmissionRule{
+		rule(1000, "nginx", "containsAny", "foo"),
+		rule(1001, "redis", "containsAny", "foo"),
+		rule(1002, "nginx", "notContainsAny", "foo,bar"),
+		{ID: 1003, RuleType: nvapis.ValidatingDenyRuleType, Disable: true},
+	}
+
+	result := converter.ConvertRules(context.Background(), rules)
+
+	require.Len(t, result.Policies, 2)
+	policy, ok := result.Policies[0].(*policiesv1.ClusterAdmissionPolicy)
+	require.True(t, ok)
+	assert.Equal(t, "neuvector-rule-1000-conversion", policy.Name)
+	assert.Equal(t, "1000,1002", policy.Annotations[RuleIDsAnnotation])
+	assert.Equal(t, &metav1.LabelSelector{
+		MatchExpressions: []metav1.LabelSelectorRequirement{
+			{Key: "kubernetes.io/metadata.name", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"bar"}},
+		},
+	}, policy.Spec.NamespaceSelector)
+
+	policy, ok = result.Policies[1].(*policiesv1.ClusterAdmissionPolicy)
+	require.True(t, ok)
+	assert.Equal(t, "neuvector-rule-1001-conversion", policy.Name)
+	assert.Empty(t, policy.Annotations)
+
+	require.Len(t, result.Summary, 4)
+	consolidated := share.MsgRuleConvertedSuccessfully + ", " + share.MsgPolicyConsolidated +
+		" neuvector-rule-1000-conversion"
+	assert.Equal(t, consolidated, result.Summary[0].Notes)
+	assert.Equal(t, share.MsgRuleConvertedSuccessfully, result.Summary[1].Notes)
+	assert.Equal(t, consolidated, result.Summary[2].Notes)
+	assert.Equal(t, SummaryStatusSkipped, result.Summary[3].Status)
+}
+
+func TestConvertRules_ConsolidateMessageTemplate(t *testing.T) {
+	converter := NewRuleConverter(share.ConversionConfig{
+		Mode:            ModeProtect,
+		PolicyServer:    PolicyServer,
+		BackgroundAudit: BackgroundAudit,
+		Consolidate:     true,
+		MessageTemplate: "blocked by NeuVector rules {{.ID}}: {{.Comment}}",
+	})
+
+	rule := func(id uint32, comment string, namespace string) *nvapis.RESTAdmissionRule {
+		return &nvapis.RESTAdmissionRule{
+			ID:       id,
+			Comment:  comment,
+			RuleType: nvapis.ValidatingDenyRuleType,
+			Criteria: []*nvapis.RESTAdmRuleCriterion{
+				{Name: handlers.RuleImage, Op: "containsAny", Value: "nginx"},
+				{Name: handlers.RuleNamespace, Op: "containsAny", Value: namespace},
+			},
+		}
+	}
+	rules := []*nvapis.RESTAdmissionRule{
+		rule(1000, "no nginx in foo", "foo"),
+		rule(1001, "no nginx in bar", "bar"),
+		rule(1002, "no nginx in foo", "baz"),
+	}
+
+	result := converter.ConvertRules(context.Background(), rules)
+
+	require.Len(t, result.Policies, 1)
+	group, ok := result.Policies[0].(*policiesv1.ClusterAdmissionPolicyGroup)
+	require.True(t, ok)
+	assert.Equal(t, "1000,1001,1002", group.Annotations[RuleIDsAnnotation])
+	assert.Equal(t, "blocked by NeuVector rules 1000,1001,1002: no nginx in foo; no nginx in bar", group.Spec.Message)
+}
+
+func TestConvertRules_GroupStrategySplit(t *testing.T) {
+	converter := NewRuleConverter(share.ConversionConfig{
+		Mode:            ModeProtect,
+		PolicyServer:    PolicyServer,
+		BackgroundAudit: BackgroundAudit,
+		GroupStrategy:   share.GroupStrategySplit,
+	})
+
+	rules := []*nvapis.RESTAdmissionRule{
+		{
+			ID:       1000,
+			RuleType: nvapis.ValidatingDenyRuleType,
+			Criteria: []*nvapis.RESTAdmRuleCriterion{
+				{Name: metacriterion.RulePSPBestPractices, Op: "=", Value: "true"},
+			},
+		},
+		{
+			ID:       1001,
+			RuleType: nvapis.ValidatingDenyRuleType,
+			Criteria: []*nvapis.RESTAdmRuleCriterion{
+				{Name: handlers.RuleShareIPC, Op: "=", Value: "true"},
+				{Name: handlers.RuleRunAsPrivileged, Op: "=", Value: "true"},
+			},
+		},
+	}
+
+	result := converter.ConvertRules(context.Background(), rules)
+
+	require.Len(t, result.Policies, 5)
+	names := make([]string, 0, len(result.Policies))
+	for _, policy := range result.Policies[:4] {
+		_, ok := policy.(*policiesv1.ClusterAdmissionPolicy)
+		require.True(t, ok)
+		names = append(names, policyName(policy))
+	}
+	splitNames := []string{
+		"neuvector-rule-1000-conversion-allow-privilege-escalation-psp",
+		"neuvector-rule-1000-conversion-container-running-as-user",
+		"neuvector-rule-1000-conversion-host-namespaces-psp",
+		"neuvector-rule-1000-conversion-pod-privileged",
+	}
+	assert.Equal(t, splitNames, names)
+
+	// The criteria of the other rule must be evaluated together
+	group, ok := result.Policies[4].(*policiesv1.ClusterAdmissionPolicyGroup)
+	require.True(t, ok)
+	assert.Equal(t, "neuvector-rule-1001-conversion", group.Name)
+
+	require.Len(t, result.Summary, 2)
+	assert.Equal(t, share.MsgRuleConvertedSuccessfully+", "+share.MsgPolicyGroupSplit+" "+
+		strings.Join(splitNames, ", "), result.Summary[0].Notes)
+	assert.Equal(t, share.MsgRuleConvertedSuccessfully, result.Summary[1].Notes)
+}
+
+func TestConvertRules_Resources(t *testing.T) {
+	ruleDir := "../../test/rules/resources/image_pods_only"
+
+	converter := NewRuleConverter(share.ConversionConfig{
+		Mode:            ModeProtect,
+		PolicyServer:    PolicyServer,
+		BackgroundAudit: BackgroundAudit,
+	})
+	require.NoError(t, converter.LoadResources(filepath.Join(ruleDir, "resources.yaml")))
+
+	err := convertRuleFile(converter, filepath.Join(ruleDir, "rule.json"))
+	require.NoError(t, err)
+	defer os.Remove(OutputFile)
+
+	verifyWithYaml(t, ruleDir)
+}
+
 func TestConvertSingleCriterion_HighRiskServiceAccount(t *testing.T) {
 	for _, ruleDir := range []string{
 		"../../test/rules/single_criterion/high_risk_service_account/risky_role_any_action_rbac",
@@ -487,6 +684,14 @@ func TestConvertSingleCriterion_CVENames(t *testing.T) {
 	}
 }
 
+func TestConvertSingleCriterion_Modules(t *testing.T) {
+	for _, ruleDir := range []string{
+		"../../test/rules/single_criterion/modules/contains_any",
+	} {
+		testRegoRuleConversion(t, ruleDir)
+	}
+}
+
 func TestConvertSingleCriterion_ResourceLimit(t *testing.T) {
 	for _, ruleDir := range []string{
 		"../../test/rules/single_criterion/resource_limit/cpu_limit_only",
@@ -524,6 +729,27 @@ func TestConvertMultiCriteria_ShareHostPIDAndNetwork(t *testing.T) {
 	testRuleConversion(t, ruleDir)
 }
 
+// TestConvertMultiCriteria_ShareHostIPCNetworkAndPVCStorageClass verifies that a rule whose criteria apply to the
+// workloads and the PVCs is skipped, since no resource matches all its criteria.
+func TestConvertMultiCriteria_ShareHostIPCNetworkAndPVCStorageClass(t *testing.T) {
+	ruleDir := "../../test/rules/multi_criteria/share_host_ipc_network_pvc_storage_class"
+	rules, err := NewRuleParser(filepath.Join(ruleDir, "rule.json")).ParseRules()
+	require.NoError(t, err)
+
+	converter := NewRuleConverter(share.ConversionConfig{
+		Mode:            ModeProtect,
+		PolicyServer:    PolicyServer,
+		BackgroundAudit: BackgroundAudit,
+	})
+	result := converter.ConvertRules(context.Background(), rules.Rules)
+
+	assert.Empty(t, result.Policies)
+	require.Len(t, result.Summary, 1)
+	assert.Equal(t, SummaryStatusSkipped, result.Summary[0].Status)
+	assert.Contains(t, result.Summary[0].Notes,
+		"rule skipped: criteria apply to different resources (pvc, workload), no resource matches them all")
+}
+
 func TestConvertMultiCriteria_ImageAndImageRegistryNamespaceContainAny(t *testing.T) {
 	ruleDir := "../../test/rules/namespace_selector/image_and_image_registry_namespace_contain_any"
 	testRuleConversion(t, ruleDir)
@@ -538,3 +764,529 @@ func TestConvertMultiCriteria_ImageCVE(t *testing.T) {
 	ruleDir := "../../test/rules/multi_criteria/image_cve"
 	testRuleConversion(t, ruleDir)
 }
+
+// TestConvertRules_ImageComplianceRegoFallback verifies that image compliance rules are converted
+// to a Rego policy, since there is no Kubewarden module for this criterion yet.
+func TestConvertRules_ImageComplianceRegoFallback(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	converter := NewRuleConverter(share.ConversionConfig{
+		Mode:               ModeProtect,
+		PolicyServer:       PolicyServer,
+		BackgroundAudit:    BackgroundAudit,
+		VulReportNamespace: "sbomscanner",
+		Platform:           "amd64",
+	})
+
+	rules := []*nvapis.RESTAdmissionRule{
+		{
+			ID:       1000,
+			RuleType: nvapis.ValidatingDenyRuleType,
+			Criteria: []*nvapis.RESTAdmRuleCriterion{
+				{Name: handlers.RuleImageCompliance, Op: "=", Value: "true"},
+				{Name: handlers.RuleNamespace, Op: "containsAny", Value: "foo"},
+			},
+		},
+		{
+			ID:       1001,
+			RuleType: nvapis.ValidatingDenyRuleType,
+			Criteria: []*nvapis.RESTAdmRuleCriterion{
+				{Name: handlers.RuleImageCompliance, Op: "=", Value: "true"},
+				{Name: handlers.RuleRunAsRoot, Op: "=", Value: "true"},
+			},
+		},
+	}
+
+	result := converter.ConvertRules(context.Background(), rules)
+
+	require.Empty(t, result.Policies)
+	require.Equal(t, 1, result.RegoCount)
+	require.Len(t, result.Summary, 2)
+	assert.Equal(t, SummaryStatusOK, result.Summary[0].Status)
+	assert.Equal(t, share.MsgRegoPolicyGenerated, result.Summary[0].Notes)
+	// Without custom module policy, the namespace criterion is only enforced by the Rego policy
+	regoCode, err := os.ReadFile(filepath.Join("rego_policies", "nv_rule_1000.rego"))
+	require.NoError(t, err)
+	assert.Contains(t, string(regoCode), "deny[msg] {\n\t_in_namespaces_0\n")
+	assert.Contains(t, string(regoCode), `input.request.namespace == {"foo"}[_]`)
+
+	assert.Equal(t, SummaryStatusSkipped, result.Summary[1].Status)
+	assert.Contains(t, result.Summary[1].Notes, "imageCompliance cannot be combined with runAsRoot")
+	assert.NoFileExists(t, filepath.Join("rego_policies", "nv_rule_1001.rego"))
+}
+
+func TestConvertRules_ImageWildcardWarnings(t *testing.T) {
+	converter := NewRuleConverter(share.ConversionConfig{
+		Mode:            ModeProtect,
+		PolicyServer:    PolicyServer,
+		BackgroundAudit: BackgroundAudit,
+	})
+
+	rules := []*nvapis.RESTAdmissionRule{
+		{
+			ID:       1000,
+			RuleType: nvapis.ValidatingDenyRuleType,
+			Criteria: []*nvapis.RESTAdmRuleCriterion{
+				{Name: handlers.RuleImage, Op: "containsAny", Value: "nginx:1.2*,*/busybox"},
+			},
+		},
+		{
+			ID:       1001,
+			RuleType: nvapis.ValidatingDenyRuleType,
+			Criteria: []*nvapis.RESTAdmRuleCriterion{
+				{Name: handlers.RuleImage, Op: "containsAny", Value: "nginx,redis"},
+			},
+		},
+	}
+
+	result := converter.ConvertRules(context.Background(), rules)
+
+	require.Len(t, result.Policies, 2)
+	require.Len(t, result.Summary, 2)
+
+	policy, ok := result.Policies[0].(*policiesv1.ClusterAdmissionPolicy)
+	require.True(t, ok)
+	assert.Equal(t, handlers.PolicyCELPolicyURI, policy.Spec.Module)
+	assert.Equal(t, SummaryStatusOK, result.Summary[0].Status)
+	assert.Equal(t,
+		share.MsgRuleConvertedSuccessfully+", "+share.MsgConversionWarnings+
+			`: image "*/busybox": the leading wildcard matches any registry and repository path`,
+		result.Summary[0].Notes,
+	)
+
+	policy, ok = result.Policies[1].(*policiesv1.ClusterAdmissionPolicy)
+	require.True(t, ok)
+	assert.Equal(t, handlers.PolicyTrustedReposPolicyURI, policy.Spec.Module)
+	assert.Equal(t, share.MsgRuleConvertedSuccessfully, result.Summary[1].Notes)
+}
+
+func TestConvertRules_CustomModulePolicy(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	converter := NewRuleConverter(share.ConversionConfig{
+		Mode:                 ModeProtect,
+		PolicyServer:         PolicyServer,
+		BackgroundAudit:      BackgroundAudit,
+		VulReportNamespace:   "sbomscanner",
+		Platform:             "amd64",
+		CustomModuleRegistry: "registry://ghcr.io/acme/policies/",
+		CustomModuleVersion:  "v1.0.0",
+	})
+
+	rules := []*nvapis.RESTAdmissionRule{
+		{
+			ID:       1000,
+			RuleType: nvapis.ValidatingDenyRuleType,
+			Criteria: []*nvapis.RESTAdmRuleCriterion{
+				{Name: handlers.RuleImageCompliance, Op: "=", Value: "true"},
+				{Name: handlers.RuleNamespace, Op: "containsAny", Value: "foo"},
+			},
+		},
+	}
+
+	result := converter.ConvertRules(context.Background(), rules)
+
+	require.Len(t, result.Policies, 1)
+	require.Equal(t, 1, result.RegoCount)
+	require.Len(t, result.Summary, 1)
+	assert.Equal(t, SummaryStatusOK, result.Summary[0].Status)
+	assert.Equal(t, share.MsgCustomModulePolicyGenerated, result.Summary[0].Notes)
+	assert.FileExists(t, filepath.Join("rego_policies", "nv_rule_1000.rego"))
+
+	policy, ok := result.Policies[0].(*policiesv1.ClusterAdmissionPolicy)
+	require.True(t, ok)
+	assert.Equal(t, "neuvector-rule-1000-conversion", policy.Name)
+	assert.Equal(t, "registry://ghcr.io/acme/policies/nv-rule-1000:v1.0.0", policy.Spec.Module)
+	assert.NotNil(t, policy.Spec.NamespaceSelector)
+	assert.Len(t, policy.Spec.ContextAwareResources, 1)
+}
+
+func TestConvertRules_MixedCustomRule(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	rules := []*nvapis.RESTAdmissionRule{
+		{
+			ID:       1000,
+			RuleType: nvapis.ValidatingDenyRuleType,
+			Criteria: []*nvapis.RESTAdmRuleCriterion{
+				{Name: handlers.RuleRunAsRoot, Op: "=", Value: "true"},
+				{
+					Name:      customrule.RuleCustom,
+					Type:      customrule.RuleCustom,
+					Op:        "containsAny",
+					Path:      "item.spec.containers[_].image",
+					Value:     "redis:latest",
+					ValueType: "string",
+				},
+			},
+		},
+	}
+
+	converter := NewRuleConverter(share.ConversionConfig{
+		Mode:            ModeProtect,
+		PolicyServer:    PolicyServer,
+		BackgroundAudit: BackgroundAudit,
+	})
+	result := converter.ConvertRules(context.Background(), rules)
+
+	// Without custom module registry, the whole rule is converted to Rego
+	require.Empty(t, result.Policies)
+	require.Equal(t, 1, result.RegoCount)
+	assert.Equal(t, share.MsgRegoPolicyGenerated, result.Summary[0].Notes)
+
+	converter = NewRuleConverter(share.ConversionConfig{
+		Mode:                 ModeProtect,
+		PolicyServer:         PolicyServer,
+		BackgroundAudit:      BackgroundAudit,
+		CustomModuleRegistry: "registry://ghcr.io/acme/policies",
+		CustomModuleVersion:  "v0.1.0",
+	})
+	result = converter.ConvertRules(context.Background(), rules)
+
+	require.Len(t, result.Policies, 1)
+	require.Equal(t, 1, result.RegoCount)
+	assert.Equal(t, SummaryStatusOK, result.Summary[0].Status)
+	assert.Equal(t, share.MsgMixedRulePolicyGenerated, result.Summary[0].Notes)
+
+	group, ok := result.Policies[0].(*policiesv1.ClusterAdmissionPolicyGroup)
+	require.True(t, ok)
+	require.Len(t, group.Spec.Policies, 2)
+	assert.Equal(t, handlers.PolicyContainerRunningAsUserURI, group.Spec.Policies["container_running_as_user"].Module)
+	assert.Equal(t, "registry://ghcr.io/acme/policies/nv-rule-1000:v0.1.0", group.Spec.Policies["nv_rule_1000"].Module)
+
+	// The Rego policy only enforces the custom criteria
+	regoCode, err := os.ReadFile(filepath.Join("rego_policies", "nv_rule_1000.rego"))
+	require.NoError(t, err)
+	assert.Contains(t, string(regoCode), "redis:latest")
+	assert.NotContains(t, string(regoCode), "runAsUser")
+}
+
+func TestConvertRules_RegoOutputWriter(t *testing.T) {
+	rules := []*nvapis.RESTAdmissionRule{
+		{
+			ID:       1000,
+			RuleType: nvapis.ValidatingDenyRuleType,
+			Criteria: []*nvapis.RESTAdmRuleCriterion{
+				{Name: handlers.RuleImageCompliance, Op: "=", Value: "true"},
+			},
+		},
+	}
+
+	t.Run("skipped Rego rules write no Rego artifact", func(t *testing.T) {
+		t.Chdir(t.TempDir())
+
+		converter := NewRuleConverter(share.ConversionConfig{SkipRego: true})
+
+		result := converter.ConvertRules(context.Background(), rules)
+		require.Zero(t, result.RegoCount)
+		assert.Equal(t, SummaryStatusSkipped, result.Summary[0].Status)
+		assert.Equal(t, share.MsgRegoPolicySkipped, result.Summary[0].Notes)
+		assert.NoDirExists(t, "rego_policies")
+	})
+
+	t.Run("scaffold layout in the Rego directory", func(t *testing.T) {
+		t.Chdir(t.TempDir())
+
+		converter := NewRuleConverter(share.ConversionConfig{
+			RegoDir:    "custom",
+			RegoLayout: customrule.LayoutScaffold,
+		})
+
+		result := converter.ConvertRules(context.Background(), rules)
+		require.Equal(t, 1, result.RegoCount)
+		for _, file := range []string{"policy.rego", "policy_test.rego", "metadata.yml", "Makefile"} {
+			assert.FileExists(t, filepath.Join("custom", "nv-rule-1000", file))
+		}
+		assert.NoDirExists(t, "rego_policies")
+	})
+}
+
+func TestConvertRules_RegoTests(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	rules := []*nvapis.RESTAdmissionRule{
+		{
+			ID:       1000,
+			RuleType: nvapis.ValidatingDenyRuleType,
+			Criteria: []*nvapis.RESTAdmRuleCriterion{
+				{
+					Name:      customrule.RuleCustom,
+					Type:      customrule.RuleCustom,
+					Op:        "containsAny",
+					Path:      "item.spec.containers[_].image",
+					Value:     "redis:*",
+					ValueType: "string",
+				},
+			},
+		},
+	}
+
+	converter := NewRuleConverter(share.ConversionConfig{RunRegoTests: true})
+	result := converter.ConvertRules(context.Background(), rules)
+
+	require.Equal(t, 1, result.RegoCount)
+	testCode, err := os.ReadFile(filepath.Join("rego_policies", "nv_rule_1000_test.rego"))
+	require.NoError(t, err)
+	assert.Contains(t, string(testCode), "test_criteria_0_deny")
+	assert.Contains(t, string(testCode), "test_criteria_0_allow")
+	assert.Equal(t, share.MsgRegoPolicyGenerated+", "+share.MsgRegoTestsPassed, result.Summary[0].Notes)
+
+	t.Run("broken policy", func(t *testing.T) {
+		regoCode, err := os.ReadFile(filepath.Join("rego_policies", "nv_rule_1000.rego"))
+		require.NoError(t, err)
+		// The policy denies with another message than the one expected by the deny case
+		brokenCode := strings.ReplaceAll(string(regoCode), "Denied by NeuVector rule #1000", "Denied")
+		require.NotEqual(t, string(regoCode), brokenCode)
+
+		notes := converter.runRegoTests(context.Background(), brokenCode, string(testCode))
+		assert.Equal(t, share.MsgRegoTestsFailed+": test_criteria_0_deny", notes)
+	})
+}
+
+func TestConvertRules_HandlerPlugins(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "team_label.yaml"), []byte(`criterion: teamLabel
+module: registry://ghcr.io/acme/policies/team-label:v1.0.0
+ops: [containsAny]
+polarity: rejectOnMatch
+settings: |
+  denied: {{ toJson .Values }}
+`), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "storage_class.yaml"), []byte(`criterion: storageClassName
+module: registry://ghcr.io/acme/policies/storage-class:v2.0.0
+ops: [containsAny]
+polarity: rejectOnMatch
+applicableResource: pvc
+settings: |
+  classes: {{ toJson .Values }}
+`), 0600))
+
+	rules := []*nvapis.RESTAdmissionRule{
+		{
+			ID:       1000,
+			RuleType: nvapis.ValidatingDenyRuleType,
+			Criteria: []*nvapis.RESTAdmRuleCriterion{{Name: "teamLabel", Op: "containsAny", Value: "alpha,beta"}},
+		},
+		{
+			ID:       1001,
+			RuleType: nvapis.ValidatingDenyRuleType,
+			Criteria: []*nvapis.RESTAdmRuleCriterion{
+				{Name: handlers.RuleStorageClass, Op: "containsAny", Value: "fast"},
+			},
+		},
+	}
+
+	converter := NewRuleConverter(share.ConversionConfig{Mode: ModeProtect, PolicyServer: PolicyServer})
+	result := converter.ConvertRules(context.Background(), rules)
+	assert.Equal(t, SummaryStatusSkipped, result.Summary[0].Status, "teamLabel has no handler without plugins")
+
+	converter = NewRuleConverter(share.ConversionConfig{Mode: ModeProtect, PolicyServer: PolicyServer})
+	require.NoError(t, converter.LoadHandlerPlugins(dir))
+	result = converter.ConvertRules(context.Background(), rules)
+	require.Len(t, result.Policies, 2)
+
+	teamPolicy, ok := result.Policies[0].(*policiesv1.ClusterAdmissionPolicy)
+	require.True(t, ok)
+	assert.Equal(t, "registry://ghcr.io/acme/policies/team-label:v1.0.0", teamPolicy.Spec.Module)
+	assert.JSONEq(t, `{"denied":["alpha","beta"]}`, string(teamPolicy.Spec.Settings.Raw))
+
+	storagePolicy, ok := result.Policies[1].(*policiesv1.ClusterAdmissionPolicy)
+	require.True(t, ok)
+	assert.Equal(t, "registry://ghcr.io/acme/policies/storage-class:v2.0.0", storagePolicy.Spec.Module)
+	assert.JSONEq(t, `{"classes":["fast"]}`, string(storagePolicy.Spec.Settings.Raw))
+	assert.Equal(t, []string{"persistentvolumeclaims"}, storagePolicy.Spec.Rules[0].Resources)
+}
+
+func TestConvertRules_InvalidSettings(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "storage_class.yaml"), []byte(`criterion: storageClassName
+module: registry://ghcr.io/kubewarden/policies/persistentvolumeclaim-storageclass-policy:v1.1.0
+ops: [containsAny]
+polarity: rejectOnMatch
+applicableResource: pvc
+settings: |
+  storageClasses: {{ toJson .Values }}
+`), 0600))
+
+	rules := []*nvapis.RESTAdmissionRule{
+		{
+			ID:       1000,
+			RuleType: nvapis.ValidatingDenyRuleType,
+			Criteria: []*nvapis.RESTAdmRuleCriterion{
+				{Name: handlers.RuleStorageClass, Op: "containsAny", Value: "fast"},
+			},
+		},
+	}
+
+	converter := NewRuleConverter(share.ConversionConfig{Mode: ModeProtect, PolicyServer: PolicyServer})
+	require.NoError(t, converter.LoadHandlerPlugins(dir))
+	result := converter.ConvertRules(context.Background(), rules)
+
+	assert.Empty(t, result.Policies)
+	require.Len(t, result.Summary, 1)
+	assert.Equal(t, SummaryStatusSkipped, result.Summary[0].Status)
+	assert.Contains(t, result.Summary[0].Notes, "rule 1000: invalid settings of module")
+	assert.Contains(t, result.Summary[0].Notes, "/: additionalProperties 'storageClasses' not allowed")
+}
+
+func TestConvertRules_ModuleOverrides(t *testing.T) {
+	rules := []*nvapis.RESTAdmissionRule{
+		{
+			ID:       1000,
+			RuleType: nvapis.ValidatingDenyRuleType,
+			Criteria: []*nvapis.RESTAdmRuleCriterion{{Name: handlers.RuleRunAsPrivileged, Op: "=", Value: "true"}},
+		},
+		{
+			ID:       1001,
+			RuleType: nvapis.ValidatingDenyRuleType,
+			Criteria: []*nvapis.RESTAdmRuleCriterion{{Name: handlers.RuleLabels, Op: "containsAny", Value: "team=a*"}},
+		},
+	}
+
+	converter := NewRuleConverter(share.ConversionConfig{Mode: ModeProtect, PolicyServer: PolicyServer})
+	require.NoError(t, converter.SetModuleOverrides(map[string]string{
+		"pod-privileged": "registry://ghcr.io/kubewarden/policies/pod-privileged:v1.0.2",
+		"cel-policy":     "registry://ghcr.io/kubewarden/policies/cel-policy:v1.2.0",
+	}))
+	result := converter.ConvertRules(context.Background(), rules)
+	require.Len(t, result.Policies, 2)
+
+	privilegedPolicy, ok := result.Policies[0].(*policiesv1.ClusterAdmissionPolicy)
+	require.True(t, ok)
+	assert.Equal(t, "registry://ghcr.io/kubewarden/policies/pod-privileged:v1.0.2", privilegedPolicy.Spec.Module)
+
+	labelsPolicy, ok := result.Policies[1].(*policiesv1.ClusterAdmissionPolicy)
+	require.True(t, ok)
+	assert.Equal(t, "registry://ghcr.io/kubewarden/policies/cel-policy:v1.2.0", labelsPolicy.Spec.Module)
+	assert.Contains(t, string(labelsPolicy.Spec.Settings.Raw), "validations")
+
+	converter = NewRuleConverter(share.ConversionConfig{})
+	require.ErrorContains(t, converter.SetModuleOverrides(map[string]string{
+		"pod-privileged": "registry://ghcr.io/kubewarden/policies/pod-privileged:v2.0.0",
+	}), "the versions with a settings schema are v1.x")
+	require.ErrorContains(t, converter.SetModuleOverrides(map[string]string{
+		"unknown-policy": "registry://ghcr.io/acme/unknown-policy:v1.0.0",
+	}), "no handler uses the module unknown-policy")
+}
+
+func TestConvertRules_RegistryMirrors(t *testing.T) {
+	rules := []*nvapis.RESTAdmissionRule{
+		{
+			ID:       1000,
+			RuleType: nvapis.ValidatingDenyRuleType,
+			Criteria: []*nvapis.RESTAdmRuleCriterion{{Name: handlers.RuleRunAsPrivileged, Op: "=", Value: "true"}},
+		},
+		{
+			ID:       1001,
+			RuleType: nvapis.ValidatingDenyRuleType,
+			Criteria: []*nvapis.RESTAdmRuleCriterion{
+				{Name: handlers.RuleRunAsPrivileged, Op: "=", Value: "true"},
+				{
+					Name:      customrule.RuleCustom,
+					Type:      customrule.RuleCustom,
+					Op:        "containsAny",
+					Path:      "item.spec.containers[_].image",
+					Value:     "redis:latest",
+					ValueType: "string",
+				},
+			},
+		},
+	}
+
+	converter := NewRuleConverter(share.ConversionConfig{
+		Mode:                 ModeProtect,
+		PolicyServer:         PolicyServer,
+		CustomModuleRegistry: "registry://ghcr.io/acme/policies",
+		CustomModuleVersion:  "v0.1.0",
+		RegistryMirrors:      map[string]string{"ghcr.io": "registry.internal:5000"},
+	})
+	result := converter.ConvertRules(context.Background(), rules)
+	require.Len(t, result.Policies, 2)
+
+	privilegedPolicy, ok := result.Policies[0].(*policiesv1.ClusterAdmissionPolicy)
+	require.True(t, ok)
+	assert.Equal(t, "registry://registry.internal:5000/kubewarden/policies/pod-privileged:v1.0.3",
+		privilegedPolicy.Spec.Module)
+
+	group, ok := result.Policies[1].(*policiesv1.ClusterAdmissionPolicyGroup)
+	require.True(t, ok)
+	assert.Equal(t, "registry://registry.internal:5000/kubewarden/policies/pod-privileged:v1.0.3",
+		group.Spec.Policies["pod_privileged"].Module)
+	assert.Equal(t, "registry://registry.internal:5000/acme/policies/nv-rule-1001:v0.1.0",
+		group.Spec.Policies["nv_rule_1001"].Module)
+
+	assert.Equal(t, []mirror.Module{
+		{
+			Source: handlers.PolicyPodPrivilegedURI,
+			Mirror: "registry://registry.internal:5000/kubewarden/policies/pod-privileged:v1.0.3",
+		},
+		{
+			Source: "registry://ghcr.io/acme/policies/nv-rule-1001:v0.1.0",
+			Mirror: "registry://registry.internal:5000/acme/policies/nv-rule-1001:v0.1.0",
+		},
+	}, result.Modules)
+	assert.Contains(t, mirror.PullScript(result.Modules), "kwctl push "+handlers.PolicyPodPrivilegedURI+
+		" registry://registry.internal:5000/kubewarden/policies/pod-privileged:v1.0.3")
+}
+
+func TestConvertRules_PolicyServerManifests(t *testing.T) {
+	rules := []*nvapis.RESTAdmissionRule{
+		{
+			ID:       1000,
+			RuleType: nvapis.ValidatingDenyRuleType,
+			Criteria: []*nvapis.RESTAdmRuleCriterion{{Name: handlers.RuleRunAsPrivileged, Op: "=", Value: "true"}},
+		},
+		{
+			ID:       1001,
+			RuleType: nvapis.ValidatingDenyRuleType,
+			Criteria: []*nvapis.RESTAdmRuleCriterion{{Name: handlers.RuleImageScanned, Op: "=", Value: "false"}},
+		},
+		{
+			ID:       1002,
+			RuleType: nvapis.ValidatingDenyRuleType,
+			Criteria: []*nvapis.RESTAdmRuleCriterion{
+				{Name: handlers.RuleHighRiskServiceAccount, Op: "containsTagAny", Value: "risky_role_view_secret"},
+			},
+		},
+	}
+
+	// Nothing is generated unless configured
+	result := NewRuleConverter(share.ConversionConfig{Mode: ModeProtect, PolicyServer: PolicyServer}).
+		ConvertRules(context.Background(), rules)
+	require.Len(t, result.Policies, 3)
+	assert.Empty(t, result.PolicyServerManifests)
+
+	converter := NewRuleConverter(share.ConversionConfig{
+		Mode:                  ModeProtect,
+		PolicyServer:          "neuvector",
+		VulReportNamespace:    "sbomscanner",
+		Platform:              "amd64",
+		PolicyServerManifests: &policyserver.Config{},
+	})
+	result = converter.ConvertRules(context.Background(), rules)
+	require.Len(t, result.Policies, 3)
+	require.Len(t, result.PolicyServerManifests, 4)
+
+	policyServer, ok := result.PolicyServerManifests[0].(*policiesv1.PolicyServer)
+	require.True(t, ok)
+	assert.Equal(t, "neuvector", policyServer.Name)
+
+	clusterRole, ok := result.PolicyServerManifests[2].(*rbacv1.ClusterRole)
+	require.True(t, ok)
+	assert.Equal(t, []rbacv1.PolicyRule{
+		{
+			APIGroups: []string{"storage.sbomscanner.kubewarden.io"},
+			Resources: []string{"vulnerabilityreports"},
+			Verbs:     []string{"get", "list", "watch"},
+		},
+		{
+			APIGroups: []string{"authorization.k8s.io"},
+			Resources: []string{"subjectaccessreviews"},
+			Verbs:     []string{"create"},
+		},
+	}, clusterRole.Rules)
+
+	serviceAccount, ok := result.PolicyServerManifests[1].(*corev1.ServiceAccount)
+	require.True(t, ok)
+	assert.Equal(t, "policy-server-neuvector", serviceAccount.Name)
+}
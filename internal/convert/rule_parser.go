@@ -1,6 +1,7 @@
 package convert
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -51,6 +52,20 @@ func (p *RuleParser) ParseRules() (*nvapis.RESTAdmissionRulesData, error) {
 	return p.parseJSONRules(fileData)
 }
 
+// ParseReader parses the rules read from the reader. Without a file name to tell the format, the rules
+// exported from the NeuVector UI are recognized as a JSON object, anything else is parsed as the YAML CRDs.
+func (p *RuleParser) ParseReader(reader io.Reader) (*nvapis.RESTAdmissionRulesData, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules: %w", err)
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return p.parseJSONRules(data)
+	}
+	return p.parseYAMLRules(data)
+}
+
 func (p *RuleParser) isYAMLFile() bool {
 	return strings.HasSuffix(p.filePath, ".yaml") || strings.HasSuffix(p.filePath, ".yml")
 }
@@ -1,6 +1,8 @@
 package convert
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	nvapis "github.com/neuvector/neuvector/controller/api"
@@ -53,3 +55,23 @@ func TestRuleParser(t *testing.T) {
 			"category", "cfg_type", "critical")
 	}
 }
+
+func TestRuleParser_ParseReader(t *testing.T) {
+	for _, path := range []string{
+		"../../test/fixtures/rule_parser/share_ipc_net_pid.yaml",
+		"../../test/fixtures/rule_parser/share_ipc_net_pid.json",
+	} {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			expectedRules, err := NewRuleParser(path).ParseRules()
+			require.NoError(t, err)
+
+			file, err := os.Open(path)
+			require.NoError(t, err)
+			defer file.Close()
+
+			rules, err := NewRuleParser("").ParseReader(file)
+			require.NoError(t, err)
+			require.Equal(t, expectedRules, rules)
+		})
+	}
+}
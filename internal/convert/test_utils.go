@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/output"
 	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/share"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -16,8 +17,9 @@ const (
 	PolicyServer    = "default"
 	BackgroundAudit = true
 
-	ExpectedPolicy = "policy.yaml"
-	OutputFile     = "output.yaml"
+	ExpectedPolicy     = "policy.yaml"
+	ExpectedRegoPolicy = "policy.rego"
+	OutputFile         = "output.yaml"
 )
 
 // VerifyWithYaml verifies the output policy with the expected policy.
@@ -32,6 +34,20 @@ func verifyWithYaml(t *testing.T, ruleDir string) {
 	assert.YAMLEq(t, string(expectedPolicy), string(actualPolicy))
 }
 
+// convertRuleFile converts the rules of the file, and writes their policies to the output file as the CLI does.
+func convertRuleFile(converter *RuleConverter, ruleFile string) error {
+	rules, err := NewRuleParser(ruleFile).ParseRules()
+	if err != nil {
+		return err
+	}
+
+	result := converter.ConvertRules(context.Background(), rules.Rules)
+	if len(result.Policies) == 0 {
+		return nil
+	}
+	return output.WriteObjects(&output.FileWriter{}, result.Policies, OutputFile)
+}
+
 func testRuleConversion(t *testing.T, ruleDir string) {
 	t.Helper()
 
@@ -39,19 +55,49 @@ func testRuleConversion(t *testing.T, ruleDir string) {
 		Mode:               ModeProtect,
 		PolicyServer:       PolicyServer,
 		BackgroundAudit:    BackgroundAudit,
-		OutputFile:         OutputFile,
 		VulReportNamespace: "default",
 		Platform:           "amd64",
 	})
 
-	rulePath := filepath.Join(ruleDir, "rule.json")
-	err := converter.Convert(context.Background(), rulePath)
+	err := convertRuleFile(converter, filepath.Join(ruleDir, "rule.json"))
 	require.NoError(t, err)
 	defer os.Remove(OutputFile)
 
 	verifyWithYaml(t, ruleDir)
 }
 
+// testRegoRuleConversion verifies the Rego policy generated for a rule with the expected Rego policy.
+func testRegoRuleConversion(t *testing.T, ruleDir string) {
+	t.Helper()
+
+	ruleDir, err := filepath.Abs(ruleDir)
+	require.NoError(t, err)
+	t.Chdir(t.TempDir())
+
+	converter := NewRuleConverter(share.ConversionConfig{
+		Mode:               ModeProtect,
+		PolicyServer:       PolicyServer,
+		BackgroundAudit:    BackgroundAudit,
+		VulReportNamespace: "default",
+		Platform:           "amd64",
+	})
+
+	err = convertRuleFile(converter, filepath.Join(ruleDir, "rule.json"))
+	require.NoError(t, err)
+
+	regoPolicies, err := filepath.Glob(filepath.Join("rego_policies", "*.rego"))
+	require.NoError(t, err)
+	require.Len(t, regoPolicies, 1)
+
+	expectedPolicy, err := os.ReadFile(filepath.Join(ruleDir, ExpectedRegoPolicy))
+	require.NoError(t, err)
+
+	actualPolicy, err := os.ReadFile(regoPolicies[0])
+	require.NoError(t, err)
+
+	assert.Equal(t, string(expectedPolicy), string(actualPolicy))
+}
+
 func testRuleConversionWithFail(t *testing.T, ruleDir string, mode string) {
 	t.Helper()
 
@@ -59,11 +105,9 @@ func testRuleConversionWithFail(t *testing.T, ruleDir string, mode string) {
 		Mode:            mode,
 		PolicyServer:    PolicyServer,
 		BackgroundAudit: BackgroundAudit,
-		OutputFile:      OutputFile,
 	})
 
-	rulePath := filepath.Join(ruleDir, "rule.json")
-	err := converter.Convert(context.Background(), rulePath)
+	err := convertRuleFile(converter, filepath.Join(ruleDir, "rule.json"))
 
 	require.Error(t, err)
 	require.NoFileExists(t, OutputFile)
@@ -20,8 +20,9 @@ type Policy interface {
 	runtime.Object
 }
 
-type summaryEntry struct {
-	id     uint32
-	status string
-	notes  string
+// SummaryEntry is the conversion result of a NeuVector rule.
+type SummaryEntry struct {
+	ID     uint32
+	Status string
+	Notes  string
 }
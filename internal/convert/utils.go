@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/share"
 	nvdata "github.com/neuvector/neuvector/share"
 )
 
@@ -46,18 +47,6 @@ func parseCommaSeparatedString(input string) []interface{} {
 	return result
 }
 
-func convertToRegexPattern(value string) string {
-	if !strings.ContainsAny(value, "?*") {
-		return fmt.Sprintf("^%s$", value)
-	}
-
-	cleanValue := strings.ReplaceAll(value, ".", "\\.")
-	cleanValue = strings.ReplaceAll(cleanValue, "?", ".")
-	cleanValue = strings.ReplaceAll(cleanValue, "*", ".*")
-
-	return fmt.Sprintf("^%s$", cleanValue)
-}
-
 func parseValuesToList(input string) (string, error) {
 	if strings.TrimSpace(input) == "" {
 		return "[]", nil
@@ -71,7 +60,7 @@ func parseValuesToList(input string) (string, error) {
 		if value == "" {
 			continue
 		}
-		result = append(result, convertToRegexPattern(value))
+		result = append(result, share.ConvertToRegexPattern(value))
 	}
 
 	jsonBytes, err := json.Marshal(result)
@@ -81,38 +70,3 @@ func parseValuesToList(input string) (string, error) {
 
 	return string(jsonBytes), nil
 }
-
-func parseValuesToMap(input string) (string, error) {
-	pairs := strings.Split(input, ",")
-	result := make(map[string]string)
-	maxSplitParts := 2
-
-	for _, pair := range pairs {
-		pair = strings.TrimSpace(pair)
-		if pair == "" {
-			continue
-		}
-
-		parts := strings.SplitN(pair, nvdata.CriteriaOpEqual, maxSplitParts)
-		key := strings.TrimSpace(parts[0])
-
-		if key == "" {
-			return "", fmt.Errorf("parseValuesToMap: empty key found in input: %q", pair)
-		}
-
-		if len(parts) == 1 {
-			// Only key present, treat as "key": ".*"
-			result[key] = ".*"
-		} else {
-			value := convertToRegexPattern(strings.TrimSpace(parts[1]))
-			result[key] = value
-		}
-	}
-
-	jsonBytes, err := json.Marshal(result)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal result to JSON: %w", err)
-	}
-
-	return string(jsonBytes), nil
-}
@@ -0,0 +1,121 @@
+package convert
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+
+	policiesv1 "github.com/kubewarden/adm-controller/api/policies/v1"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/handlers"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+const policiesAPIVersion = "policies.kubewarden.io/v1"
+
+// ValidatePolicySettings validates the settings of the policy, or of the policy group members, against the
+// settings schema of their module.
+func ValidatePolicySettings(policy Policy) error {
+	var errs []error
+	switch p := policy.(type) {
+	case *policiesv1.ClusterAdmissionPolicy:
+		errs = append(errs, validateSettings(p.Spec.Module, p.Spec.Settings))
+	case *policiesv1.AdmissionPolicy:
+		errs = append(errs, validateSettings(p.Spec.Module, p.Spec.Settings))
+	case *policiesv1.ClusterAdmissionPolicyGroup:
+		for _, name := range slices.Sorted(maps.Keys(p.Spec.Policies)) {
+			member := p.Spec.Policies[name]
+			errs = append(errs, validateSettings(member.Module, member.Settings))
+		}
+	case *policiesv1.AdmissionPolicyGroup:
+		for _, name := range slices.Sorted(maps.Keys(p.Spec.Policies)) {
+			member := p.Spec.Policies[name]
+			errs = append(errs, validateSettings(member.Module, member.Settings))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func validateSettings(module string, settings runtime.RawExtension) error {
+	return handlers.ValidateSettings(module, settings.Raw)
+}
+
+// ValidatePolicies validates the settings of the policies of a YAML stream, such as the policies file
+// generated by the conversion. It returns the number of policies validated, the documents of other kinds
+// are ignored. The errors of the invalid policies are reported with the policy name.
+func ValidatePolicies(reader io.Reader) (int, error) {
+	yamlReader := utilyaml.NewYAMLReader(bufio.NewReader(reader))
+
+	var (
+		count int
+		errs  []error
+	)
+	for {
+		document, err := yamlReader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return count, fmt.Errorf("failed to read policies: %w", err)
+		}
+
+		policy, ok, err := decodePolicy(document)
+		if err != nil {
+			return count, err
+		}
+		if !ok {
+			continue
+		}
+
+		count++
+		if err = ValidatePolicySettings(policy); err != nil {
+			errs = append(errs, fmt.Errorf("policy %s: %w", policyName(policy), err))
+		}
+	}
+	return count, errors.Join(errs...)
+}
+
+// decodePolicy decodes the Kubewarden policy of the YAML document, if it's a policy.
+func decodePolicy(document []byte) (Policy, bool, error) {
+	var typeMeta struct {
+		APIVersion string `json:"apiVersion"`
+		Kind       string `json:"kind"`
+	}
+	if err := yaml.Unmarshal(document, &typeMeta); err != nil {
+		return nil, false, fmt.Errorf("failed to decode policy: %w", err)
+	}
+	if typeMeta.APIVersion != policiesAPIVersion {
+		return nil, false, nil
+	}
+
+	var policy Policy
+	switch typeMeta.Kind {
+	case "ClusterAdmissionPolicy":
+		policy = &policiesv1.ClusterAdmissionPolicy{}
+	case "AdmissionPolicy":
+		policy = &policiesv1.AdmissionPolicy{}
+	case "ClusterAdmissionPolicyGroup":
+		policy = &policiesv1.ClusterAdmissionPolicyGroup{}
+	case "AdmissionPolicyGroup":
+		policy = &policiesv1.AdmissionPolicyGroup{}
+	default:
+		return nil, false, nil
+	}
+
+	if err := yaml.Unmarshal(document, policy); err != nil {
+		return nil, false, fmt.Errorf("failed to decode %s: %w", typeMeta.Kind, err)
+	}
+	return policy, true, nil
+}
+
+func policyName(policy Policy) string {
+	if object, ok := policy.(metav1.Object); ok {
+		return object.GetName()
+	}
+	return ""
+}
@@ -0,0 +1,92 @@
+package convert
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidatePolicies_ConvertedPolicies(t *testing.T) {
+	var policies bytes.Buffer
+	err := filepath.WalkDir("../../test/rules", func(path string, _ os.DirEntry, err error) error {
+		if err != nil || filepath.Ext(path) != ".yaml" || !strings.HasPrefix(filepath.Base(path), "policy") {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		policies.WriteString("---\n")
+		policies.Write(data)
+		policies.WriteString("\n")
+		return nil
+	})
+	require.NoError(t, err)
+
+	count, err := ValidatePolicies(&policies)
+	require.NoError(t, err)
+	assert.Positive(t, count)
+}
+
+func TestValidatePolicies_InvalidSettings(t *testing.T) {
+	policies := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: not-a-policy
+---
+apiVersion: policies.kubewarden.io/v1
+kind: ClusterAdmissionPolicy
+metadata:
+  name: neuvector-rule-1000-conversion
+spec:
+  module: registry://ghcr.io/kubewarden/policies/trusted-repos:v2.0.1
+  settings:
+    images:
+      reject: nginx
+---
+apiVersion: policies.kubewarden.io/v1
+kind: ClusterAdmissionPolicyGroup
+metadata:
+  name: neuvector-rule-1001-conversion
+spec:
+  expression: pod_privileged() && host_namespaces_psp()
+  message: denied
+  policies:
+    pod_privileged:
+      module: registry://ghcr.io/kubewarden/policies/pod-privileged:v1.0.3
+      settings: {}
+    host_namespaces_psp:
+      module: registry://ghcr.io/kubewarden/policies/host-namespaces-psp:v1.1.0
+      settings:
+        allow_host_ipc: "false"
+---
+apiVersion: policies.kubewarden.io/v1
+kind: AdmissionPolicy
+metadata:
+  name: team-label
+  namespace: default
+spec:
+  module: registry://ghcr.io/acme/policies/team-label:v1.0.0
+  settings:
+    anything: true
+`
+
+	count, err := ValidatePolicies(strings.NewReader(policies))
+	assert.Equal(t, 3, count)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "policy neuvector-rule-1000-conversion: invalid settings of module "+
+		"registry://ghcr.io/kubewarden/policies/trusted-repos:v2.0.1: /images/reject: expected array, but got string")
+	assert.ErrorContains(t, err, "policy neuvector-rule-1001-conversion: invalid settings of module "+
+		"registry://ghcr.io/kubewarden/policies/host-namespaces-psp:v1.1.0: /allow_host_ipc: expected boolean")
+	assert.NotContains(t, err.Error(), "team-label")
+}
+
+func TestValidatePolicies_InvalidYAML(t *testing.T) {
+	_, err := ValidatePolicies(strings.NewReader("apiVersion: policies.kubewarden.io/v1\nkind: [\n"))
+	require.ErrorContains(t, err, "failed to decode policy")
+}
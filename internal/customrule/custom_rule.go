@@ -3,8 +3,6 @@ package customrule
 import (
 	"encoding/json"
 	"fmt"
-	"os"
-	"path/filepath"
 
 	nvapis "github.com/neuvector/neuvector/controller/api"
 	"github.com/neuvector/neuvector/controller/opa"
@@ -13,7 +11,7 @@ import (
 
 const (
 	RuleCustom        = "customPath"
-	RegoDir           = "rego_policies"
+	DefaultRegoDir    = "rego_policies"
 	KubewardenPackage = "package kubernetes.admission"
 )
 
@@ -89,11 +87,11 @@ func convertToCLUSAdmissionRule(
 	}, nil
 }
 
-// BuildRegoPolicy generates a Kubewarden-compatible Rego policy from a NeuVector admission rule.
-func BuildRegoPolicy(rule *nvapis.RESTAdmissionRule) error {
+// GenerateRegoPolicy generates a Kubewarden-compatible Rego policy from a NeuVector admission rule.
+func GenerateRegoPolicy(rule *nvapis.RESTAdmissionRule) (string, error) {
 	clusRule, err := convertToCLUSAdmissionRule(rule)
 	if err != nil {
-		return fmt.Errorf("failed to convert rule to CLUSAdmissionRule: %w", err)
+		return "", fmt.Errorf("failed to convert rule to CLUSAdmissionRule: %w", err)
 	}
 
 	options := &opa.RegoConversionOptions{
@@ -103,17 +101,8 @@ func BuildRegoPolicy(rule *nvapis.RESTAdmissionRule) error {
 
 	regoCode, err := opa.GenerateRegoCode(clusRule, options)
 	if err != nil {
-		return fmt.Errorf("failed to generate rego code: %w", err)
+		return "", fmt.Errorf("failed to generate rego code: %w", err)
 	}
 
-	if err = os.MkdirAll(RegoDir, 0750); err != nil {
-		return fmt.Errorf("failed to create Rego directory: %w", err)
-	}
-
-	regoPolicyPath := filepath.Join(RegoDir, fmt.Sprintf("nv_rule_%d.rego", rule.ID))
-	if err = os.WriteFile(regoPolicyPath, []byte(regoCode), 0600); err != nil {
-		return fmt.Errorf("failed to write rego code: %w", err)
-	}
-
-	return nil
+	return regoCode, nil
 }
@@ -0,0 +1,90 @@
+package customrule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/compile"
+	"github.com/open-policy-agent/opa/v1/storage/inmem"
+	"github.com/open-policy-agent/opa/v1/tester"
+)
+
+// compileRegoToWasm compiles the Rego modules to a Wasm module with the OPA compiler.
+// The generated policies use the Rego v0 syntax.
+func compileRegoToWasm(ctx context.Context, modules map[string]string) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "nvrules2kw-rego-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, module := range modules {
+		modulePath := filepath.Join(dir, name)
+		if err = os.MkdirAll(filepath.Dir(modulePath), 0750); err != nil {
+			return nil, fmt.Errorf("failed to create rego module directory: %w", err)
+		}
+		if err = os.WriteFile(modulePath, []byte(module), 0600); err != nil {
+			return nil, fmt.Errorf("failed to write rego module %s: %w", name, err)
+		}
+	}
+
+	compiler := compile.New().
+		WithTarget(compile.TargetWasm).
+		WithEntrypoints(regoEntrypoint).
+		WithRegoVersion(ast.RegoV0).
+		WithPaths(dir).
+		WithOutput(io.Discard)
+	if err = compiler.Build(ctx); err != nil {
+		return nil, err
+	}
+
+	wasmModules := compiler.Bundle().WasmModules
+	if len(wasmModules) == 0 {
+		return nil, errors.New("no wasm module generated")
+	}
+	return wasmModules[0].Raw, nil
+}
+
+// runRegoTests runs the tests of the Rego modules with the OPA tester.
+// The generated policies use the Rego v0 syntax.
+func runRegoTests(ctx context.Context, sources map[string]string) (RegoTestResult, error) {
+	modules := make(map[string]*ast.Module, len(sources))
+	for name, source := range sources {
+		module, err := ast.ParseModuleWithOpts(name, source, ast.ParserOptions{RegoVersion: ast.RegoV0})
+		if err != nil {
+			return RegoTestResult{}, fmt.Errorf("failed to parse rego module %s: %w", name, err)
+		}
+		modules[name] = module
+	}
+
+	store := inmem.New()
+	txn, err := store.NewTransaction(ctx)
+	if err != nil {
+		return RegoTestResult{}, fmt.Errorf("failed to open rego store transaction: %w", err)
+	}
+	defer store.Abort(ctx, txn)
+
+	results, err := tester.NewRunner().
+		SetCompiler(ast.NewCompiler()).
+		SetStore(store).
+		SetModules(modules).
+		RunTests(ctx, txn)
+	if err != nil {
+		return RegoTestResult{}, fmt.Errorf("failed to run rego tests: %w", err)
+	}
+
+	var result RegoTestResult
+	for testResult := range results {
+		if testResult.Fail || testResult.Error != nil {
+			result.Failed = append(result.Failed, testResult.Name)
+			continue
+		}
+		result.Passed = append(result.Passed, testResult.Name)
+	}
+	return result, nil
+}
@@ -0,0 +1,268 @@
+package customrule
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/share"
+	nvapis "github.com/neuvector/neuvector/controller/api"
+	nvshare "github.com/neuvector/neuvector/share"
+)
+
+const (
+	// regoTestImage is the image of the test containers, the sidecar containers are ignored by the policies.
+	regoTestImage = "registry.example.com/nvrules2kw/test:latest"
+
+	// regoTestNoMatch is the value of the test cases not matching the criterion values.
+	regoTestNoMatch = "nvrules2kw-no-match"
+
+	// regoTestPresent is the value of the test cases checking the existence of the criterion path.
+	regoTestPresent = "nvrules2kw"
+)
+
+// regoTestCase is an allow or deny test case of a custom criterion.
+type regoTestCase struct {
+	name   string
+	deny   bool
+	object map[string]any
+}
+
+// GenerateRegoTests generates the Rego unit tests of the custom criteria of the rule, to be run with opa test.
+// Every criterion gets a deny case, whose object matches the criterion, and an allow case, whose object doesn't.
+// The cases are synthesized from the criterion path, operator and value, they check the deny message of the
+// criterion, so the other criteria of the rule don't interfere. It returns an empty string if no case can be
+// synthesized.
+func GenerateRegoTests(rule *nvapis.RESTAdmissionRule) (string, error) {
+	var tests []string
+	for idx, criterion := range rule.Criteria {
+		if criterion.Type != RuleCustom {
+			continue
+		}
+
+		msg := fmt.Sprintf("Denied by NeuVector rule #%d: [%s %s %s]",
+			rule.ID, criterion.Path, criterion.Op, criterion.Value)
+		for _, testCase := range regoTestCases(idx, criterion) {
+			input, err := json.Marshal(map[string]any{
+				"request": map[string]any{
+					"uid":    "nvrules2kw-test",
+					"kind":   map[string]any{"kind": "Pod"},
+					"object": testCase.object,
+				},
+			})
+			if err != nil {
+				return "", fmt.Errorf("failed to marshal rego test input: %w", err)
+			}
+
+			negation := "not "
+			if testCase.deny {
+				negation = ""
+			}
+			tests = append(tests, fmt.Sprintf("%s {\n\t%sadmission.deny[%q] with input as %s\n}\n",
+				testCase.name, negation, msg, input))
+		}
+	}
+
+	if len(tests) == 0 {
+		return "", nil
+	}
+
+	return fmt.Sprintf("package kubernetes.admission_test\n\n"+
+		"# Generated from NeuVector admission rule #%d.\n\n"+
+		"import data.kubernetes.admission\n\n%s", rule.ID, strings.Join(tests, "\n")), nil
+}
+
+// regoTestCases synthesizes the test cases of a custom criterion, the cases which can't be synthesized are skipped.
+func regoTestCases(idx int, criterion *nvapis.RESTAdmRuleCriterion) []regoTestCase {
+	path, ok := strings.CutPrefix(criterion.Path, "item.")
+	if !ok || !strings.Contains(path, ".") {
+		return nil
+	}
+	segments := strings.Split(path, ".")
+	isArray := strings.HasSuffix(segments[len(segments)-1], "[_]")
+
+	var denyValue, allowValue any
+	var denyOK, allowOK bool
+	switch {
+	case criterion.Op == nvshare.CriteriaOpExist:
+		return []regoTestCase{
+			{name: fmt.Sprintf("test_criteria_%d_deny", idx), deny: true,
+				object: regoTestObject(segments, regoTestValue(regoTestPresent, isArray), true)},
+			{name: fmt.Sprintf("test_criteria_%d_allow", idx),
+				object: regoTestObject(segments, nil, false)},
+		}
+	case criterion.Op == nvshare.CriteriaOpNotExist:
+		return []regoTestCase{
+			{name: fmt.Sprintf("test_criteria_%d_deny", idx), deny: true,
+				object: regoTestObject(segments, nil, false)},
+			{name: fmt.Sprintf("test_criteria_%d_allow", idx),
+				object: regoTestObject(segments, regoTestValue(regoTestPresent, isArray), true)},
+		}
+	case criterion.ValueType == "string":
+		denyValue, denyOK, allowValue, allowOK = regoStringTestValues(criterion, isArray)
+	case criterion.ValueType == "number":
+		denyValue, denyOK, allowValue, allowOK = regoNumberTestValues(criterion)
+	case criterion.ValueType == "boolean":
+		value, err := strconv.ParseBool(criterion.Value)
+		if err == nil && criterion.Op == nvshare.CriteriaOpEqual {
+			denyValue, denyOK, allowValue, allowOK = value, true, !value, true
+		}
+	}
+
+	var cases []regoTestCase
+	if denyOK {
+		cases = append(cases, regoTestCase{name: fmt.Sprintf("test_criteria_%d_deny", idx), deny: true,
+			object: regoTestObject(segments, denyValue, true)})
+	}
+	if allowOK {
+		cases = append(cases, regoTestCase{name: fmt.Sprintf("test_criteria_%d_allow", idx),
+			object: regoTestObject(segments, allowValue, true)})
+	}
+	return cases
+}
+
+// regoStringTestValues returns the values of the string criterion test cases. The sample of a value replaces
+// its wildcards, a case is skipped when its value is matched by an unexpected number of patterns.
+func regoStringTestValues(
+	criterion *nvapis.RESTAdmRuleCriterion,
+	isArray bool,
+) (any, bool, any, bool) {
+	var (
+		patterns []*regexp.Regexp
+		samples  []string
+	)
+	sampler := strings.NewReplacer("*", "", "?", "x")
+	for _, value := range strings.Split(criterion.Value, ",") {
+		value = strings.TrimSpace(value)
+		pattern, err := regexp.Compile(share.ConvertToRegexPattern(value))
+		if err != nil {
+			return nil, false, nil, false
+		}
+		patterns = append(patterns, pattern)
+		samples = append(samples, sampler.Replace(value))
+	}
+
+	// matchCount returns the number of patterns matching the value, the operators count the matches
+	matchCount := func(value string) int {
+		count := 0
+		for _, pattern := range patterns {
+			if pattern.MatchString(value) {
+				count++
+			}
+		}
+		return count
+	}
+	matchOK := matchCount(samples[0]) == 1
+	noMatchOK := matchCount(regoTestNoMatch) == 0
+
+	switch criterion.Op {
+	case nvshare.CriteriaOpContainsAny:
+		return regoTestValue(samples[0], isArray), matchOK, regoTestValue(regoTestNoMatch, isArray), noMatchOK
+	case nvshare.CriteriaOpContainsAll:
+		// A single value can only contain all the values if they're the same
+		if !isArray {
+			return samples[0], matchOK && len(samples) == 1, regoTestNoMatch, noMatchOK
+		}
+		items := make([]any, 0, len(samples))
+		allOK := true
+		for _, sample := range samples {
+			items = append(items, sample)
+			allOK = allOK && matchCount(sample) == 1
+		}
+		return items, allOK, []any{regoTestNoMatch}, noMatchOK
+	case nvshare.CriteriaOpNotContainsAny, nvshare.CriteriaOpContainsOtherThan:
+		return regoTestValue(regoTestNoMatch, isArray), noMatchOK, regoTestValue(samples[0], isArray), matchOK
+	default:
+		return nil, false, nil, false
+	}
+}
+
+// regoNumberTestValues returns the values of the number criterion test cases.
+func regoNumberTestValues(criterion *nvapis.RESTAdmRuleCriterion) (any, bool, any, bool) {
+	value, err := strconv.ParseFloat(strings.TrimSpace(criterion.Value), 64)
+	if err != nil {
+		return nil, false, nil, false
+	}
+
+	switch criterion.Op {
+	case nvshare.CriteriaOpEqual, nvshare.CriteriaOpBiggerEqualThan, nvshare.CriteriaOpLessEqualThan:
+		allowValue := value + 1
+		if criterion.Op == nvshare.CriteriaOpBiggerEqualThan {
+			allowValue = value - 1
+		}
+		return value, true, allowValue, true
+	case nvshare.CriteriaOpNotEqual, nvshare.CriteriaOpBiggerThan:
+		return value + 1, true, value, true
+	default:
+		return nil, false, nil, false
+	}
+}
+
+func regoTestValue(value string, isArray bool) any {
+	if isArray {
+		return []any{value}
+	}
+	return value
+}
+
+// regoTestObject builds the Pod object of a test case, with the value at the criterion path when present,
+// otherwise without the last path key.
+func regoTestObject(segments []string, value any, present bool) map[string]any {
+	object := regoTestPath(segments, value, present)
+	metadata, ok := object["metadata"].(map[string]any)
+	if !ok {
+		metadata = map[string]any{}
+		object["metadata"] = metadata
+	}
+	// The name is left as is when the criterion is about the name itself
+	if strings.Join(segments, ".") != "metadata.name" {
+		if _, ok = metadata["name"]; !ok {
+			metadata["name"] = "nvrules2kw-test"
+		}
+	}
+	return object
+}
+
+func regoTestPath(segments []string, value any, present bool) map[string]any {
+	object := map[string]any{}
+	key, isArray := strings.CutSuffix(segments[0], "[_]")
+	if len(segments) == 1 {
+		if present {
+			object[key] = value
+		}
+		return object
+	}
+
+	child := regoTestPath(segments[1:], value, present)
+	if !isArray {
+		object[key] = child
+		return object
+	}
+
+	// The policies only check the containers with an image, unless the criterion is about the image itself
+	isImagePath := len(segments) == 2 && strings.TrimSuffix(segments[1], "[_]") == "image"
+	if strings.HasSuffix(strings.ToLower(key), "containers") && !isImagePath {
+		if _, ok := child["image"]; !ok {
+			child["image"] = regoTestImage
+		}
+	}
+	object[key] = []any{child}
+	return object
+}
+
+// RegoTestResult is the result of the Rego unit tests of a rule.
+type RegoTestResult struct {
+	Passed []string
+	Failed []string
+}
+
+// RunRegoTests runs the Rego unit tests against the Rego policy in-process with the OPA library.
+func RunRegoTests(ctx context.Context, regoCode string, testCode string) (RegoTestResult, error) {
+	return runRegoTests(ctx, map[string]string{
+		"policy.rego":      regoCode,
+		"policy_test.rego": testCode,
+	})
+}
@@ -0,0 +1,131 @@
+package customrule
+
+import (
+	"testing"
+
+	nvapis "github.com/neuvector/neuvector/controller/api"
+	nvshare "github.com/neuvector/neuvector/share"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateRegoTests(t *testing.T) {
+	tests := []struct {
+		name      string
+		criterion *nvapis.RESTAdmRuleCriterion
+		expected  []string
+		absent    []string
+	}{
+		{
+			name: "string value of a container path",
+			criterion: &nvapis.RESTAdmRuleCriterion{
+				Path:      "item.spec.containers[_].name",
+				Op:        nvshare.CriteriaOpContainsAny,
+				Value:     "nginx*",
+				ValueType: "string",
+			},
+			expected: []string{
+				`test_criteria_0_deny {
+	admission.deny["Denied by NeuVector rule #1000: [item.spec.containers[_].name containsAny nginx*]"] ` +
+					`with input as {"request":{"kind":{"kind":"Pod"},"object":{"metadata":{"name":"nvrules2kw-test"},` +
+					`"spec":{"containers":[{"image":"registry.example.com/nvrules2kw/test:latest","name":"nginx"}]}},` +
+					`"uid":"nvrules2kw-test"}}
+}`,
+				`test_criteria_0_allow {
+	not admission.deny["Denied by NeuVector rule #1000: [item.spec.containers[_].name containsAny nginx*]"] ` +
+					`with input as {"request":{"kind":{"kind":"Pod"},"object":{"metadata":{"name":"nvrules2kw-test"},` +
+					`"spec":{"containers":[{"image":"registry.example.com/nvrules2kw/test:latest",` +
+					`"name":"nvrules2kw-no-match"}]}},"uid":"nvrules2kw-test"}}
+}`,
+			},
+		},
+		{
+			name: "number value",
+			criterion: &nvapis.RESTAdmRuleCriterion{
+				Path:      "item.spec.replicas",
+				Op:        nvshare.CriteriaOpBiggerThan,
+				Value:     "3",
+				ValueType: "number",
+			},
+			expected: []string{`"spec":{"replicas":4}`, `"spec":{"replicas":3}`},
+		},
+		{
+			name: "boolean value",
+			criterion: &nvapis.RESTAdmRuleCriterion{
+				Path:      "item.spec.hostNetwork",
+				Op:        nvshare.CriteriaOpEqual,
+				Value:     "true",
+				ValueType: "boolean",
+			},
+			expected: []string{`"spec":{"hostNetwork":true}`, `"spec":{"hostNetwork":false}`},
+		},
+		{
+			name: "existence of a label",
+			criterion: &nvapis.RESTAdmRuleCriterion{
+				Path:      "item.metadata.labels.team",
+				Op:        nvshare.CriteriaOpExist,
+				ValueType: "string",
+			},
+			expected: []string{
+				`"metadata":{"labels":{"team":"nvrules2kw"},"name":"nvrules2kw-test"}`,
+				`"metadata":{"labels":{},"name":"nvrules2kw-test"}`,
+			},
+		},
+		{
+			name: "literal dots of the values",
+			criterion: &nvapis.RESTAdmRuleCriterion{
+				Path:      "item.spec.finalizers[_]",
+				Op:        nvshare.CriteriaOpContainsAll,
+				Value:     "a.c,abc",
+				ValueType: "string",
+			},
+			expected: []string{`"spec":{"finalizers":["a.c","abc"]}`, "test_criteria_0_allow"},
+		},
+		{
+			name: "deny case skipped when the values can't be contained by a single value",
+			criterion: &nvapis.RESTAdmRuleCriterion{
+				Path:      "item.metadata.name",
+				Op:        nvshare.CriteriaOpContainsAll,
+				Value:     "a,b",
+				ValueType: "string",
+			},
+			expected: []string{"test_criteria_0_allow"},
+			absent:   []string{"test_criteria_0_deny"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.criterion.Name = RuleCustom
+			tt.criterion.Type = RuleCustom
+			rule := &nvapis.RESTAdmissionRule{
+				ID:       1000,
+				Criteria: []*nvapis.RESTAdmRuleCriterion{tt.criterion},
+			}
+
+			testCode, err := GenerateRegoTests(rule)
+			require.NoError(t, err)
+			assert.Contains(t, testCode, "package kubernetes.admission_test")
+			assert.Contains(t, testCode, "import data.kubernetes.admission")
+			for _, expected := range tt.expected {
+				assert.Contains(t, testCode, expected)
+			}
+			for _, absent := range tt.absent {
+				assert.NotContains(t, testCode, absent)
+			}
+		})
+	}
+}
+
+func TestGenerateRegoTests_NoCustomCriteria(t *testing.T) {
+	rule := &nvapis.RESTAdmissionRule{
+		ID: 1000,
+		Criteria: []*nvapis.RESTAdmRuleCriterion{
+			{Name: "namespace", Op: nvshare.CriteriaOpContainsAny, Value: "default"},
+		},
+	}
+
+	testCode, err := GenerateRegoTests(rule)
+	require.NoError(t, err)
+	assert.Empty(t, testCode)
+}
@@ -0,0 +1,164 @@
+package customrule
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/output"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// LayoutFlat writes the Rego policy of every rule in the Rego directory, as nv_rule_<id>.rego,
+	// and its unit tests as nv_rule_<id>_test.rego.
+	LayoutFlat = "flat"
+
+	// LayoutScaffold writes an opa-policy-template project per rule in the Rego directory, under nv-rule-<id>/.
+	// The project holds the policy, its metadata, a Makefile and the test files, so it can be built with make.
+	LayoutScaffold = "scaffold"
+)
+
+// scaffoldMakefile builds and annotates the policy, it's the Makefile of the opa-policy-template repository
+// without the release targets. The generated policies use the Rego v0 syntax.
+const scaffoldMakefile = `SOURCE_FILES := $(shell find . -type f -name '*.rego')
+
+policy.wasm: $(SOURCE_FILES)
+	opa build --v0-compatible -t wasm -e policy/main -o bundle.tar.gz policy.rego utility/policy.rego
+	tar xvf bundle.tar.gz /policy.wasm
+	rm bundle.tar.gz
+	touch policy.wasm # opa creates the bundle with unix epoch timestamp, fix it
+
+annotated-policy.wasm: policy.wasm metadata.yml
+	kwctl annotate -m metadata.yml -o annotated-policy.wasm policy.wasm
+
+.PHONY: test
+test:
+	opa test --v0-compatible .
+
+.PHONY: clean
+clean:
+	rm -f *.wasm *.tar.gz
+`
+
+// scaffoldTest checks the policy entrypoint answers with an AdmissionReview, whatever the rule criteria.
+const scaffoldTest = `package policy_test
+
+import data.policy
+
+test_main_returns_admission_review {
+	review := policy.main with input as {"request": {
+		"uid": "nvrules2kw-test",
+		"kind": {"kind": "Pod"},
+		"object": {"metadata": {"name": "test"}, "spec": {"containers": []}},
+	}}
+	review.kind == "AdmissionReview"
+	review.response.uid == "nvrules2kw-test"
+}
+`
+
+// RegoWriter writes the Rego policies generated for the NeuVector admission rules with the conversion writer.
+type RegoWriter struct {
+	writer output.Writer
+	dir    string
+	layout string
+}
+
+// NewRegoWriter returns a writer of the Rego policies in the directory, the default directory and the flat
+// layout are used when they're empty.
+func NewRegoWriter(writer output.Writer, dir string, layout string) *RegoWriter {
+	if dir == "" {
+		dir = DefaultRegoDir
+	}
+	if layout == "" {
+		layout = LayoutFlat
+	}
+
+	return &RegoWriter{
+		writer: writer,
+		dir:    dir,
+		layout: layout,
+	}
+}
+
+// Dir returns the directory of the Rego policies.
+func (w *RegoWriter) Dir() string {
+	return w.dir
+}
+
+// PolicyPath returns the path of the Rego policy of the rule.
+func (w *RegoWriter) PolicyPath(ruleID uint32) string {
+	if w.layout == LayoutScaffold {
+		return filepath.Join(w.projectDir(ruleID), "policy.rego")
+	}
+	return filepath.Join(w.dir, fmt.Sprintf("nv_rule_%d.rego", ruleID))
+}
+
+// WasmPath returns the path of the annotated Wasm module of the rule.
+func (w *RegoWriter) WasmPath(ruleID uint32) string {
+	if w.layout == LayoutScaffold {
+		return filepath.Join(w.projectDir(ruleID), "annotated-policy.wasm")
+	}
+	return filepath.Join(w.dir, fmt.Sprintf("nv_rule_%d.wasm", ruleID))
+}
+
+// TestPath returns the path of the Rego unit tests of the rule.
+func (w *RegoWriter) TestPath(ruleID uint32) string {
+	if w.layout == LayoutScaffold {
+		return filepath.Join(w.projectDir(ruleID), "criteria_test.rego")
+	}
+	return filepath.Join(w.dir, fmt.Sprintf("nv_rule_%d_test.rego", ruleID))
+}
+
+func (w *RegoWriter) projectDir(ruleID uint32) string {
+	return filepath.Join(w.dir, fmt.Sprintf("nv-rule-%d", ruleID))
+}
+
+// WritePolicy writes the Rego policy of the rule. With the scaffold layout, the files of the
+// opa-policy-template project are written next to it.
+func (w *RegoWriter) WritePolicy(ruleID uint32, regoCode string, metadata Metadata) error {
+	if err := w.writer.WriteFile(w.PolicyPath(ruleID), []byte(regoCode)); err != nil {
+		return fmt.Errorf("failed to write rego code: %w", err)
+	}
+
+	if w.layout != LayoutScaffold {
+		return nil
+	}
+
+	metadataYAML, err := yaml.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal policy metadata: %w", err)
+	}
+
+	projectDir := w.projectDir(ruleID)
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{name: "metadata.yml", data: metadataYAML},
+		{name: "Makefile", data: []byte(scaffoldMakefile)},
+		{name: "policy_test.rego", data: []byte(scaffoldTest)},
+		{name: filepath.Join("utility", "policy.rego"), data: []byte(kubewardenRegoUtility)},
+	}
+	for _, file := range files {
+		if err = w.writer.WriteFile(filepath.Join(projectDir, file.name), file.data); err != nil {
+			return fmt.Errorf("failed to write %s: %w", file.name, err)
+		}
+	}
+	return nil
+}
+
+// WriteTests writes the Rego unit tests of the rule.
+func (w *RegoWriter) WriteTests(ruleID uint32, testCode string) error {
+	if err := w.writer.WriteFile(w.TestPath(ruleID), []byte(testCode)); err != nil {
+		return fmt.Errorf("failed to write rego tests: %w", err)
+	}
+	return nil
+}
+
+// WriteWasm writes the annotated Wasm module of the rule.
+func (w *RegoWriter) WriteWasm(ruleID uint32, wasmModule []byte) error {
+	if err := w.writer.WriteFile(w.WasmPath(ruleID), wasmModule); err != nil {
+		return fmt.Errorf("failed to write wasm module: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package customrule
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/yaml"
+)
+
+// recordingWriter records the files written by the Rego writer.
+type recordingWriter struct {
+	files map[string][]byte
+}
+
+func (w *recordingWriter) WriteFile(path string, data []byte) error {
+	w.files[path] = data
+	return nil
+}
+
+func TestRegoWriter_FlatLayout(t *testing.T) {
+	writer := &recordingWriter{files: map[string][]byte{}}
+	regoWriter := NewRegoWriter(writer, "", "")
+
+	require.NoError(t, regoWriter.WritePolicy(1000, KubewardenPackage, NewMetadata(1000, nil, nil)))
+	require.NoError(t, regoWriter.WriteTests(1000, "package kubernetes.admission_test"))
+	require.NoError(t, regoWriter.WriteWasm(1000, []byte("wasm")))
+
+	require.Equal(t, map[string][]byte{
+		filepath.Join(DefaultRegoDir, "nv_rule_1000.rego"):      []byte(KubewardenPackage),
+		filepath.Join(DefaultRegoDir, "nv_rule_1000_test.rego"): []byte("package kubernetes.admission_test"),
+		filepath.Join(DefaultRegoDir, "nv_rule_1000.wasm"):      []byte("wasm"),
+	}, writer.files)
+}
+
+func TestRegoWriter_ScaffoldLayout(t *testing.T) {
+	writer := &recordingWriter{files: map[string][]byte{}}
+	regoWriter := NewRegoWriter(writer, "out", LayoutScaffold)
+
+	metadata := NewMetadata(1000, nil, nil)
+	require.NoError(t, regoWriter.WritePolicy(1000, KubewardenPackage, metadata))
+	require.NoError(t, regoWriter.WriteTests(1000, "package kubernetes.admission_test"))
+	require.NoError(t, regoWriter.WriteWasm(1000, []byte("wasm")))
+
+	projectDir := filepath.Join("out", "nv-rule-1000")
+	require.Len(t, writer.files, 7)
+	require.Equal(t, "package kubernetes.admission_test",
+		string(writer.files[filepath.Join(projectDir, "criteria_test.rego")]))
+	require.Equal(t, KubewardenPackage, string(writer.files[filepath.Join(projectDir, "policy.rego")]))
+	require.Equal(t, kubewardenRegoUtility, string(writer.files[filepath.Join(projectDir, "utility", "policy.rego")]))
+	require.Equal(t, scaffoldMakefile, string(writer.files[filepath.Join(projectDir, "Makefile")]))
+	require.Equal(t, scaffoldTest, string(writer.files[filepath.Join(projectDir, "policy_test.rego")]))
+	require.Equal(t, "wasm", string(writer.files[filepath.Join(projectDir, "annotated-policy.wasm")]))
+
+	var decoded Metadata
+	require.NoError(t, yaml.Unmarshal(writer.files[filepath.Join(projectDir, "metadata.yml")], &decoded))
+	require.Equal(t, metadata, decoded)
+}
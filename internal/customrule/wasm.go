@@ -0,0 +1,122 @@
+package customrule
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	policiesv1 "github.com/kubewarden/adm-controller/api/policies/v1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+)
+
+const (
+	// KubewardenMetadataSection is the Wasm custom section holding the policy metadata, as written by kwctl annotate.
+	KubewardenMetadataSection = "kubewarden_metadata"
+
+	// regoEntrypoint is the entrypoint of the OPA policies run by Kubewarden.
+	regoEntrypoint = "policy/main"
+
+	wasmCustomSectionID = 0
+)
+
+// kubewardenRegoUtility wraps the deny rules of the generated Rego policies into the AdmissionReview
+// response expected by Kubewarden, it's the utility/policy.rego file of the opa-policy-template repository.
+const kubewardenRegoUtility = `package policy
+
+import data.kubernetes.admission
+
+main = {
+	"apiVersion": "admission.k8s.io/v1",
+	"kind": "AdmissionReview",
+	"response": response,
+}
+
+default uid = ""
+
+uid = input.request.uid
+
+response = {
+	"uid": uid,
+	"allowed": false,
+	"status": {"message": reason},
+} {
+	reason = concat(", ", admission.deny)
+	reason != ""
+} else = {
+	"uid": uid,
+	"allowed": true,
+} {
+	true
+}
+`
+
+// Metadata is the Kubewarden policy metadata embedded in the Wasm module.
+type Metadata struct {
+	Rules                 []admissionregistrationv1.RuleWithOperations `json:"rules"`
+	Annotations           map[string]string                            `json:"annotations,omitempty"`
+	Mutating              bool                                         `json:"mutating"`
+	BackgroundAudit       bool                                         `json:"backgroundAudit"`
+	ContextAwareResources []policiesv1.ContextAwareResource            `json:"contextAwareResources,omitempty"`
+	ExecutionMode         string                                       `json:"executionMode"`
+	PolicyType            string                                       `json:"policyType"`
+}
+
+// NewMetadata returns the metadata of the policy generated for a NeuVector admission rule.
+func NewMetadata(
+	ruleID uint32,
+	rules []admissionregistrationv1.RuleWithOperations,
+	contextAwareResources []policiesv1.ContextAwareResource,
+) Metadata {
+	return Metadata{
+		Rules: rules,
+		Annotations: map[string]string{
+			"io.kubewarden.policy.title":       fmt.Sprintf("nv-rule-%d", ruleID),
+			"io.kubewarden.policy.description": fmt.Sprintf("Generated from NeuVector admission rule #%d", ruleID),
+		},
+		Mutating:              false,
+		BackgroundAudit:       true,
+		ContextAwareResources: contextAwareResources,
+		ExecutionMode:         "opa",
+		PolicyType:            "kubernetes",
+	}
+}
+
+// BuildWasmPolicy compiles the Rego policy generated for a NeuVector admission rule to a Wasm module
+// annotated with the Kubewarden metadata, ready to be pushed with kwctl.
+func BuildWasmPolicy(ctx context.Context, regoCode string, metadata Metadata) ([]byte, error) {
+	wasmModule, err := compileRegoToWasm(ctx, map[string]string{
+		"policy.rego":         regoCode,
+		"utility/policy.rego": kubewardenRegoUtility,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile rego code to wasm: %w", err)
+	}
+
+	return AnnotateWasmModule(wasmModule, metadata)
+}
+
+// AnnotateWasmModule appends the Kubewarden metadata custom section to the Wasm module.
+func AnnotateWasmModule(wasmModule []byte, metadata Metadata) ([]byte, error) {
+	wasmMagic := []byte{0x00, 0x61, 0x73, 0x6d}
+	if !bytes.HasPrefix(wasmModule, wasmMagic) {
+		return nil, errors.New("invalid wasm module: missing magic number")
+	}
+
+	payload, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal policy metadata: %w", err)
+	}
+
+	var content []byte
+	content = binary.AppendUvarint(content, uint64(len(KubewardenMetadataSection)))
+	content = append(content, KubewardenMetadataSection...)
+	content = append(content, payload...)
+
+	annotatedModule := bytes.Clone(wasmModule)
+	annotatedModule = append(annotatedModule, wasmCustomSectionID)
+	annotatedModule = binary.AppendUvarint(annotatedModule, uint64(len(content)))
+	return append(annotatedModule, content...), nil
+}
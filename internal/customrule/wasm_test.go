@@ -0,0 +1,128 @@
+package customrule
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	policiesv1 "github.com/kubewarden/adm-controller/api/policies/v1"
+	nvapis "github.com/neuvector/neuvector/controller/api"
+	nvshare "github.com/neuvector/neuvector/share"
+	"github.com/stretchr/testify/require"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+)
+
+func TestAnnotateWasmModule(t *testing.T) {
+	// An empty module: magic number and version
+	wasmModule := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	metadata := NewMetadata(
+		1001,
+		[]admissionregistrationv1.RuleWithOperations{
+			{
+				Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create},
+				Rule: admissionregistrationv1.Rule{
+					APIGroups:   []string{""},
+					APIVersions: []string{"v1"},
+					Resources:   []string{"pods"},
+				},
+			},
+		},
+		[]policiesv1.ContextAwareResource{
+			{APIVersion: "storage.sbomscanner.kubewarden.io/v1alpha1", Kind: "VulnerabilityReport"},
+		},
+	)
+
+	annotatedModule, err := AnnotateWasmModule(wasmModule, metadata)
+	require.NoError(t, err)
+	require.Equal(t, wasmModule, annotatedModule[:len(wasmModule)])
+
+	section := annotatedModule[len(wasmModule):]
+	require.Equal(t, byte(wasmCustomSectionID), section[0])
+	size, n := binary.Uvarint(section[1:])
+	content := section[1+n:]
+	require.Len(t, content, int(size))
+
+	nameLen, n := binary.Uvarint(content)
+	require.Equal(t, KubewardenMetadataSection, string(content[n:n+int(nameLen)]))
+
+	var decoded Metadata
+	require.NoError(t, json.Unmarshal(content[n+int(nameLen):], &decoded))
+	require.Equal(t, metadata, decoded)
+	require.Equal(t, "opa", decoded.ExecutionMode)
+	require.Equal(t, "nv-rule-1001", decoded.Annotations["io.kubewarden.policy.title"])
+}
+
+func TestAnnotateWasmModule_InvalidModule(t *testing.T) {
+	_, err := AnnotateWasmModule([]byte("package policy"), Metadata{})
+	require.ErrorContains(t, err, "invalid wasm module")
+}
+
+func TestBuildWasmPolicy(t *testing.T) {
+	rule := &nvapis.RESTAdmissionRule{
+		ID: 1000,
+		Criteria: []*nvapis.RESTAdmRuleCriterion{
+			{
+				Name:      RuleCustom,
+				Type:      RuleCustom,
+				Path:      "item.spec.containers[_].name",
+				Op:        nvshare.CriteriaOpContainsAny,
+				Value:     "nginx*",
+				ValueType: "string",
+			},
+		},
+	}
+	regoCode, err := GenerateRegoPolicy(rule)
+	require.NoError(t, err)
+
+	metadata := NewMetadata(rule.ID, []admissionregistrationv1.RuleWithOperations{
+		{
+			Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create},
+			Rule: admissionregistrationv1.Rule{
+				APIGroups:   []string{""},
+				APIVersions: []string{"v1"},
+				Resources:   []string{"pods"},
+			},
+		},
+	}, nil)
+
+	wasmModule, err := BuildWasmPolicy(context.Background(), regoCode, metadata)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x00, 0x61, 0x73, 0x6d}, wasmModule[:4])
+
+	content := customSection(t, wasmModule, KubewardenMetadataSection)
+	require.NotNil(t, content, "missing %s custom section", KubewardenMetadataSection)
+	var decoded Metadata
+	require.NoError(t, json.Unmarshal(content, &decoded))
+	require.Equal(t, metadata, decoded)
+	require.Equal(t, "nv-rule-1000", decoded.Annotations["io.kubewarden.policy.title"])
+}
+
+func TestBuildWasmPolicy_InvalidRego(t *testing.T) {
+	_, err := BuildWasmPolicy(context.Background(), "package policy\n\ndeny[msg] {", Metadata{})
+	require.ErrorContains(t, err, "failed to compile rego code to wasm")
+}
+
+// customSection returns the content of the named custom section of the Wasm module, nil when it's missing.
+func customSection(t *testing.T, wasmModule []byte, name string) []byte {
+	t.Helper()
+
+	// Skip the magic number and the version
+	sections := wasmModule[8:]
+	for len(sections) > 0 {
+		id := sections[0]
+		size, n := binary.Uvarint(sections[1:])
+		require.Positive(t, n)
+		content := sections[1+n : 1+n+int(size)]
+		sections = sections[1+n+int(size):]
+		if id != wasmCustomSectionID {
+			continue
+		}
+
+		nameLen, n := binary.Uvarint(content)
+		if string(content[n:n+int(nameLen)]) == name {
+			return content[n+int(nameLen):]
+		}
+	}
+	return nil
+}
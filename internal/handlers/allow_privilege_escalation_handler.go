@@ -24,6 +24,7 @@ func NewAllowPrivilegedEscalationHandler() *AllowPrivilegedEscalationHandler {
 			Name:               share.ExtractModuleName(PolicyAllowPrivEscalationURI),
 			ApplicableResource: ResourceWorkload,
 			Module:             PolicyAllowPrivEscalationURI,
+			Polarity:           share.PolarityRejectOnMatch,
 		},
 	}
 }
@@ -34,10 +34,13 @@ func NewAnnotationsPolicyHandler() *AnnotationsPolicyHandler {
 				nvdata.CriteriaOpContainsAny:       true,
 				nvdata.CriteriaOpContainsOtherThan: true,
 				nvdata.CriteriaOpNotContainsAny:    true,
+				nvdata.CriteriaOpRegex:             true,
+				nvdata.CriteriaOpNotRegex:          true,
 			},
 			Name:               share.ExtractModuleName(PolicyAnnotationsPolicyURI),
 			Module:             PolicyAnnotationsPolicyURI,
 			ApplicableResource: ResourceWorkload,
+			Polarity:           share.PolarityRejectOnMatch,
 		},
 		criteriaNegationMap: map[string]string{
 			nvdata.CriteriaOpContainsAll:       "doesNotContainAllOf",
@@ -64,3 +67,16 @@ func (h *AnnotationsPolicyHandler) BuildPolicySettings(criteria []*nvapis.RESTAd
 	}
 	return settingsBytes, nil
 }
+
+// RequiresCELPolicy returns true for the regex operators and the key=value or wildcard values,
+// which aren't supported by the annotations policy.
+func (h *AnnotationsPolicyHandler) RequiresCELPolicy(criterion *nvapis.RESTAdmRuleCriterion) bool {
+	return requiresMapPatternMatching(criterion)
+}
+
+// BuildCELValidations builds the validations matching the workload annotations against the criteria.
+func (h *AnnotationsPolicyHandler) BuildCELValidations(
+	criteria []*nvapis.RESTAdmRuleCriterion,
+) ([]share.CELValidation, error) {
+	return buildMapValidations(criteria, celAnnotationsVar, "annotations")
+}
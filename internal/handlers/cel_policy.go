@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/resources"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/share"
+	nvapis "github.com/neuvector/neuvector/controller/api"
+	nvdata "github.com/neuvector/neuvector/share"
+)
+
+const (
+	// PolicyCELPolicyURI is the module enforcing the criteria operators not supported by the criterion module.
+	PolicyCELPolicyURI = "registry://ghcr.io/kubewarden/policies/cel-policy:v1.3.4"
+
+	// The CEL policy variables shared by the validations, see celWorkloadVariables.
+	celLabelsVar      = "variables.labels"
+	celAnnotationsVar = "variables.annotations"
+	celContainersVar  = "variables.containers"
+	celImagesVar      = "variables.images"
+)
+
+type CELVariable struct {
+	Name       string `json:"name"`
+	Expression string `json:"expression"`
+}
+
+type CELPolicySettings struct {
+	Variables   []CELVariable         `json:"variables"`
+	Validations []share.CELValidation `json:"validations"`
+}
+
+// celPodSpecExpression is the expression of the pod spec of the pods, and of the workloads storing their pod
+// template at the default path of their kind.
+const celPodSpecExpression = "object.kind == 'Pod' ? object.spec : " +
+	"(object.kind == 'CronJob' ? object.spec.jobTemplate.spec.template.spec : object.spec.template.spec)"
+
+// celWorkloadVariables extract the metadata and containers of the workloads, regardless of their kind.
+var celWorkloadVariables = []CELVariable{
+	{
+		Name:       "labels",
+		Expression: "has(object.metadata.labels) ? object.metadata.labels : {}",
+	},
+	{
+		Name:       "annotations",
+		Expression: "has(object.metadata.annotations) ? object.metadata.annotations : {}",
+	},
+	{
+		Name:       "podSpec",
+		Expression: celPodSpecExpression,
+	},
+	{
+		Name: "containers",
+		Expression: "(has(variables.podSpec.containers) ? variables.podSpec.containers : []) + " +
+			"(has(variables.podSpec.initContainers) ? variables.podSpec.initContainers : []) + " +
+			"(has(variables.podSpec.ephemeralContainers) ? variables.podSpec.ephemeralContainers : [])",
+	},
+	{
+		// The images are normalized with the Docker Hub registry prefix and the latest tag
+		Name: "images",
+		Expression: "variables.containers.map(c, c.image.split('/').size() > 1 && " +
+			"(c.image.split('/')[0].contains('.') || c.image.split('/')[0].contains(':') || " +
+			"c.image.split('/')[0] == 'localhost') ? c.image : " +
+			"(c.image.contains('/') ? 'docker.io/' + c.image : 'docker.io/library/' + c.image))" +
+			".map(i, i.contains('@') || i.substring(i.lastIndexOf('/')).contains(':') ? i : i + ':latest')",
+	},
+}
+
+// BuildCELPolicySettings builds the CEL policy settings running all the validations against the workloads.
+// The pod spec of the workloads storing their pod template at another path than the default one of their kind,
+// such as custom resources, is read from their path.
+func BuildCELPolicySettings(validations []share.CELValidation, workloads ...resources.Resource) ([]byte, error) {
+	if len(validations) == 0 {
+		return nil, errors.New("no CEL validation to enforce")
+	}
+
+	variables := slices.Clone(celWorkloadVariables)
+	for i, variable := range variables {
+		if variable.Name == "podSpec" {
+			variables[i].Expression = celCustomPodSpecExpression(workloads)
+		}
+	}
+
+	return json.Marshal(CELPolicySettings{
+		Variables:   variables,
+		Validations: validations,
+	})
+}
+
+// celCustomPodSpecExpression returns the expression of the pod spec, reading the pod spec of the workloads
+// with a custom pod template path from it.
+func celCustomPodSpecExpression(workloads []resources.Resource) string {
+	customPaths := map[string]string{}
+	for _, workload := range workloads {
+		if workload.HasCustomTemplatePath() {
+			customPaths[workload.Kind] = workload.TemplatePath()
+		}
+	}
+
+	expression := celPodSpecExpression
+	for _, kind := range slices.Backward(slices.Sorted(maps.Keys(customPaths))) {
+		expression = fmt.Sprintf("object.kind == '%s' ? object.%s.spec : (%s)", kind, customPaths[kind], expression)
+	}
+	return expression
+}
+
+// isRegexOp returns true for the NeuVector regular expression operators, which are enforced by the CEL policy.
+func isRegexOp(op string) bool {
+	return op == nvdata.CriteriaOpRegex || op == nvdata.CriteriaOpNotRegex
+}
+
+// celRegexPattern validates the regular expression of the criterion and quotes it as a CEL string literal.
+// CEL matches() uses the RE2 syntax, which is also the syntax of the Go regexp package.
+func celRegexPattern(criterion *nvapis.RESTAdmRuleCriterion) (string, error) {
+	if criterion.Value == "" {
+		return "", fmt.Errorf("empty regular expression for criterion %s", criterion.Name)
+	}
+
+	if _, err := regexp.Compile(criterion.Value); err != nil {
+		return "", fmt.Errorf("regular expression %q of criterion %s is not RE2 compatible: %w",
+			criterion.Value, criterion.Name, err)
+	}
+
+	return strconv.Quote(criterion.Value), nil
+}
+
+// buildMapRegexValidation builds the validation of a regex criterion on a metadata map.
+// The entries are matched in their key=value form, the regex operator rejects the workloads with
+// an entry matching the pattern and the !regex operator the ones without any.
+func buildMapRegexValidation(
+	criterion *nvapis.RESTAdmRuleCriterion,
+	mapVar string,
+	kind string,
+) (share.CELValidation, error) {
+	pattern, err := celRegexPattern(criterion)
+	if err != nil {
+		return share.CELValidation{}, err
+	}
+
+	match := fmt.Sprintf("%s.exists(k, (k + '=' + %s[k]).matches(%s))", mapVar, mapVar, pattern)
+	if criterion.Op == nvdata.CriteriaOpRegex {
+		return share.CELValidation{
+			Expression: "!" + match,
+			Message:    fmt.Sprintf("%s matching %s are not allowed", kind, pattern),
+		}, nil
+	}
+
+	return share.CELValidation{
+		Expression: match,
+		Message:    fmt.Sprintf("%s must contain an entry matching %s", kind, pattern),
+	}, nil
+}
+
+// requiresMapPatternMatching returns true if the metadata map criterion must be enforced by the CEL policy.
+// The labels and annotations modules only match the keys, the key=value pairs, the wildcards and the regex
+// operators can't be expressed with their settings.
+func requiresMapPatternMatching(criterion *nvapis.RESTAdmRuleCriterion) bool {
+	return isRegexOp(criterion.Op) || strings.Contains(criterion.Value, "=") || share.HasWildcard(criterion.Value)
+}
+
+// buildMapValidations builds the validations of the set and regex criteria on a metadata map.
+func buildMapValidations(
+	criteria []*nvapis.RESTAdmRuleCriterion,
+	mapVar string,
+	kind string,
+) ([]share.CELValidation, error) {
+	validations := make([]share.CELValidation, 0, len(criteria))
+	for _, criterion := range criteria {
+		var (
+			validation share.CELValidation
+			err        error
+		)
+		if isRegexOp(criterion.Op) {
+			validation, err = buildMapRegexValidation(criterion, mapVar, kind)
+		} else {
+			validation, err = buildMapPatternValidation(criterion, mapVar, kind)
+		}
+		if err != nil {
+			return nil, err
+		}
+		validations = append(validations, validation)
+	}
+	return validations, nil
+}
+
+// buildMapPatternValidation builds the validation of a set criterion on a metadata map, the criterion values
+// are key=value pairs with wildcards. A key without value matches the entries with this key, whatever their value.
+func buildMapPatternValidation(
+	criterion *nvapis.RESTAdmRuleCriterion,
+	mapVar string,
+	kind string,
+) (share.CELValidation, error) {
+	patterns, err := share.ParseValuesToMap(criterion.Value)
+	if err != nil {
+		return share.CELValidation{}, err
+	}
+	if len(patterns) == 0 {
+		return share.CELValidation{}, fmt.Errorf("no value for criterion %s", criterion.Name)
+	}
+
+	keys := make([]string, 0, len(patterns))
+	for key := range patterns {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// entryMatches are the conditions matching an entry k of the map with one of the values
+	var entryMatches []string
+	for _, key := range keys {
+		for _, valuePattern := range patterns[key] {
+			entryMatches = append(entryMatches, fmt.Sprintf("(k.matches(%s) && %s[k].matches(%s))",
+				strconv.Quote(share.ConvertToRegexPattern(key)), mapVar, strconv.Quote(valuePattern)))
+		}
+	}
+
+	valueMatches := make([]string, 0, len(entryMatches))
+	for _, entryMatch := range entryMatches {
+		valueMatches = append(valueMatches, fmt.Sprintf("%s.exists(k, %s)", mapVar, entryMatch))
+	}
+
+	switch criterion.Op {
+	case nvdata.CriteriaOpContainsAny:
+		return share.CELValidation{
+			Expression: fmt.Sprintf("!(%s)", strings.Join(valueMatches, " || ")),
+			Message:    fmt.Sprintf("%s matching any of %q are not allowed", kind, criterion.Value),
+		}, nil
+	case nvdata.CriteriaOpContainsAll:
+		return share.CELValidation{
+			Expression: fmt.Sprintf("!(%s)", strings.Join(valueMatches, " && ")),
+			Message:    fmt.Sprintf("%s matching all of %q are not allowed", kind, criterion.Value),
+		}, nil
+	case nvdata.CriteriaOpNotContainsAny:
+		return share.CELValidation{
+			Expression: strings.Join(valueMatches, " || "),
+			Message:    fmt.Sprintf("%s must match one of %q", kind, criterion.Value),
+		}, nil
+	case nvdata.CriteriaOpContainsOtherThan:
+		return share.CELValidation{
+			Expression: fmt.Sprintf("%s.all(k, %s)", mapVar, strings.Join(entryMatches, " || ")),
+			Message:    fmt.Sprintf("%s other than %q are not allowed", kind, criterion.Value),
+		}, nil
+	default:
+		return share.CELValidation{}, fmt.Errorf("unsupported criteria operator for CEL policy: %s", criterion.Op)
+	}
+}
+
+// buildRegexValidations builds the validations of the regex criteria with the handler build function.
+func buildRegexValidations(
+	criteria []*nvapis.RESTAdmRuleCriterion,
+	build func(criterion *nvapis.RESTAdmRuleCriterion) (share.CELValidation, error),
+) ([]share.CELValidation, error) {
+	validations := make([]share.CELValidation, 0, len(criteria))
+	for _, criterion := range criteria {
+		if !isRegexOp(criterion.Op) {
+			return nil, fmt.Errorf("unsupported criteria operator for CEL policy: %s", criterion.Op)
+		}
+
+		validation, err := build(criterion)
+		if err != nil {
+			return nil, err
+		}
+		validations = append(validations, validation)
+	}
+	return validations, nil
+}
@@ -0,0 +1,519 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/ext"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/resources"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/share"
+	nvapis "github.com/neuvector/neuvector/controller/api"
+	nvdata "github.com/neuvector/neuvector/share"
+	"github.com/stretchr/testify/require"
+)
+
+// evalCELValidations evaluates the validations of the CEL policy settings against the object,
+// and returns true if all of them pass.
+func evalCELValidations(t *testing.T, settings []byte, object map[string]any) bool {
+	t.Helper()
+
+	var celSettings CELPolicySettings
+	require.NoError(t, json.Unmarshal(settings, &celSettings))
+
+	env, err := cel.NewEnv(
+		cel.Variable("object", cel.DynType),
+		cel.Variable("variables", cel.MapType(cel.StringType, cel.DynType)),
+		ext.Strings(),
+	)
+	require.NoError(t, err)
+
+	eval := func(expression string, variables map[string]any) any {
+		ast, iss := env.Compile(expression)
+		require.NoError(t, iss.Err(), expression)
+		program, err := env.Program(ast)
+		require.NoError(t, err)
+		out, _, err := program.Eval(map[string]any{"object": object, "variables": variables})
+		require.NoError(t, err, expression)
+		return out.Value()
+	}
+
+	variables := map[string]any{}
+	for _, variable := range celSettings.Variables {
+		variables[variable.Name] = eval(variable.Expression, variables)
+	}
+
+	for _, validation := range celSettings.Validations {
+		if eval(validation.Expression, variables) != true {
+			return false
+		}
+	}
+	return true
+}
+
+func TestBuildCELValidations(t *testing.T) {
+	deployment := map[string]any{
+		"kind": "Deployment",
+		"metadata": map[string]any{
+			"labels":      map[string]any{"app": "nginx", "tier": "frontend"},
+			"annotations": map[string]any{"owner": "team-a"},
+		},
+		"spec": map[string]any{
+			"template": map[string]any{
+				"spec": map[string]any{
+					"containers": []any{
+						map[string]any{
+							"name":  "nginx",
+							"image": "registry.my-corp.com/nginx:1.27",
+							"env":   []any{map[string]any{"name": "DB_PASSWORD", "value": "secret"}},
+						},
+					},
+					"initContainers": []any{
+						map[string]any{"name": "init", "image": "busybox:latest"},
+					},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		handler       share.CELPolicyHandler
+		criterion     *nvapis.RESTAdmRuleCriterion
+		expectedAllow bool
+		expectedError error
+	}{
+		{
+			name:          "labels regex matching a label",
+			handler:       NewLabelsPolicyHandler(),
+			criterion:     &nvapis.RESTAdmRuleCriterion{Name: RuleLabels, Op: nvdata.CriteriaOpRegex, Value: "^tier=front"},
+			expectedAllow: false,
+		},
+		{
+			name:          "labels regex not matching any label",
+			handler:       NewLabelsPolicyHandler(),
+			criterion:     &nvapis.RESTAdmRuleCriterion{Name: RuleLabels, Op: nvdata.CriteriaOpRegex, Value: "^tier=back"},
+			expectedAllow: true,
+		},
+		{
+			name:          "labels !regex matching a label",
+			handler:       NewLabelsPolicyHandler(),
+			criterion:     &nvapis.RESTAdmRuleCriterion{Name: RuleLabels, Op: nvdata.CriteriaOpNotRegex, Value: "^app="},
+			expectedAllow: true,
+		},
+		{
+			name:          "annotations !regex not matching any annotation",
+			handler:       NewAnnotationsPolicyHandler(),
+			criterion:     &nvapis.RESTAdmRuleCriterion{Name: RuleAnnotations, Op: nvdata.CriteriaOpNotRegex, Value: "^team="},
+			expectedAllow: false,
+		},
+		{
+			name:          "image regex matching an init container",
+			handler:       NewTrustedReposHandler(),
+			criterion:     &nvapis.RESTAdmRuleCriterion{Name: RuleImage, Op: nvdata.CriteriaOpRegex, Value: "busybox:.*"},
+			expectedAllow: false,
+		},
+		{
+			name:          "image !regex matching all the containers",
+			handler:       NewTrustedReposHandler(),
+			criterion:     &nvapis.RESTAdmRuleCriterion{Name: RuleImage, Op: nvdata.CriteriaOpNotRegex, Value: ":[0-9a-z.]+$"},
+			expectedAllow: true,
+		},
+		{
+			name:    "image registry regex matching the docker hub default registry",
+			handler: NewTrustedReposHandler(),
+			criterion: &nvapis.RESTAdmRuleCriterion{
+				Name:  RuleImageRegistry,
+				Op:    nvdata.CriteriaOpRegex,
+				Value: `^docker\.io$`,
+			},
+			expectedAllow: false,
+		},
+		{
+			name:    "image registry !regex not matching the docker hub default registry",
+			handler: NewTrustedReposHandler(),
+			criterion: &nvapis.RESTAdmRuleCriterion{
+				Name:  RuleImageRegistry,
+				Op:    nvdata.CriteriaOpNotRegex,
+				Value: `\.my-corp\.com$`,
+			},
+			expectedAllow: false,
+		},
+		{
+			name:          "env var regex matching a variable name",
+			handler:       NewEnvVarHandler(),
+			criterion:     &nvapis.RESTAdmRuleCriterion{Name: RuleEnvVars, Op: nvdata.CriteriaOpRegex, Value: "(?i)password"},
+			expectedAllow: false,
+		},
+		{
+			name:          "env var !regex matching a variable name",
+			handler:       NewEnvVarHandler(),
+			criterion:     &nvapis.RESTAdmRuleCriterion{Name: RuleEnvVars, Op: nvdata.CriteriaOpNotRegex, Value: "^DB_"},
+			expectedAllow: true,
+		},
+		{
+			name:    "labels contains any key=value with wildcard",
+			handler: NewLabelsPolicyHandler(),
+			criterion: &nvapis.RESTAdmRuleCriterion{
+				Name:  RuleLabels,
+				Op:    nvdata.CriteriaOpContainsAny,
+				Value: "env=prod,tier=front*",
+			},
+			expectedAllow: false,
+		},
+		{
+			name:    "labels contains any key=value not matching",
+			handler: NewLabelsPolicyHandler(),
+			criterion: &nvapis.RESTAdmRuleCriterion{
+				Name:  RuleLabels,
+				Op:    nvdata.CriteriaOpContainsAny,
+				Value: "tier=back*, app=nginx?",
+			},
+			expectedAllow: true,
+		},
+		{
+			name:          "labels contains any key with wildcard",
+			handler:       NewLabelsPolicyHandler(),
+			criterion:     &nvapis.RESTAdmRuleCriterion{Name: RuleLabels, Op: nvdata.CriteriaOpContainsAny, Value: "ti*"},
+			expectedAllow: false,
+		},
+		{
+			name:    "labels contains all key=value matching",
+			handler: NewLabelsPolicyHandler(),
+			criterion: &nvapis.RESTAdmRuleCriterion{
+				Name:  RuleLabels,
+				Op:    nvdata.CriteriaOpContainsAll,
+				Value: "app=ng?nx,tier",
+			},
+			expectedAllow: false,
+		},
+		{
+			name:    "labels contains all key=value partially matching",
+			handler: NewLabelsPolicyHandler(),
+			criterion: &nvapis.RESTAdmRuleCriterion{
+				Name:  RuleLabels,
+				Op:    nvdata.CriteriaOpContainsAll,
+				Value: "app=nginx,env=prod",
+			},
+			expectedAllow: true,
+		},
+		{
+			name:    "labels not contains any key=value matching",
+			handler: NewLabelsPolicyHandler(),
+			criterion: &nvapis.RESTAdmRuleCriterion{
+				Name:  RuleLabels,
+				Op:    nvdata.CriteriaOpNotContainsAny,
+				Value: "env=prod,app=nginx",
+			},
+			expectedAllow: true,
+		},
+		{
+			name:    "labels not contains any key=value not matching",
+			handler: NewLabelsPolicyHandler(),
+			criterion: &nvapis.RESTAdmRuleCriterion{
+				Name:  RuleLabels,
+				Op:    nvdata.CriteriaOpNotContainsAny,
+				Value: "env=prod*",
+			},
+			expectedAllow: false,
+		},
+		{
+			name:    "labels contains other than key=value, all matching",
+			handler: NewLabelsPolicyHandler(),
+			criterion: &nvapis.RESTAdmRuleCriterion{
+				Name:  RuleLabels,
+				Op:    nvdata.CriteriaOpContainsOtherThan,
+				Value: "app=*,tier=frontend",
+			},
+			expectedAllow: true,
+		},
+		{
+			name:    "labels contains other than key=value, one not matching",
+			handler: NewLabelsPolicyHandler(),
+			criterion: &nvapis.RESTAdmRuleCriterion{
+				Name:  RuleLabels,
+				Op:    nvdata.CriteriaOpContainsOtherThan,
+				Value: "app=*,tier=backend",
+			},
+			expectedAllow: false,
+		},
+		{
+			name:    "annotations contains any key=value with wildcard",
+			handler: NewAnnotationsPolicyHandler(),
+			criterion: &nvapis.RESTAdmRuleCriterion{
+				Name:  RuleAnnotations,
+				Op:    nvdata.CriteriaOpContainsAny,
+				Value: "owner=team-?",
+			},
+			expectedAllow: false,
+		},
+		{
+			name:    "annotations contains any key=value with literal dot",
+			handler: NewAnnotationsPolicyHandler(),
+			criterion: &nvapis.RESTAdmRuleCriterion{
+				Name:  RuleAnnotations,
+				Op:    nvdata.CriteriaOpContainsAny,
+				Value: "owner=team.a",
+			},
+			expectedAllow: true,
+		},
+		{
+			name:    "image contains any with tag wildcard",
+			handler: NewTrustedReposHandler(),
+			criterion: &nvapis.RESTAdmRuleCriterion{
+				Name:  RuleImage,
+				Op:    nvdata.CriteriaOpContainsAny,
+				Value: "docker.io/library/busybox:*",
+			},
+			expectedAllow: false,
+		},
+		{
+			name:          "image contains any with implicit docker hub registry",
+			handler:       NewTrustedReposHandler(),
+			criterion:     &nvapis.RESTAdmRuleCriterion{Name: RuleImage, Op: nvdata.CriteriaOpContainsAny, Value: "busy*"},
+			expectedAllow: false,
+		},
+		{
+			name:          "image contains any with leading wildcard",
+			handler:       NewTrustedReposHandler(),
+			criterion:     &nvapis.RESTAdmRuleCriterion{Name: RuleImage, Op: nvdata.CriteriaOpContainsAny, Value: "*/busybox"},
+			expectedAllow: false,
+		},
+		{
+			name:    "image contains any not matching the tag",
+			handler: NewTrustedReposHandler(),
+			criterion: &nvapis.RESTAdmRuleCriterion{
+				Name:  RuleImage,
+				Op:    nvdata.CriteriaOpContainsAny,
+				Value: "registry.my-corp.com/nginx:2.*,redis",
+			},
+			expectedAllow: true,
+		},
+		{
+			name:    "image contains any with digest wildcard",
+			handler: NewTrustedReposHandler(),
+			criterion: &nvapis.RESTAdmRuleCriterion{
+				Name:  RuleImage,
+				Op:    nvdata.CriteriaOpContainsAny,
+				Value: "busybox@sha256:*",
+			},
+			expectedAllow: true,
+		},
+		{
+			name:    "image not contains any matching all the containers",
+			handler: NewTrustedReposHandler(),
+			criterion: &nvapis.RESTAdmRuleCriterion{
+				Name:  RuleImage,
+				Op:    nvdata.CriteriaOpNotContainsAny,
+				Value: "registry.my-corp.com/*, busybox",
+			},
+			expectedAllow: true,
+		},
+		{
+			name:    "image not contains any not matching the init container",
+			handler: NewTrustedReposHandler(),
+			criterion: &nvapis.RESTAdmRuleCriterion{
+				Name:  RuleImage,
+				Op:    nvdata.CriteriaOpNotContainsAny,
+				Value: "registry.my-corp.com/*",
+			},
+			expectedAllow: false,
+		},
+		{
+			name:    "image registry contains any with wildcard",
+			handler: NewTrustedReposHandler(),
+			criterion: &nvapis.RESTAdmRuleCriterion{
+				Name:  RuleImageRegistry,
+				Op:    nvdata.CriteriaOpContainsAny,
+				Value: "*.my-corp.com",
+			},
+			expectedAllow: false,
+		},
+		{
+			name:    "image registry not contains any with docker hub alias",
+			handler: NewTrustedReposHandler(),
+			criterion: &nvapis.RESTAdmRuleCriterion{
+				Name:  RuleImageRegistry,
+				Op:    nvdata.CriteriaOpNotContainsAny,
+				Value: "*.my-corp.com,https://index.docker.io/",
+			},
+			expectedAllow: true,
+		},
+		{
+			name:    "image registry contains any with a path",
+			handler: NewTrustedReposHandler(),
+			criterion: &nvapis.RESTAdmRuleCriterion{
+				Name:  RuleImageRegistry,
+				Op:    nvdata.CriteriaOpContainsAny,
+				Value: "docker.io/library",
+			},
+			expectedAllow: false,
+		},
+		{
+			name:    "image registry not contains any with a path not matching",
+			handler: NewTrustedReposHandler(),
+			criterion: &nvapis.RESTAdmRuleCriterion{
+				Name:  RuleImageRegistry,
+				Op:    nvdata.CriteriaOpNotContainsAny,
+				Value: "registry.my-corp.com/team,docker.io/library",
+			},
+			expectedAllow: false,
+		},
+		{
+			name:    "image registry not contains any with paths and hosts",
+			handler: NewTrustedReposHandler(),
+			criterion: &nvapis.RESTAdmRuleCriterion{
+				Name:  RuleImageRegistry,
+				Op:    nvdata.CriteriaOpNotContainsAny,
+				Value: "registry.my-corp.com,https://index.docker.io/library",
+			},
+			expectedAllow: true,
+		},
+		{
+			name:    "labels key=value with empty key",
+			handler: NewLabelsPolicyHandler(),
+			criterion: &nvapis.RESTAdmRuleCriterion{
+				Name:  RuleLabels,
+				Op:    nvdata.CriteriaOpContainsAny,
+				Value: "=prod",
+			},
+			expectedError: errors.New(`empty key found in input: "=prod"`),
+		},
+		{
+			name:    "regex not RE2 compatible",
+			handler: NewLabelsPolicyHandler(),
+			criterion: &nvapis.RESTAdmRuleCriterion{
+				Name:  RuleLabels,
+				Op:    nvdata.CriteriaOpRegex,
+				Value: "^(?!app=)",
+			},
+			expectedError: errors.New("regular expression \"^(?!app=)\" of criterion labels is not RE2 compatible: " +
+				"error parsing regexp: invalid or unsupported Perl syntax: `(?!`"),
+		},
+		{
+			name:          "set operator",
+			handler:       NewEnvVarHandler(),
+			criterion:     &nvapis.RESTAdmRuleCriterion{Name: RuleEnvVars, Op: nvdata.CriteriaOpContainsAny, Value: "foo"},
+			expectedError: errors.New("unsupported criteria operator for CEL policy: containsAny"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			criteria := []*nvapis.RESTAdmRuleCriterion{tt.criterion}
+			validations, err := tt.handler.BuildCELValidations(criteria)
+			if tt.expectedError != nil {
+				require.EqualError(t, err, tt.expectedError.Error())
+				return
+			}
+			require.NoError(t, err)
+			require.True(t, tt.handler.RequiresCELPolicy(tt.criterion))
+
+			settings, err := BuildCELPolicySettings(validations)
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedAllow, evalCELValidations(t, settings, deployment))
+		})
+	}
+}
+
+func TestBuildCELPolicySettingsCustomPodTemplatePath(t *testing.T) {
+	podSpec := map[string]any{
+		"containers": []any{
+			map[string]any{
+				"name":  "app",
+				"image": "nginx",
+				"env":   []any{map[string]any{"name": "DB_PASSWORD", "value": "secret"}},
+			},
+		},
+	}
+	worker := map[string]any{
+		"kind":     "Worker",
+		"metadata": map[string]any{},
+		"spec":     map[string]any{"workload": map[string]any{"template": map[string]any{"spec": podSpec}}},
+	}
+	cronJob := map[string]any{
+		"kind":     "CronJob",
+		"metadata": map[string]any{},
+		"spec": map[string]any{"jobTemplate": map[string]any{"spec": map[string]any{
+			"template": map[string]any{"spec": podSpec},
+		}}},
+	}
+
+	criterion := &nvapis.RESTAdmRuleCriterion{Name: RuleEnvVars, Op: nvdata.CriteriaOpRegex, Value: "^DB_"}
+	validations, err := NewEnvVarHandler().BuildCELValidations([]*nvapis.RESTAdmRuleCriterion{criterion})
+	require.NoError(t, err)
+
+	settings, err := BuildCELPolicySettings(validations,
+		resources.Resource{APIVersion: "v1", Resource: "cronjobs", Kind: "CronJob"},
+		resources.Resource{
+			APIGroup:        "example.com",
+			APIVersion:      "v1",
+			Resource:        "workers",
+			Kind:            "Worker",
+			PodTemplatePath: "spec.workload.template",
+		},
+	)
+	require.NoError(t, err)
+	require.False(t, evalCELValidations(t, settings, worker))
+	require.False(t, evalCELValidations(t, settings, cronJob))
+
+	podSpec["containers"] = []any{map[string]any{"name": "app", "image": "nginx"}}
+	require.True(t, evalCELValidations(t, settings, worker))
+}
+
+func TestRequiresCELPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		handler   share.CELPolicyHandler
+		criterion *nvapis.RESTAdmRuleCriterion
+		expected  bool
+	}{
+		{
+			name:      "labels keys",
+			handler:   NewLabelsPolicyHandler(),
+			criterion: &nvapis.RESTAdmRuleCriterion{Name: RuleLabels, Op: nvdata.CriteriaOpContainsAny, Value: "foo,bar"},
+			expected:  false,
+		},
+		{
+			name:      "labels key=value",
+			handler:   NewLabelsPolicyHandler(),
+			criterion: &nvapis.RESTAdmRuleCriterion{Name: RuleLabels, Op: nvdata.CriteriaOpContainsAny, Value: "foo=1,bar"},
+			expected:  true,
+		},
+		{
+			name:      "annotations key with wildcard",
+			handler:   NewAnnotationsPolicyHandler(),
+			criterion: &nvapis.RESTAdmRuleCriterion{Name: RuleAnnotations, Op: nvdata.CriteriaOpContainsAll, Value: "foo*"},
+			expected:  true,
+		},
+		{
+			name:      "env var regex",
+			handler:   NewEnvVarHandler(),
+			criterion: &nvapis.RESTAdmRuleCriterion{Name: RuleEnvVars, Op: nvdata.CriteriaOpRegex, Value: "foo"},
+			expected:  true,
+		},
+		{
+			name:    "image registry with a path",
+			handler: NewTrustedReposHandler(),
+			criterion: &nvapis.RESTAdmRuleCriterion{
+				Name:  RuleImageRegistry,
+				Op:    nvdata.CriteriaOpNotContainsAny,
+				Value: "docker.io,quay.io/myorg",
+			},
+			expected: true,
+		},
+		{
+			name:      "image exact",
+			handler:   NewTrustedReposHandler(),
+			criterion: &nvapis.RESTAdmRuleCriterion{Name: RuleImage, Op: nvdata.CriteriaOpContainsAny, Value: "nginx"},
+			expected:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, tt.handler.RequiresCELPolicy(tt.criterion))
+		})
+	}
+}
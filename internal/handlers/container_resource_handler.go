@@ -71,6 +71,7 @@ func NewContainerResourceHandler() *ContainerResourceHandler {
 			Name:               share.ExtractModuleName(PolicyContainerResourceURI),
 			Module:             PolicyContainerResourceURI,
 			ApplicableResource: ResourceWorkload,
+			Polarity:           share.PolarityRejectOnMatch,
 		},
 	}
 }
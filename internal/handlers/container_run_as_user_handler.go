@@ -23,6 +23,7 @@ func NewContainerRunningAsUserHandler() *ContainerRunningAsUserHandler {
 			Name:               share.ExtractModuleName(PolicyContainerRunningAsUserURI),
 			ApplicableResource: ResourceWorkload,
 			Module:             PolicyContainerRunningAsUserURI,
+			Polarity:           share.PolarityRejectOnMatch,
 		},
 	}
 }
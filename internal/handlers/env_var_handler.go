@@ -34,10 +34,13 @@ func NewEnvVarHandler() *EnvVarHandler {
 				nvdata.CriteriaOpContainsAny:       true,
 				nvdata.CriteriaOpContainsOtherThan: true,
 				nvdata.CriteriaOpNotContainsAny:    true,
+				nvdata.CriteriaOpRegex:             true,
+				nvdata.CriteriaOpNotRegex:          true,
 			},
 			Name:               share.ExtractModuleName(PolicyEnvironmentVariableURI),
 			Module:             PolicyEnvironmentVariableURI,
 			ApplicableResource: ResourceWorkload,
+			Polarity:           share.PolarityRejectOnMatch,
 		},
 		criteriaNegationMap: map[string]string{
 			nvdata.CriteriaOpContainsAll:       "doesNotContainAllOf",
@@ -68,3 +71,32 @@ func (h *EnvVarHandler) BuildPolicySettings(criteria []*nvapis.RESTAdmRuleCriter
 	}
 	return settingsBytes, nil
 }
+
+// RequiresCELPolicy returns true for the regex operators, which aren't supported by the environment variable policy.
+func (h *EnvVarHandler) RequiresCELPolicy(criterion *nvapis.RESTAdmRuleCriterion) bool {
+	return isRegexOp(criterion.Op)
+}
+
+// BuildCELValidations builds the validations matching the container environment variable names against
+// the regex criteria. The regex operator rejects the workloads with a variable matching the pattern and
+// the !regex operator the ones without any.
+func (h *EnvVarHandler) BuildCELValidations(criteria []*nvapis.RESTAdmRuleCriterion) ([]share.CELValidation, error) {
+	return buildRegexValidations(criteria, func(criterion *nvapis.RESTAdmRuleCriterion) (share.CELValidation, error) {
+		pattern, err := celRegexPattern(criterion)
+		if err != nil {
+			return share.CELValidation{}, err
+		}
+
+		match := fmt.Sprintf("%s.exists(c, has(c.env) && c.env.exists(e, e.name.matches(%s)))", celContainersVar, pattern)
+		if criterion.Op == nvdata.CriteriaOpRegex {
+			return share.CELValidation{
+				Expression: "!" + match,
+				Message:    fmt.Sprintf("environment variables matching %s are not allowed", pattern),
+			}, nil
+		}
+		return share.CELValidation{
+			Expression: match,
+			Message:    fmt.Sprintf("an environment variable matching %s is required", pattern),
+		}, nil
+	})
+}
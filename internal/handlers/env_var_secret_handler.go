@@ -29,6 +29,7 @@ func NewEnvVarSecretHandler() *EnvVarSecretHandler {
 			Name:               share.ExtractModuleName(PolicyEnvSecretScannerURI),
 			Module:             PolicyEnvSecretScannerURI,
 			ApplicableResource: ResourceWorkload,
+			Polarity:           share.PolarityRejectOnMatch,
 		},
 	}
 }
@@ -8,6 +8,7 @@ import (
 	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/share"
 	nvapis "github.com/neuvector/neuvector/controller/api"
 	nvdata "github.com/neuvector/neuvector/share"
+	rbacv1 "k8s.io/api/rbac/v1"
 )
 
 type HighRiskServiceAccountHandler struct {
@@ -32,6 +33,7 @@ func NewHighRiskServiceAccountHandler() *HighRiskServiceAccountHandler {
 			Name:               share.ExtractModuleName(PolicyHighRiskServiceAccountURI),
 			ApplicableResource: ResourceWorkload,
 			Module:             PolicyHighRiskServiceAccountURI,
+			Polarity:           share.PolarityRejectOnMatch,
 		},
 	}
 }
@@ -98,3 +100,15 @@ func (h *HighRiskServiceAccountHandler) BuildPolicySettings(criteria []*nvapis.R
 
 	return json.Marshal(map[string][]highRiskSASettingsDetail{"blockRules": settings})
 }
+
+// GetAPIAccessRules returns the access to the SubjectAccessReviews the module checks the permissions of the service
+// accounts with.
+func (h *HighRiskServiceAccountHandler) GetAPIAccessRules() []rbacv1.PolicyRule {
+	return []rbacv1.PolicyRule{
+		{
+			APIGroups: []string{"authorization.k8s.io"},
+			Resources: []string{"subjectaccessreviews"},
+			Verbs:     []string{"create"},
+		},
+	}
+}
@@ -34,6 +34,7 @@ func NewHostNamespaceHandler() *HostNamespaceHandler {
 			Name:               share.ExtractModuleName(PolicyHostNamespacesPSPURI),
 			ApplicableResource: ResourceWorkload,
 			Module:             PolicyHostNamespacesPSPURI,
+			Polarity:           share.PolarityRejectOnMatch,
 		},
 	}
 }
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	policiesv1 "github.com/kubewarden/adm-controller/api/policies/v1"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/share"
+	nvapis "github.com/neuvector/neuvector/controller/api"
+	nvdata "github.com/neuvector/neuvector/share"
+)
+
+const (
+	// ImageCompliancePolicyURI is empty because there is no Kubewarden module for image compliance yet,
+	// rules using this criterion are converted to a Rego policy instead.
+	ImageCompliancePolicyURI = ""
+
+	RuleImageCompliance = "imageCompliance"
+)
+
+// ImageComplianceHandler handles the image compliance violations criterion.
+// The compliance (misconfiguration and secret) results are read from the SBOMscanner reports
+// stored next to the vulnerability reports.
+type ImageComplianceHandler struct {
+	BasePolicyHandler
+
+	vulReportNamespace string
+	platform           string
+}
+
+const imageComplianceRegoTemplate = `package kubernetes.admission
+
+# Generated from NeuVector admission rule #{{ .RuleID }} (imageCompliance).
+# The policy must be deployed with the following context aware resource:
+#   - apiVersion: storage.sbomscanner.kubewarden.io/v1alpha1
+#     kind: VulnerabilityReport
+
+deny[msg] {
+{{- template "namespaceConditions" . }}
+	container := _containers[_]
+	report := _reports[_]
+	_report_matches_image(report, container.image)
+	_compliance_violations(report) > 0
+	msg := sprintf("Denied by NeuVector rule #{{ .RuleID }}: image %s has compliance violations", [container.image])
+}
+
+_compliance_violations(report) := n {
+	misconfigurations := [m | m := report.report.results[_].misconfigurations[_]]
+	secrets := [s | s := report.report.results[_].secrets[_]]
+	n := count(misconfigurations) + count(secrets)
+}
+{{ template "sbomscannerHelpers" . }}
+`
+
+func NewImageComplianceHandler(vulReportNamespace string, platform string) *ImageComplianceHandler {
+	return &ImageComplianceHandler{
+		BasePolicyHandler: BasePolicyHandler{
+			Unsupported: false,
+			SupportedOps: map[string]bool{
+				nvdata.CriteriaOpEqual: true,
+			},
+			Name:               RuleImageCompliance,
+			Module:             ImageCompliancePolicyURI,
+			ApplicableResource: ResourceWorkload,
+			ContextAwareResources: []policiesv1.ContextAwareResource{
+				{
+					Kind:       "VulnerabilityReport",
+					APIVersion: "storage.sbomscanner.kubewarden.io/v1alpha1",
+				},
+			},
+			Polarity: share.PolarityRejectOnMatch,
+		},
+		vulReportNamespace: vulReportNamespace,
+		platform:           platform,
+	}
+}
+
+func (h *ImageComplianceHandler) validateCriteria(criteria []*nvapis.RESTAdmRuleCriterion) error {
+	if len(criteria) != 1 {
+		return errors.New("only one criterion is allowed")
+	}
+
+	if criteria[0].Value != "true" {
+		return fmt.Errorf("%s supports only true value, got: %s", RuleImageCompliance, criteria[0].Value)
+	}
+
+	return nil
+}
+
+// BuildPolicySettings fails, the criterion has no Kubewarden module: it's enforced by the policy of BuildRegoPolicy.
+func (h *ImageComplianceHandler) BuildPolicySettings(_ []*nvapis.RESTAdmRuleCriterion) ([]byte, error) {
+	return nil, fmt.Errorf("no Kubewarden module for %s, it requires a Rego policy", RuleImageCompliance)
+}
+
+// RequiresRegoPolicy returns true as long as there is no Kubewarden module for this criterion.
+func (h *ImageComplianceHandler) RequiresRegoPolicy() bool {
+	return h.Module == ""
+}
+
+// BuildRegoPolicy builds a context aware Rego policy that rejects workloads whose images
+// have compliance violations reported by SBOMscanner.
+func (h *ImageComplianceHandler) BuildRegoPolicy(
+	rule *nvapis.RESTAdmissionRule,
+	criteria []*nvapis.RESTAdmRuleCriterion,
+) (string, error) {
+	if err := h.validateCriteria(criteria); err != nil {
+		return "", err
+	}
+
+	input, err := newSbomscannerRegoInput(rule, h.vulReportNamespace)
+	if err != nil {
+		return "", err
+	}
+
+	return renderRegoTemplate("imageComplianceRego", imageComplianceRegoTemplate, input)
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+
+	nvapis "github.com/neuvector/neuvector/controller/api"
+	nvdata "github.com/neuvector/neuvector/share"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildImageCompliancePolicySettings(t *testing.T) {
+	handler := NewImageComplianceHandler("sbomscanner", "arm64")
+
+	_, err := handler.BuildPolicySettings([]*nvapis.RESTAdmRuleCriterion{
+		{Name: RuleImageCompliance, Op: nvdata.CriteriaOpEqual, Value: "true"},
+	})
+	require.EqualError(t, err, "no Kubewarden module for imageCompliance, it requires a Rego policy")
+}
+
+func TestBuildImageComplianceRegoPolicy(t *testing.T) {
+	handler := NewImageComplianceHandler("sbomscanner", "amd64")
+	require.True(t, handler.RequiresRegoPolicy())
+
+	rule := &nvapis.RESTAdmissionRule{
+		ID:         1001,
+		Containers: []string{nvdata.AdmCtrlRuleContainers, nvdata.AdmCtrlRuleInitContainers},
+	}
+	criteria := []*nvapis.RESTAdmRuleCriterion{
+		{
+			Name:  RuleImageCompliance,
+			Op:    nvdata.CriteriaOpEqual,
+			Value: "true",
+		},
+	}
+
+	regoCode, err := handler.BuildRegoPolicy(rule, criteria)
+	require.NoError(t, err)
+	require.Contains(t, regoCode, "package kubernetes.admission")
+	require.Contains(t, regoCode, `data.kubernetes.vulnerabilityreports["sbomscanner"][_]`)
+	require.Contains(t, regoCode, `_get_input("get").spec.containers[_]`)
+	require.Contains(t, regoCode, `_get_input("get").spec.initContainers[_]`)
+	require.NotContains(t, regoCode, `_get_input("get").spec.ephemeralContainers[_]`)
+	require.Contains(t, regoCode, "Denied by NeuVector rule #1001")
+}
+
+func TestBuildImageComplianceRegoPolicy_InvalidValue(t *testing.T) {
+	handler := NewImageComplianceHandler("sbomscanner", "amd64")
+
+	_, err := handler.BuildRegoPolicy(&nvapis.RESTAdmissionRule{ID: 1001}, []*nvapis.RESTAdmRuleCriterion{
+		{Name: RuleImageCompliance, Op: nvdata.CriteriaOpEqual, Value: "false"},
+	})
+	require.Equal(t, errors.New("imageCompliance supports only true value, got: false"), err)
+}
@@ -87,6 +87,7 @@ func NewImageCVEHandler(vulReportNamespace string, platform string) *ImageCVEHan
 					APIVersion: "storage.sbomscanner.kubewarden.io/v1alpha1",
 				},
 			},
+			Polarity: share.PolarityRejectOnMatch,
 		},
 		criteriaNegationMap: map[string]string{
 			nvdata.CriteriaOpContainsAll:       "doesNotContainAllOf",
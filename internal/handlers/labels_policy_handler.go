@@ -34,10 +34,13 @@ func NewLabelsPolicyHandler() *LabelsPolicyHandler {
 				nvdata.CriteriaOpContainsAny:       true,
 				nvdata.CriteriaOpContainsOtherThan: true,
 				nvdata.CriteriaOpNotContainsAny:    true,
+				nvdata.CriteriaOpRegex:             true,
+				nvdata.CriteriaOpNotRegex:          true,
 			},
 			Name:               share.ExtractModuleName(PolicyLabelsPolicyURI),
 			Module:             PolicyLabelsPolicyURI,
 			ApplicableResource: ResourceWorkload,
+			Polarity:           share.PolarityRejectOnMatch,
 		},
 		criteriaNegationMap: map[string]string{
 			nvdata.CriteriaOpContainsAll:       "doesNotContainAllOf",
@@ -64,3 +67,16 @@ func (h *LabelsPolicyHandler) BuildPolicySettings(criteria []*nvapis.RESTAdmRule
 	}
 	return settingsBytes, nil
 }
+
+// RequiresCELPolicy returns true for the regex operators and the key=value or wildcard values,
+// which aren't supported by the labels policy.
+func (h *LabelsPolicyHandler) RequiresCELPolicy(criterion *nvapis.RESTAdmRuleCriterion) bool {
+	return requiresMapPatternMatching(criterion)
+}
+
+// BuildCELValidations builds the validations matching the workload labels against the criteria.
+func (h *LabelsPolicyHandler) BuildCELValidations(
+	criteria []*nvapis.RESTAdmRuleCriterion,
+) ([]share.CELValidation, error) {
+	return buildMapValidations(criteria, celLabelsVar, "labels")
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/resources"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/share"
+)
+
+// podSpecKinds are the kinds the modules validating the pod spec read it from, at the default pod template
+// path of their kind. The Rego policies of the custom criteria read it the same way.
+var podSpecKinds = []string{
+	"Pod", "Deployment", "ReplicaSet", "StatefulSet", "DaemonSet", "ReplicationController", "Job", "CronJob",
+}
+
+// moduleKinds are the kinds of the resources the built-in modules handle, by module name. The modules
+// validating the metadata handle any kind, and the CEL policy reads the pod spec at the pod template path
+// of the resources, so they aren't listed.
+var moduleKinds = map[string][]string{
+	share.ExtractModuleName(PolicyAllowPrivEscalationURI):    podSpecKinds,
+	share.ExtractModuleName(PolicyContainerResourceURI):      podSpecKinds,
+	share.ExtractModuleName(PolicyContainerRunningAsUserURI): podSpecKinds,
+	share.ExtractModuleName(PolicyEnvSecretScannerURI):       podSpecKinds,
+	share.ExtractModuleName(PolicyEnvironmentVariableURI):    podSpecKinds,
+	share.ExtractModuleName(PolicyHighRiskServiceAccountURI): podSpecKinds,
+	share.ExtractModuleName(PolicyHostNamespacesPSPURI):      podSpecKinds,
+	share.ExtractModuleName(ImageCVEPolicyURI):               podSpecKinds,
+	share.ExtractModuleName(PolicyPodPrivilegedURI):          podSpecKinds,
+	share.ExtractModuleName(PolicyTrustedReposPolicyURI):     podSpecKinds,
+	share.ExtractModuleName(PolicyPVCStorageClassURI):        {"PersistentVolumeClaim"},
+}
+
+// CheckModuleResources checks the module can handle the resources the policy applies to. The modules
+// mirroring a built-in module are checked as the built-in module, the other modules, such as the modules
+// of the handler plugins, can't be checked.
+func CheckModuleResources(module string, policyResources []resources.Resource) error {
+	kinds, ok := moduleKinds[share.ExtractModuleName(module)]
+	if !ok {
+		return nil
+	}
+	return checkResourceKinds(module, kinds, policyResources)
+}
+
+// CheckRegoModuleResources checks the module built from the Rego policy of the custom criteria can handle
+// the resources the policy applies to.
+func CheckRegoModuleResources(module string, policyResources []resources.Resource) error {
+	return checkResourceKinds(module, podSpecKinds, policyResources)
+}
+
+func checkResourceKinds(module string, kinds []string, policyResources []resources.Resource) error {
+	for _, resource := range policyResources {
+		if !slices.Contains(kinds, resource.Kind) {
+			return fmt.Errorf("module %s can't handle the %s kind of the %s resource, supported kinds are %v",
+				module, resource.Kind, resource.Resource, kinds)
+		}
+		if resource.HasCustomTemplatePath() {
+			return fmt.Errorf("module %s can't read the pod template of the %s resource at %s",
+				module, resource.Resource, resource.PodTemplatePath)
+		}
+	}
+	return nil
+}
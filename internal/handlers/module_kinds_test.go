@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/resources"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckModuleResources(t *testing.T) {
+	rollout := resources.Resource{
+		APIGroup:   "argoproj.io",
+		APIVersion: "v1alpha1",
+		Resource:   "rollouts",
+		Kind:       "Rollout",
+	}
+	deployment := resources.Resource{
+		APIGroup:        "apps",
+		APIVersion:      "v1",
+		Resource:        "deployments",
+		Kind:            "Deployment",
+		PodTemplatePath: "spec.workload.template",
+	}
+	workloads := resources.DefaultCatalog()[resources.TypeWorkload]
+
+	tests := []struct {
+		name                  string
+		module                string
+		resources             []resources.Resource
+		expectedErrorContains string
+	}{
+		{
+			name:      "pod spec module with the default workloads",
+			module:    PolicyPodPrivilegedURI,
+			resources: workloads,
+		},
+		{
+			name:      "mirrored pod spec module with the default workloads",
+			module:    "registry://registry.internal:5000/kw/pod-privileged:v1.0.3",
+			resources: workloads,
+		},
+		{
+			name:                  "pod spec module with a custom resource",
+			module:                PolicyPodPrivilegedURI,
+			resources:             append(workloads, rollout),
+			expectedErrorContains: "can't handle the Rollout kind of the rollouts resource",
+		},
+		{
+			name:                  "pod spec module with a custom pod template path",
+			module:                PolicyTrustedReposPolicyURI,
+			resources:             []resources.Resource{deployment},
+			expectedErrorContains: "can't read the pod template of the deployments resource at spec.workload.template",
+		},
+		{
+			name:                  "pvc module with the workloads",
+			module:                PolicyPVCStorageClassURI,
+			resources:             workloads,
+			expectedErrorContains: "can't handle the Pod kind of the pods resource",
+		},
+		{
+			name:      "metadata module with a custom resource",
+			module:    PolicyLabelsPolicyURI,
+			resources: []resources.Resource{rollout},
+		},
+		{
+			name:      "CEL policy with a custom pod template path",
+			module:    PolicyCELPolicyURI,
+			resources: []resources.Resource{rollout, deployment},
+		},
+		{
+			name:      "unknown module",
+			module:    "registry://ghcr.io/acme/policies/rollouts:v1.0.0",
+			resources: []resources.Resource{rollout},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckModuleResources(tt.module, tt.resources)
+			if tt.expectedErrorContains != "" {
+				require.ErrorContains(t, err, tt.expectedErrorContains)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+
+	require.NoError(t, CheckRegoModuleResources("registry://ghcr.io/acme/policies/nv-rule-1001:v0.1.0", workloads))
+	require.ErrorContains(t,
+		CheckRegoModuleResources("registry://ghcr.io/acme/policies/nv-rule-1001:v0.1.0", []resources.Resource{rollout}),
+		"can't handle the Rollout kind",
+	)
+}
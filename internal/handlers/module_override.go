@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/share"
+)
+
+// ParseModuleOverride parses a "name=uri" module override, the name is the module name of the URI,
+// for example pod-privileged=registry://ghcr.io/kubewarden/policies/pod-privileged:v1.0.2.
+func ParseModuleOverride(override string) (string, string, error) {
+	name, uri, ok := strings.Cut(override, "=")
+	name = strings.TrimSpace(name)
+	uri = strings.TrimSpace(uri)
+	if !ok || name == "" || uri == "" {
+		return "", "", fmt.Errorf("invalid module override %q, expected name=uri", override)
+	}
+	return ModuleOverrideKey(name), uri, nil
+}
+
+// ModuleOverrideKey returns the key of the module overrides for a module name, as share.ExtractModuleName.
+func ModuleOverrideKey(name string) string {
+	return strings.ReplaceAll(name, "-", "_")
+}
+
+// CheckModuleOverride checks the module overriding a built-in module can be checked to accept the settings
+// generated for it. The override must be a version of the same module whose settings schema is embedded in the
+// catalog: the settings of the policies are validated against the schema of their module version. Another module
+// needs its own settings, declared by a handler plugin.
+func CheckModuleOverride(module string, override string) error {
+	if _, err := moduleSettingsSchema(override); err != nil {
+		return err
+	}
+	if share.ExtractModuleName(module) != share.ExtractModuleName(override) {
+		return fmt.Errorf(
+			"module %s is not known compatible with the settings of %s, declare it with a handler plugin instead",
+			override, module,
+		)
+	}
+
+	_, ok, err := lookupSettingsSchema(override)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("module %s has no settings schema to check its settings compatibility, "+
+			"the versions with a settings schema are %s", override, strings.Join(settingsSchemaVersions(module), ", "))
+	}
+	return nil
+}
+
+// moduleSettingsSchema returns the versions of the module sharing its settings format: v<major>,
+// or v0.<minor> for the v0 modules.
+func moduleSettingsSchema(module string) (string, error) {
+	idx := strings.LastIndex(module, ":")
+	if idx == -1 || strings.Contains(module[idx:], "/") || strings.Contains(module, "@") {
+		return "", fmt.Errorf("module %s has no version tag to check its settings compatibility", module)
+	}
+
+	version := strings.Split(strings.TrimPrefix(module[idx+1:], "v"), ".")
+	if len(version) < 2 || version[0] == "" || version[1] == "" {
+		return "", fmt.Errorf("module %s has no semantic version tag to check its settings compatibility", module)
+	}
+	if version[0] == "0" {
+		return "v0." + version[1], nil
+	}
+	return "v" + version[0], nil
+}
+
+// OverrideModule replaces the module of the handler, once checked compatible with the settings of its module.
+func (h *BasePolicyHandler) OverrideModule(module string) error {
+	if err := CheckModuleOverride(h.Module, module); err != nil {
+		return err
+	}
+
+	h.Module = module
+	return nil
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseModuleOverride(t *testing.T) {
+	name, uri, err := ParseModuleOverride("pod-privileged=registry://ghcr.io/kubewarden/policies/pod-privileged:v1.0.2")
+	require.NoError(t, err)
+	require.Equal(t, "pod_privileged", name)
+	require.Equal(t, "registry://ghcr.io/kubewarden/policies/pod-privileged:v1.0.2", uri)
+
+	_, _, err = ParseModuleOverride("registry://ghcr.io/kubewarden/policies/pod-privileged:v1.0.2")
+	require.ErrorContains(t, err, "expected name=uri")
+}
+
+func TestCheckModuleOverride(t *testing.T) {
+	tests := []struct {
+		name          string
+		module        string
+		override      string
+		expectedError string
+	}{
+		{
+			name:     "older patch version",
+			module:   PolicyPodPrivilegedURI,
+			override: "registry://ghcr.io/kubewarden/policies/pod-privileged:v1.0.2",
+		},
+		{
+			name:     "same version from another registry",
+			module:   PolicyPodPrivilegedURI,
+			override: "registry://registry.internal:5000/kubewarden/pod-privileged:v1.0.3",
+		},
+		{
+			name:     "older version of a v0 module",
+			module:   ImageCVEPolicyURI,
+			override: "registry://ghcr.io/kubewarden/policies/image-cve-policy:v0.5.0",
+		},
+		{
+			name:          "major version bump",
+			module:        PolicyPodPrivilegedURI,
+			override:      "registry://ghcr.io/kubewarden/policies/pod-privileged:v2.0.0",
+			expectedError: "the versions with a settings schema are v1.x",
+		},
+		{
+			name:          "minor version bump of a v0 module",
+			module:        ImageCVEPolicyURI,
+			override:      "registry://ghcr.io/kubewarden/policies/image-cve-policy:v0.6.0",
+			expectedError: "the versions with a settings schema are v0.5.x",
+		},
+		{
+			name:          "another module",
+			module:        PolicyPodPrivilegedURI,
+			override:      PolicyCELPolicyURI,
+			expectedError: "declare it with a handler plugin instead",
+		},
+		{
+			name:          "no version tag",
+			module:        PolicyPodPrivilegedURI,
+			override:      "registry://registry.internal:5000/kubewarden/pod-privileged",
+			expectedError: "has no version tag",
+		},
+		{
+			name:          "latest tag",
+			module:        PolicyPodPrivilegedURI,
+			override:      "registry://ghcr.io/kubewarden/policies/pod-privileged:latest",
+			expectedError: "no semantic version tag",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckModuleOverride(tt.module, tt.override)
+			if tt.expectedError == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tt.expectedError)
+		})
+	}
+}
+
+func TestCheckModuleOverride_SettingsSchema(t *testing.T) {
+	catalog, err := settingsSchemaCatalog()
+	require.NoError(t, err)
+
+	// A version of the module with another settings schema, requiring a setting
+	v2Schema, err := jsonschema.CompileString("schemas/pod_privileged_v2.json", `{
+		"type": "object",
+		"properties": {"allowed_containers": {"type": "array"}},
+		"required": ["allowed_containers"]
+	}`)
+	require.NoError(t, err)
+	withV2 := map[string]*jsonschema.Schema{"schemas/pod_privileged_v2.json": v2Schema}
+	for name, schema := range catalog {
+		withV2[name] = schema
+	}
+	previous := settingsSchemaCatalog
+	settingsSchemaCatalog = func() (map[string]*jsonschema.Schema, error) { return withV2, nil }
+	t.Cleanup(func() { settingsSchemaCatalog = previous })
+
+	override := "registry://ghcr.io/kubewarden/policies/pod-privileged:v2.0.0"
+	require.NoError(t, CheckModuleOverride(PolicyPodPrivilegedURI, override))
+
+	handler := NewPodPrivilegedHandler()
+	require.NoError(t, handler.OverrideModule(override))
+	settings, err := handler.BuildPolicySettings(nil)
+	require.NoError(t, err)
+	require.ErrorContains(t, ValidateSettings(handler.GetModule(), settings),
+		"invalid settings of module "+override+": /: missing properties: 'allowed_containers'")
+	require.NoError(t, ValidateSettings(PolicyPodPrivilegedURI, settings))
+}
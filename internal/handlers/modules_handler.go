@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	policiesv1 "github.com/kubewarden/adm-controller/api/policies/v1"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/share"
+	nvapis "github.com/neuvector/neuvector/controller/api"
+	nvdata "github.com/neuvector/neuvector/share"
+)
+
+const (
+	// ModulesPolicyURI is empty because there is no Kubewarden module checking the image packages yet,
+	// rules using this criterion are converted to a Rego policy instead.
+	ModulesPolicyURI = ""
+
+	RuleModules = "modules"
+)
+
+// ModulesHandler handles the modules criterion, which checks the packages installed in the images.
+// The packages are read from the SBOMscanner vulnerability reports, so only the vulnerable packages are known.
+type ModulesHandler struct {
+	BasePolicyHandler
+
+	// criteriaNegationMap maps criteria operations to their negated forms for deny-action neuvector rule conversion.
+	// Since converter only support deny actions, positive criteria must be converted to negative counterparts.
+	criteriaNegationMap map[string]string
+	vulReportNamespace  string
+	platform            string
+}
+
+type modulesRegoInput struct {
+	sbomscannerRegoInput
+
+	Criteria string
+	Values   string
+}
+
+// modulesRegoTemplate denies the workloads whose image packages don't satisfy the negated NeuVector criterion.
+// The accept rules are named after the values of criteriaNegationMap.
+const modulesRegoTemplate = `package kubernetes.admission
+
+# Generated from NeuVector admission rule #{{ .RuleID }} (modules).
+# The policy must be deployed with the following context aware resource:
+#   - apiVersion: storage.sbomscanner.kubewarden.io/v1alpha1
+#     kind: VulnerabilityReport
+
+deny[msg] {
+{{- template "namespaceConditions" . }}
+	container := _containers[_]
+	report := _reports[_]
+	_report_matches_image(report, container.image)
+	packages := {p | p := report.report.results[_].vulnerabilities[_].packageName}
+	not {{ .Criteria }}(packages)
+	msg := sprintf("Denied by NeuVector rule #{{ .RuleID }}: image %s packages violate the modules criterion", [container.image])
+}
+
+_values := {{ .Values }}
+{{ if eq .Criteria "doesNotContainAnyOf" }}
+doesNotContainAnyOf(packages) {
+	count(packages & _values) == 0
+}
+{{ else if eq .Criteria "doesNotContainAllOf" }}
+doesNotContainAllOf(packages) {
+	count(_values - packages) > 0
+}
+{{ else if eq .Criteria "doesNotContainOtherThan" }}
+doesNotContainOtherThan(packages) {
+	count(packages - _values) == 0
+}
+{{ else if eq .Criteria "containsAnyOf" }}
+containsAnyOf(packages) {
+	count(packages & _values) > 0
+}
+{{ end }}
+{{- template "sbomscannerHelpers" . }}
+`
+
+func NewModulesHandler(vulReportNamespace string, platform string) *ModulesHandler {
+	return &ModulesHandler{
+		BasePolicyHandler: BasePolicyHandler{
+			Unsupported: false,
+			SupportedOps: map[string]bool{
+				nvdata.CriteriaOpContainsAll:       true,
+				nvdata.CriteriaOpContainsAny:       true,
+				nvdata.CriteriaOpContainsOtherThan: true,
+				nvdata.CriteriaOpNotContainsAny:    true,
+			},
+			Name:               RuleModules,
+			Module:             ModulesPolicyURI,
+			ApplicableResource: ResourceWorkload,
+			ContextAwareResources: []policiesv1.ContextAwareResource{
+				{
+					Kind:       "VulnerabilityReport",
+					APIVersion: "storage.sbomscanner.kubewarden.io/v1alpha1",
+				},
+			},
+			Polarity: share.PolarityRejectOnMatch,
+		},
+		criteriaNegationMap: map[string]string{
+			nvdata.CriteriaOpContainsAll:       "doesNotContainAllOf",
+			nvdata.CriteriaOpContainsAny:       "doesNotContainAnyOf",
+			nvdata.CriteriaOpContainsOtherThan: "doesNotContainOtherThan",
+			nvdata.CriteriaOpNotContainsAny:    "containsAnyOf",
+		},
+		vulReportNamespace: vulReportNamespace,
+		platform:           platform,
+	}
+}
+
+func (h *ModulesHandler) parseCriteria(criteria []*nvapis.RESTAdmRuleCriterion) (string, []string, error) {
+	if len(criteria) != 1 {
+		return "", nil, errors.New("only one criterion is allowed")
+	}
+
+	criterion := criteria[0]
+	negationCriteria, ok := h.criteriaNegationMap[criterion.Op]
+	if !ok {
+		return "", nil, fmt.Errorf("unsupported criteria operator: %s", criterion.Op)
+	}
+
+	values := make([]string, 0)
+	for _, value := range strings.Split(criterion.Value, ",") {
+		trimmed := strings.TrimSpace(value)
+		if trimmed != "" {
+			values = append(values, trimmed)
+		}
+	}
+	return negationCriteria, values, nil
+}
+
+// BuildPolicySettings fails, the criterion has no Kubewarden module: it's enforced by the policy of BuildRegoPolicy.
+func (h *ModulesHandler) BuildPolicySettings(_ []*nvapis.RESTAdmRuleCriterion) ([]byte, error) {
+	return nil, fmt.Errorf("no Kubewarden module for %s, it requires a Rego policy", RuleModules)
+}
+
+// RequiresRegoPolicy returns true as long as there is no Kubewarden module for this criterion.
+func (h *ModulesHandler) RequiresRegoPolicy() bool {
+	return h.Module == ""
+}
+
+// BuildRegoPolicy builds a context aware Rego policy that rejects workloads whose images
+// vulnerable packages match the NeuVector modules criterion.
+func (h *ModulesHandler) BuildRegoPolicy(
+	rule *nvapis.RESTAdmissionRule,
+	criteria []*nvapis.RESTAdmRuleCriterion,
+) (string, error) {
+	negationCriteria, values, err := h.parseCriteria(criteria)
+	if err != nil {
+		return "", err
+	}
+
+	regoValues, err := regoStringSet(values)
+	if err != nil {
+		return "", err
+	}
+
+	input, err := newSbomscannerRegoInput(rule, h.vulReportNamespace)
+	if err != nil {
+		return "", err
+	}
+
+	return renderRegoTemplate("modulesRego", modulesRegoTemplate, modulesRegoInput{
+		sbomscannerRegoInput: input,
+		Criteria:             negationCriteria,
+		Values:               regoValues,
+	})
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+
+	nvapis "github.com/neuvector/neuvector/controller/api"
+	nvdata "github.com/neuvector/neuvector/share"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildModulesPolicySettings(t *testing.T) {
+	handler := NewModulesHandler("sbomscanner", "amd64")
+
+	_, err := handler.BuildPolicySettings([]*nvapis.RESTAdmRuleCriterion{
+		{Name: RuleModules, Op: nvdata.CriteriaOpContainsAny, Value: "openssl, busybox"},
+	})
+	require.EqualError(t, err, "no Kubewarden module for modules, it requires a Rego policy")
+}
+
+func TestBuildModulesRegoPolicy(t *testing.T) {
+	handler := NewModulesHandler("sbomscanner", "amd64")
+	require.True(t, handler.RequiresRegoPolicy())
+
+	tests := []struct {
+		op               string
+		expectedCriteria string
+		expectedRule     string
+	}{
+		{nvdata.CriteriaOpContainsAll, "doesNotContainAllOf", "count(_values - packages) > 0"},
+		{nvdata.CriteriaOpContainsAny, "doesNotContainAnyOf", "count(packages & _values) == 0"},
+		{nvdata.CriteriaOpContainsOtherThan, "doesNotContainOtherThan", "count(packages - _values) == 0"},
+		{nvdata.CriteriaOpNotContainsAny, "containsAnyOf", "count(packages & _values) > 0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.op, func(t *testing.T) {
+			regoCode, err := handler.BuildRegoPolicy(
+				&nvapis.RESTAdmissionRule{ID: 1000},
+				[]*nvapis.RESTAdmRuleCriterion{{Name: RuleModules, Op: tt.op, Value: "apk-tools,musl"}},
+			)
+			require.NoError(t, err)
+			require.Contains(t, regoCode, fmt.Sprintf("not %s(packages)", tt.expectedCriteria))
+			require.Contains(t, regoCode, fmt.Sprintf("%s(packages) {\n\t%s\n}", tt.expectedCriteria, tt.expectedRule))
+			require.Contains(t, regoCode, `_values := {"apk-tools", "musl"}`)
+			require.Contains(t, regoCode, `data.kubernetes.vulnerabilityreports["sbomscanner"][_]`)
+		})
+	}
+}
+
+func TestBuildModulesRegoPolicy_UnsupportedOperator(t *testing.T) {
+	handler := NewModulesHandler("sbomscanner", "amd64")
+
+	_, err := handler.BuildRegoPolicy(&nvapis.RESTAdmissionRule{ID: 1000}, []*nvapis.RESTAdmRuleCriterion{
+		{Name: RuleModules, Op: nvdata.CriteriaOpRegex, Value: "openssl"},
+	})
+	require.Equal(t, fmt.Errorf("unsupported criteria operator: %s", nvdata.CriteriaOpRegex), err)
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	policiesv1 "github.com/kubewarden/adm-controller/api/policies/v1"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/policyserver"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/share"
+	nvapis "github.com/neuvector/neuvector/controller/api"
+	"sigs.k8s.io/yaml"
+)
+
+// The polarities of the plugin modules, the decision of the module on the resources matching the criterion.
+const (
+	PluginPolarityRejectOnMatch = "rejectOnMatch"
+	PluginPolarityAcceptOnMatch = "acceptOnMatch"
+)
+
+// PluginSpec declares the Kubewarden module enforcing a criterion, it's the content of a handler plugin file.
+//
+// The polarity is required: rejectOnMatch for a module rejecting the resources matching the criterion, or
+// acceptOnMatch for a module accepting only the resources matching it.
+//
+// The settings template is a Go template rendering the policy settings as YAML or JSON. It's executed
+// with the criteria mapped to the module, the fields of the first criterion are available at the top level:
+//
+//	settings: |
+//	  {{- if eq .Op "containsAny" }}
+//	  denied: {{ toJson .Values }}
+//	  {{- else }}
+//	  allowed: {{ toJson .Values }}
+//	  {{- end }}
+type PluginSpec struct {
+	Criterion             string                            `json:"criterion"`
+	Module                string                            `json:"module"`
+	Ops                   []string                          `json:"ops"`
+	Polarity              string                            `json:"polarity"`
+	ApplicableResource    string                            `json:"applicableResource,omitempty"`
+	ContextAwareResources []policiesv1.ContextAwareResource `json:"contextAwareResources,omitempty"`
+	Settings              string                            `json:"settings,omitempty"`
+}
+
+// PluginHandler is a policy handler declared by a plugin file instead of Go code.
+type PluginHandler struct {
+	BasePolicyHandler
+
+	criterion string
+	settings  *template.Template
+}
+
+// pluginCriterion is a criterion as seen by the settings template.
+type pluginCriterion struct {
+	Name        string
+	Op          string
+	Path        string
+	Value       string
+	Values      []string
+	SubCriteria []pluginCriterion
+}
+
+// pluginSettingsData is the data of the settings template.
+type pluginSettingsData struct {
+	pluginCriterion
+
+	Criteria []pluginCriterion
+}
+
+var pluginTemplateFuncs = template.FuncMap{
+	"toJson": func(value any) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+	"split": func(value string, sep string) []string {
+		return strings.Split(value, sep)
+	},
+	"trim": strings.TrimSpace,
+}
+
+// NewPluginHandler returns the handler declared by the plugin spec.
+func NewPluginHandler(spec PluginSpec) (*PluginHandler, error) {
+	if spec.Criterion == "" {
+		return nil, errors.New("missing criterion")
+	}
+	if spec.Module == "" {
+		return nil, errors.New("missing module")
+	}
+	if len(spec.Ops) == 0 {
+		return nil, errors.New("missing supported ops")
+	}
+
+	var polarity share.Polarity
+	switch spec.Polarity {
+	case "":
+		return nil, errors.New("missing polarity")
+	case PluginPolarityRejectOnMatch:
+		polarity = share.PolarityRejectOnMatch
+	case PluginPolarityAcceptOnMatch:
+		polarity = share.PolarityAcceptOnMatch
+	default:
+		return nil, fmt.Errorf("invalid polarity: %s. Allowed values are \"%s\" or \"%s\"",
+			spec.Polarity, PluginPolarityRejectOnMatch, PluginPolarityAcceptOnMatch)
+	}
+
+	switch spec.ApplicableResource {
+	case "":
+		spec.ApplicableResource = ResourceWorkload
+	case ResourceWorkload, ResourcePVC:
+	default:
+		return nil, fmt.Errorf("invalid applicable resource: %s. Allowed values are \"%s\" or \"%s\"",
+			spec.ApplicableResource, ResourceWorkload, ResourcePVC)
+	}
+
+	for _, resource := range spec.ContextAwareResources {
+		if _, err := policyserver.ResourceName(resource); err != nil {
+			return nil, fmt.Errorf("invalid context aware resources: %w", err)
+		}
+	}
+
+	settings, err := template.New(spec.Criterion).Funcs(pluginTemplateFuncs).Option("missingkey=error").
+		Parse(spec.Settings)
+	if err != nil {
+		return nil, fmt.Errorf("invalid settings template: %w", err)
+	}
+
+	supportedOps := make(map[string]bool, len(spec.Ops))
+	for _, op := range spec.Ops {
+		supportedOps[op] = true
+	}
+
+	return &PluginHandler{
+		BasePolicyHandler: BasePolicyHandler{
+			Unsupported:           false,
+			SupportedOps:          supportedOps,
+			Name:                  share.ExtractModuleName(spec.Module),
+			ApplicableResource:    spec.ApplicableResource,
+			Module:                spec.Module,
+			ContextAwareResources: spec.ContextAwareResources,
+			Polarity:              polarity,
+		},
+		criterion: spec.Criterion,
+		settings:  settings,
+	}, nil
+}
+
+// LoadPluginHandlers loads the handler plugins of the directory, the *.yaml and *.yml files.
+// The handlers are returned by criterion name, a criterion can only be declared once.
+func LoadPluginHandlers(dir string) (map[string]*PluginHandler, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read handlers directory: %w", err)
+	}
+
+	pluginHandlers := map[string]*PluginHandler{}
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read handler plugin %s: %w", path, err)
+		}
+
+		var spec PluginSpec
+		if err = yaml.UnmarshalStrict(data, &spec); err != nil {
+			return nil, fmt.Errorf("failed to decode handler plugin %s: %w", path, err)
+		}
+
+		handler, err := NewPluginHandler(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid handler plugin %s: %w", path, err)
+		}
+		if _, exists := pluginHandlers[spec.Criterion]; exists {
+			return nil, fmt.Errorf("invalid handler plugin %s: criterion %s already declared", path, spec.Criterion)
+		}
+		pluginHandlers[spec.Criterion] = handler
+	}
+	return pluginHandlers, nil
+}
+
+func (h *PluginHandler) BuildPolicySettings(criteria []*nvapis.RESTAdmRuleCriterion) ([]byte, error) {
+	if len(criteria) == 0 {
+		return nil, errors.New("no criterion to build the settings from")
+	}
+
+	data := pluginSettingsData{Criteria: newPluginCriteria(criteria)}
+	data.pluginCriterion = data.Criteria[0]
+
+	var settings bytes.Buffer
+	if err := h.settings.Execute(&settings, data); err != nil {
+		return nil, fmt.Errorf("failed to render the settings of %s: %w", h.criterion, err)
+	}
+
+	if len(bytes.TrimSpace(settings.Bytes())) == 0 {
+		return []byte("{}"), nil
+	}
+	settingsJSON, err := yaml.YAMLToJSON(settings.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("invalid settings rendered for %s: %w", h.criterion, err)
+	}
+	return settingsJSON, nil
+}
+
+func newPluginCriteria(criteria []*nvapis.RESTAdmRuleCriterion) []pluginCriterion {
+	pluginCriteria := make([]pluginCriterion, 0, len(criteria))
+	for _, criterion := range criteria {
+		values := strings.Split(criterion.Value, ",")
+		for idx := range values {
+			values[idx] = strings.TrimSpace(values[idx])
+		}
+		values = slices.DeleteFunc(values, func(value string) bool { return value == "" })
+
+		pluginCriteria = append(pluginCriteria, pluginCriterion{
+			Name:        criterion.Name,
+			Op:          criterion.Op,
+			Path:        criterion.Path,
+			Value:       criterion.Value,
+			Values:      values,
+			SubCriteria: newPluginCriteria(criterion.SubCriteria),
+		})
+	}
+	return pluginCriteria
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	policiesv1 "github.com/kubewarden/adm-controller/api/policies/v1"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/share"
+	nvapis "github.com/neuvector/neuvector/controller/api"
+	nvdata "github.com/neuvector/neuvector/share"
+	"github.com/stretchr/testify/require"
+)
+
+const testPlugin = `criterion: teamLabel
+module: registry://ghcr.io/acme/policies/team-label:v1.0.0
+ops: [containsAny, notContainsAny]
+polarity: rejectOnMatch
+contextAwareResources:
+- apiVersion: v1
+  kind: Namespace
+settings: |
+  {{- if eq .Op "containsAny" }}
+  denied: {{ toJson .Values }}
+  {{- else }}
+  allowed: {{ toJson .Values }}
+  {{- end }}
+`
+
+func TestLoadPluginHandlers(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "team_label.yaml"), []byte(testPlugin), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("not a plugin"), 0600))
+
+	pluginHandlers, err := LoadPluginHandlers(dir)
+	require.NoError(t, err)
+	require.Len(t, pluginHandlers, 1)
+
+	handler := pluginHandlers["teamLabel"]
+	require.NotNil(t, handler)
+	require.Equal(t, "registry://ghcr.io/acme/policies/team-label:v1.0.0", handler.GetModule())
+	require.Equal(t, ResourceWorkload, handler.GetApplicableResource())
+	require.Equal(t, map[string]bool{
+		nvdata.CriteriaOpContainsAny:    true,
+		nvdata.CriteriaOpNotContainsAny: true,
+	}, handler.GetSupportedOps())
+	require.Equal(t, []policiesv1.ContextAwareResource{{APIVersion: "v1", Kind: "Namespace"}},
+		handler.GetContextAwareResources())
+	require.Equal(t, share.PolarityRejectOnMatch, handler.GetPolarity())
+}
+
+func TestPluginHandler_BuildPolicySettings(t *testing.T) {
+	var spec PluginSpec
+	spec.Criterion = "teamLabel"
+	spec.Module = "registry://ghcr.io/acme/policies/team-label:v1.0.0"
+	spec.Ops = []string{nvdata.CriteriaOpContainsAny, nvdata.CriteriaOpNotContainsAny}
+	spec.Polarity = PluginPolarityRejectOnMatch
+
+	tests := []struct {
+		name             string
+		settings         string
+		criterion        *nvapis.RESTAdmRuleCriterion
+		expectedSettings string
+		expectedError    string
+	}{
+		{
+			name: "yaml settings",
+			settings: `{{- if eq .Op "containsAny" }}
+denied: {{ toJson .Values }}
+{{- else }}
+allowed: {{ toJson .Values }}
+{{- end }}`,
+			criterion: &nvapis.RESTAdmRuleCriterion{
+				Name:  "teamLabel",
+				Op:    nvdata.CriteriaOpNotContainsAny,
+				Value: "alpha, beta",
+			},
+			expectedSettings: `{"allowed":["alpha","beta"]}`,
+		},
+		{
+			name:     "json settings with the criteria list",
+			settings: `{"teams": [{{ range $i, $c := .Criteria }}{{ if $i }},{{ end }}{{ toJson $c.Value }}{{ end }}]}`,
+			criterion: &nvapis.RESTAdmRuleCriterion{
+				Name:  "teamLabel",
+				Op:    nvdata.CriteriaOpContainsAny,
+				Value: "alpha",
+			},
+			expectedSettings: `{"teams":["alpha"]}`,
+		},
+		{
+			name: "empty settings",
+			criterion: &nvapis.RESTAdmRuleCriterion{
+				Name: "teamLabel",
+				Op:   nvdata.CriteriaOpContainsAny,
+			},
+			expectedSettings: `{}`,
+		},
+		{
+			name:     "invalid rendered settings",
+			settings: `denied: [{{ .Value }}`,
+			criterion: &nvapis.RESTAdmRuleCriterion{
+				Name:  "teamLabel",
+				Op:    nvdata.CriteriaOpContainsAny,
+				Value: "alpha",
+			},
+			expectedError: "invalid settings rendered for teamLabel",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec.Settings = tt.settings
+			handler, err := NewPluginHandler(spec)
+			require.NoError(t, err)
+
+			settings, err := handler.BuildPolicySettings([]*nvapis.RESTAdmRuleCriterion{tt.criterion})
+			if tt.expectedError != "" {
+				require.ErrorContains(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			require.JSONEq(t, tt.expectedSettings, string(settings))
+		})
+	}
+}
+
+func TestNewPluginHandler_InvalidSpec(t *testing.T) {
+	tests := []struct {
+		name          string
+		spec          PluginSpec
+		expectedError string
+	}{
+		{
+			name:          "missing criterion",
+			spec:          PluginSpec{Module: "registry://m:v1", Ops: []string{"="}},
+			expectedError: "missing criterion",
+		},
+		{
+			name:          "missing module",
+			spec:          PluginSpec{Criterion: "c", Ops: []string{"="}},
+			expectedError: "missing module",
+		},
+		{
+			name:          "missing ops",
+			spec:          PluginSpec{Criterion: "c", Module: "registry://m:v1"},
+			expectedError: "missing supported ops",
+		},
+		{
+			name:          "missing polarity",
+			spec:          PluginSpec{Criterion: "c", Module: "registry://m:v1", Ops: []string{"="}},
+			expectedError: "missing polarity",
+		},
+		{
+			name: "invalid polarity",
+			spec: PluginSpec{
+				Criterion: "c", Module: "registry://m:v1", Ops: []string{"="}, Polarity: "reject",
+			},
+			expectedError: "invalid polarity: reject",
+		},
+		{
+			name: "invalid applicable resource",
+			spec: PluginSpec{
+				Criterion: "c", Module: "registry://m:v1", Ops: []string{"="}, Polarity: PluginPolarityRejectOnMatch,
+				ApplicableResource: "service",
+			},
+			expectedError: "invalid applicable resource: service",
+		},
+		{
+			name: "unknown context aware resource",
+			spec: PluginSpec{
+				Criterion: "c", Module: "registry://m:v1", Ops: []string{"="}, Polarity: PluginPolarityRejectOnMatch,
+				ContextAwareResources: []policiesv1.ContextAwareResource{
+					{APIVersion: "example.com/v1", Kind: "Widget"},
+				},
+			},
+			expectedError: "invalid context aware resources: unknown context aware resource Widget of example.com/v1",
+		},
+		{
+			name: "invalid settings template",
+			spec: PluginSpec{
+				Criterion: "c", Module: "registry://m:v1", Ops: []string{"="}, Polarity: PluginPolarityRejectOnMatch,
+				Settings: "{{ .Op",
+			},
+			expectedError: "invalid settings template",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewPluginHandler(tt.spec)
+			require.ErrorContains(t, err, tt.expectedError)
+		})
+	}
+}
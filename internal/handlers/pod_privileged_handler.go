@@ -23,6 +23,7 @@ func NewPodPrivilegedHandler() *PodPrivilegedHandler {
 			Name:               share.ExtractModuleName(PolicyPodPrivilegedURI),
 			ApplicableResource: ResourceWorkload,
 			Module:             PolicyPodPrivilegedURI,
+			Polarity:           share.PolarityRejectOnMatch,
 		},
 	}
 }
@@ -4,13 +4,14 @@ import (
 	"errors"
 
 	policiesv1 "github.com/kubewarden/adm-controller/api/policies/v1"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/resources"
 	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/share"
 	nvapis "github.com/neuvector/neuvector/controller/api"
 )
 
 const (
-	ResourcePVC      = "pvc"
-	ResourceWorkload = "workload"
+	ResourcePVC      = resources.TypePVC
+	ResourceWorkload = resources.TypeWorkload
 )
 
 // BasePolicyHandler provides base implementation for PolicyHandler interface.
@@ -21,6 +22,9 @@ type BasePolicyHandler struct {
 	ApplicableResource    string
 	SupportedOps          map[string]bool
 	ContextAwareResources []policiesv1.ContextAwareResource
+	// Polarity is the decision of the module on the resources matching the criterion. The namespace criteria
+	// scope the policies instead, they have none.
+	Polarity share.Polarity
 }
 
 func (h *BasePolicyHandler) Validate(rule *nvapis.RESTAdmRuleCriterion) error {
@@ -55,3 +59,7 @@ func (h *BasePolicyHandler) GetApplicableResource() string {
 func (h *BasePolicyHandler) GetContextAwareResources() []policiesv1.ContextAwareResource {
 	return h.ContextAwareResources
 }
+
+func (h *BasePolicyHandler) GetPolarity() share.Polarity {
+	return h.Polarity
+}
@@ -30,6 +30,7 @@ func NewPVCStorageClassHandler() *PVCStorageClassHandler {
 			Name:               share.ExtractModuleName(PolicyPVCStorageClassURI),
 			ApplicableResource: ResourcePVC,
 			Module:             PolicyPVCStorageClassURI,
+			Polarity:           share.PolarityRejectOnMatch,
 		},
 	}
 }
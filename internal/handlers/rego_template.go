@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/share"
+	nvapis "github.com/neuvector/neuvector/controller/api"
+	nvdata "github.com/neuvector/neuvector/share"
+)
+
+// sbomscannerRegoHelpers defines the Rego rules shared by the policies reading the SBOMscanner
+// reports exposed through the Kubewarden context aware resources.
+// The namespace criteria of the rule are checked by the policy itself, a deny rule applies in the namespaces of
+// every criterion: the namespaceConditions template lists their conditions in the deny rule body.
+const sbomscannerRegoHelpers = `{{ define "namespaceConditions" }}
+{{- range $index, $criterion := .NamespaceCriteria }}
+	{{ if $criterion.Excluded }}not {{ end }}_in_namespaces_{{ $index }}
+{{- end }}
+{{- end }}
+{{ define "sbomscannerHelpers" }}
+{{- range $index, $criterion := .NamespaceCriteria }}
+{{- if $criterion.Names }}
+_in_namespaces_{{ $index }} {
+	input.request.namespace == {{ $criterion.Names }}[_]
+}
+{{ end }}
+{{- if $criterion.Patterns }}
+_in_namespaces_{{ $index }} {
+	regex.match({{ $criterion.Patterns }}[_], input.request.namespace)
+}
+{{ end }}
+{{- end }}
+_reports[report] {
+	report := data.kubernetes.vulnerabilityreports["{{ .VulReportNamespace }}"][_]
+}
+
+_report_matches_image(report, image) {
+	metadata := report.imageMetadata
+	_normalized_image(image) == sprintf("%s/%s:%s", [metadata.registryURI, metadata.repository, metadata.tag])
+}
+
+_report_matches_image(report, image) {
+	metadata := report.imageMetadata
+	_normalized_image(image) == sprintf("%s/%s@%s", [metadata.registryURI, metadata.repository, metadata.digest])
+}
+
+_report_matches_image(report, image) {
+	metadata := report.imageMetadata
+	normalized := _normalized_image(image)
+	normalized == sprintf("%s/%s:%s@%s", [metadata.registryURI, metadata.repository, metadata.tag, metadata.digest])
+}
+
+# The images are normalized with the Docker Hub registry prefix and the latest tag
+_normalized_image(image) = normalized {
+	normalized := _image_with_tag(_image_with_registry(image))
+}
+
+_image_with_registry(image) = image {
+	_is_registry_host(split(image, "/")[0])
+	contains(image, "/")
+} else = concat("/", ["docker.io", image]) {
+	contains(image, "/")
+} else = concat("/", ["docker.io", "library", image]) {
+	true
+}
+
+_is_registry_host(host) {
+	contains(host, ".")
+}
+
+_is_registry_host(host) {
+	contains(host, ":")
+}
+
+_is_registry_host(host) {
+	host == "localhost"
+}
+
+_image_with_tag(image) = image {
+	contains(image, "@")
+} else = image {
+	parts := split(image, "/")
+	contains(parts[count(parts) - 1], ":")
+} else = concat(":", [image, "latest"]) {
+	true
+}
+{{ range .ContainerFields }}
+_containers[container] {
+	container := _get_input("get").spec.{{ . }}[_]
+}
+{{ end }}
+_get_input(w) := x {
+	w == "get"
+	supportedKind := ["Deployment", "DaemonSet", "Job", "ReplicaSet", "ReplicationController", "StatefulSet"]
+	input.request.kind.kind == supportedKind[_]
+	x := input.request.object.spec.template
+}
+
+_get_input(w) := x {
+	w == "get"
+	input.request.kind.kind == "CronJob"
+	x := input.request.object.spec.jobTemplate.spec.template
+}
+
+_get_input(w) := x {
+	w == "get"
+	input.request.kind.kind == "Pod"
+	x := input.request.object
+}
+{{- end }}`
+
+// sbomscannerRegoInput holds the values used by the sbomscannerHelpers template.
+type sbomscannerRegoInput struct {
+	RuleID             uint32
+	VulReportNamespace string
+	ContainerFields    []string
+	NamespaceCriteria  []regoNamespaceCriterion
+}
+
+// regoNamespaceCriterion holds the namespaces of a namespace criterion, as Rego sets: the names are compared to
+// the request namespace, and the patterns of the values with wildcards are matched against it as NeuVector does.
+type regoNamespaceCriterion struct {
+	Excluded bool
+	Names    string
+	Patterns string
+}
+
+// newSbomscannerRegoInput returns the values of the sbomscannerHelpers template for the rule.
+func newSbomscannerRegoInput(rule *nvapis.RESTAdmissionRule, vulReportNamespace string) (sbomscannerRegoInput, error) {
+	input := sbomscannerRegoInput{
+		RuleID:             rule.ID,
+		VulReportNamespace: vulReportNamespace,
+		ContainerFields:    containerFields(rule.Containers),
+	}
+
+	for _, criterion := range rule.Criteria {
+		if criterion.Name != RuleNamespace {
+			continue
+		}
+
+		var names, patterns []string
+		for _, value := range strings.Split(criterion.Value, ",") {
+			value = strings.TrimSpace(value)
+			switch {
+			case value == "":
+			case share.HasWildcard(value):
+				patterns = append(patterns, share.ConvertToRegexPattern(value))
+			default:
+				names = append(names, value)
+			}
+		}
+
+		namespaceCriterion := regoNamespaceCriterion{Excluded: criterion.Op == nvdata.CriteriaOpNotContainsAny}
+		var err error
+		if len(names) > 0 {
+			if namespaceCriterion.Names, err = regoStringSet(names); err != nil {
+				return sbomscannerRegoInput{}, err
+			}
+		}
+		if len(patterns) > 0 {
+			if namespaceCriterion.Patterns, err = regoStringSet(patterns); err != nil {
+				return sbomscannerRegoInput{}, err
+			}
+		}
+		input.NamespaceCriteria = append(input.NamespaceCriteria, namespaceCriterion)
+	}
+	return input, nil
+}
+
+func renderRegoTemplate(name string, text string, data any) (string, error) {
+	tmpl, err := template.New(name).Parse(sbomscannerRegoHelpers)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse rego helpers template: %w", err)
+	}
+
+	tmpl, err = tmpl.Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse rego template: %w", err)
+	}
+
+	var regoCode bytes.Buffer
+	if err = tmpl.Execute(&regoCode, data); err != nil {
+		return "", fmt.Errorf("failed to render rego template: %w", err)
+	}
+
+	return regoCode.String(), nil
+}
+
+// regoStringSet formats the values as a Rego set of strings.
+func regoStringSet(values []string) (string, error) {
+	if len(values) == 0 {
+		return "set()", nil
+	}
+
+	items := make([]string, 0, len(values))
+	for _, value := range values {
+		item, err := json.Marshal(value)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal rego value %q: %w", value, err)
+		}
+		items = append(items, string(item))
+	}
+	return fmt.Sprintf("{%s}", strings.Join(items, ", ")), nil
+}
+
+// containerFields maps the NeuVector rule containers option to the pod spec fields to inspect.
+func containerFields(containers []string) []string {
+	if len(containers) == 0 {
+		return []string{"containers"}
+	}
+
+	fields := make([]string, 0, len(containers))
+	for _, container := range containers {
+		switch container {
+		case nvdata.AdmCtrlRuleContainers:
+			fields = append(fields, "containers")
+		case nvdata.AdmCtrlRuleInitContainers:
+			fields = append(fields, "initContainers")
+		case nvdata.AdmCtrlRuleEphemeralContainers:
+			fields = append(fields, "ephemeralContainers")
+		}
+	}
+	return fields
+}
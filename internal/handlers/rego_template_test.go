@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	nvapis "github.com/neuvector/neuvector/controller/api"
+	nvdata "github.com/neuvector/neuvector/share"
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/rego"
+	"github.com/open-policy-agent/opa/v1/storage/inmem"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSbomscannerRegoHelpers_ImageNormalization(t *testing.T) {
+	regoCode, err := NewModulesHandler("sbomscanner", "amd64").BuildRegoPolicy(
+		&nvapis.RESTAdmissionRule{ID: 1000},
+		[]*nvapis.RESTAdmRuleCriterion{{Name: RuleModules, Op: nvdata.CriteriaOpContainsAny, Value: "musl"}},
+	)
+	require.NoError(t, err)
+
+	// The report of the nginx image of Docker Hub, listing a vulnerable musl package
+	store := inmem.NewFromObject(map[string]any{
+		"kubernetes": map[string]any{
+			"vulnerabilityreports": map[string]any{
+				"sbomscanner": map[string]any{
+					"nginx": map[string]any{
+						"imageMetadata": map[string]any{
+							"registryURI": "docker.io",
+							"repository":  "library/nginx",
+							"tag":         "latest",
+							"digest":      "sha256:abc",
+						},
+						"report": map[string]any{
+							"results": []any{
+								map[string]any{"vulnerabilities": []any{map[string]any{"packageName": "musl"}}},
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+
+	tests := []struct {
+		image        string
+		expectedDeny bool
+	}{
+		{image: "nginx", expectedDeny: true},
+		{image: "library/nginx", expectedDeny: true},
+		{image: "nginx:latest", expectedDeny: true},
+		{image: "docker.io/library/nginx", expectedDeny: true},
+		{image: "docker.io/library/nginx:latest@sha256:abc", expectedDeny: true},
+		{image: "nginx@sha256:abc", expectedDeny: true},
+		{image: "nginx:1.27", expectedDeny: false},
+		{image: "registry.my-corp.com/library/nginx", expectedDeny: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			input := map[string]any{
+				"request": map[string]any{
+					"kind": map[string]any{"kind": "Pod"},
+					"object": map[string]any{
+						"spec": map[string]any{
+							"containers": []any{map[string]any{"name": "app", "image": tt.image}},
+						},
+					},
+				},
+			}
+			results, err := rego.New(
+				rego.Query("data.kubernetes.admission.deny"),
+				rego.Module("policy.rego", regoCode),
+				rego.SetRegoVersion(ast.RegoV0),
+				rego.Store(store),
+				rego.Input(input),
+			).Eval(context.Background())
+			require.NoError(t, err)
+			require.Len(t, results, 1)
+
+			denies, ok := results[0].Expressions[0].Value.([]any)
+			require.True(t, ok)
+			require.Equal(t, tt.expectedDeny, len(denies) > 0)
+		})
+	}
+}
+
+func TestSbomscannerRegoHelpers_NamespaceCriteria(t *testing.T) {
+	store := inmem.NewFromObject(map[string]any{
+		"kubernetes": map[string]any{
+			"vulnerabilityreports": map[string]any{
+				"sbomscanner": map[string]any{
+					"nginx": map[string]any{
+						"imageMetadata": map[string]any{
+							"registryURI": "docker.io",
+							"repository":  "library/nginx",
+							"tag":         "latest",
+						},
+						"report": map[string]any{
+							"results": []any{map[string]any{"secrets": []any{map[string]any{"ruleID": "aws"}}}},
+						},
+					},
+				},
+			},
+		},
+	})
+
+	tests := []struct {
+		name               string
+		namespaceCriterion *nvapis.RESTAdmRuleCriterion
+		namespace          string
+		expectedDeny       bool
+	}{
+		{
+			name:               "without namespace criterion",
+			namespaceCriterion: nil,
+			namespace:          "default",
+			expectedDeny:       true,
+		},
+		{
+			name: "namespace contained",
+			namespaceCriterion: &nvapis.RESTAdmRuleCriterion{
+				Name: RuleNamespace, Op: nvdata.CriteriaOpContainsAny, Value: "team-a, dev-*",
+			},
+			namespace:    "team-a",
+			expectedDeny: true,
+		},
+		{
+			name: "namespace matching a pattern",
+			namespaceCriterion: &nvapis.RESTAdmRuleCriterion{
+				Name: RuleNamespace, Op: nvdata.CriteriaOpContainsAny, Value: "team-a, dev-*",
+			},
+			namespace:    "dev-1",
+			expectedDeny: true,
+		},
+		{
+			name: "namespace not contained",
+			namespaceCriterion: &nvapis.RESTAdmRuleCriterion{
+				Name: RuleNamespace, Op: nvdata.CriteriaOpContainsAny, Value: "team-a, dev-*",
+			},
+			namespace:    "default",
+			expectedDeny: false,
+		},
+		{
+			name: "namespace excluded",
+			namespaceCriterion: &nvapis.RESTAdmRuleCriterion{
+				Name: RuleNamespace, Op: nvdata.CriteriaOpNotContainsAny, Value: "kube-*",
+			},
+			namespace:    "kube-system",
+			expectedDeny: false,
+		},
+		{
+			name: "namespace not excluded",
+			namespaceCriterion: &nvapis.RESTAdmRuleCriterion{
+				Name: RuleNamespace, Op: nvdata.CriteriaOpNotContainsAny, Value: "kube-*",
+			},
+			namespace:    "default",
+			expectedDeny: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			criteria := []*nvapis.RESTAdmRuleCriterion{
+				{Name: RuleImageCompliance, Op: nvdata.CriteriaOpEqual, Value: "true"},
+			}
+			rule := &nvapis.RESTAdmissionRule{ID: 1000, Criteria: criteria}
+			if tt.namespaceCriterion != nil {
+				rule.Criteria = append(rule.Criteria, tt.namespaceCriterion)
+			}
+			regoCode, err := NewImageComplianceHandler("sbomscanner", "amd64").BuildRegoPolicy(rule, criteria)
+			require.NoError(t, err)
+
+			input := map[string]any{
+				"request": map[string]any{
+					"kind":      map[string]any{"kind": "Pod"},
+					"namespace": tt.namespace,
+					"object": map[string]any{
+						"spec": map[string]any{
+							"containers": []any{map[string]any{"name": "app", "image": "nginx"}},
+						},
+					},
+				},
+			}
+			results, err := rego.New(
+				rego.Query("data.kubernetes.admission.deny"),
+				rego.Module("policy.rego", regoCode),
+				rego.SetRegoVersion(ast.RegoV0),
+				rego.Store(store),
+				rego.Input(input),
+			).Eval(context.Background())
+			require.NoError(t, err)
+			require.Len(t, results, 1)
+
+			denies, ok := results[0].Expressions[0].Value.([]any)
+			require.True(t, ok)
+			require.Equal(t, tt.expectedDeny, len(denies) > 0)
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/share"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// settingsSchemas is the catalog of the settings JSON Schema of the modules referenced by the handlers.
+// The schemas are named after the module and the versions sharing its settings format, as
+// <module_name>_<schema>.json, for example pod_privileged_v1.json or annotations_v0.1.json.
+//
+//go:embed schemas/*.json
+var settingsSchemas embed.FS
+
+// settingsSchemaCatalog returns the compiled settings schemas of the catalog, by file name.
+var settingsSchemaCatalog = sync.OnceValues(compileSettingsSchemas)
+
+// HasSettingsSchema returns true if the catalog has the settings schema of the module version.
+func HasSettingsSchema(module string) bool {
+	_, ok, err := lookupSettingsSchema(module)
+	return ok && err == nil
+}
+
+// ValidateSettings validates the settings of the module against its settings schema. The settings of the
+// modules missing from the catalog, such as the handler plugins and the custom modules, are not validated.
+// The validation errors are reported with the JSON pointer of the invalid settings.
+func ValidateSettings(module string, settings []byte) error {
+	schema, ok, err := lookupSettingsSchema(module)
+	if err != nil || !ok {
+		return err
+	}
+
+	if len(bytes.TrimSpace(settings)) == 0 {
+		settings = []byte("{}")
+	}
+	decoder := json.NewDecoder(bytes.NewReader(settings))
+	decoder.UseNumber()
+	var value any
+	if err = decoder.Decode(&value); err != nil {
+		return fmt.Errorf("invalid settings of module %s: %w", module, err)
+	}
+
+	var validationErr *jsonschema.ValidationError
+	if err = schema.Validate(value); errors.As(err, &validationErr) {
+		return fmt.Errorf("invalid settings of module %s: %s", module,
+			strings.Join(settingsErrors(validationErr), "; "))
+	}
+	return err
+}
+
+// lookupSettingsSchema returns the settings schema of the module version, if the catalog has it.
+func lookupSettingsSchema(module string) (*jsonschema.Schema, bool, error) {
+	catalog, err := settingsSchemaCatalog()
+	if err != nil {
+		return nil, false, err
+	}
+	name, ok := settingsSchemaFile(module)
+	if !ok {
+		return nil, false, nil
+	}
+	schema, ok := catalog[name]
+	return schema, ok, nil
+}
+
+// compileSettingsSchemas compiles the settings schemas of the catalog.
+func compileSettingsSchemas() (map[string]*jsonschema.Schema, error) {
+	names, err := fs.Glob(settingsSchemas, "schemas/*.json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list settings schemas: %w", err)
+	}
+
+	catalog := make(map[string]*jsonschema.Schema, len(names))
+	for _, name := range names {
+		data, err := settingsSchemas.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read settings schema %s: %w", name, err)
+		}
+		schema, err := jsonschema.CompileString(name, string(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid settings schema %s: %w", name, err)
+		}
+		catalog[name] = schema
+	}
+	return catalog, nil
+}
+
+// settingsSchemaFile returns the catalog file of the settings schema of the module, the modules without
+// semantic version tag have none.
+func settingsSchemaFile(module string) (string, bool) {
+	schema, err := moduleSettingsSchema(module)
+	if err != nil {
+		return "", false
+	}
+	return fmt.Sprintf("schemas/%s_%s.json", share.ExtractModuleName(module), schema), true
+}
+
+// settingsSchemaVersions returns the versions of the module with a settings schema in the catalog, such as v1.x.
+func settingsSchemaVersions(module string) []string {
+	catalog, err := settingsSchemaCatalog()
+	if err != nil {
+		return nil
+	}
+
+	prefix := fmt.Sprintf("schemas/%s_", share.ExtractModuleName(module))
+	var versions []string
+	for name := range catalog {
+		if schema, ok := strings.CutPrefix(name, prefix); ok {
+			versions = append(versions, strings.TrimSuffix(schema, ".json")+".x")
+		}
+	}
+	slices.Sort(versions)
+	return versions
+}
+
+// settingsErrors returns the leaf errors of the validation error, prefixed with their JSON pointer.
+func settingsErrors(validationErr *jsonschema.ValidationError) []string {
+	if len(validationErr.Causes) == 0 {
+		pointer := validationErr.InstanceLocation
+		if pointer == "" {
+			pointer = "/"
+		}
+		return []string{fmt.Sprintf("%s: %s", pointer, validationErr.Message)}
+	}
+
+	var errs []string
+	for _, cause := range validationErr.Causes {
+		errs = append(errs, settingsErrors(cause)...)
+	}
+	return errs
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHasSettingsSchema_BuiltinModules(t *testing.T) {
+	modules := []string{
+		PolicyAllowPrivEscalationURI,
+		PolicyAnnotationsPolicyURI,
+		PolicyCELPolicyURI,
+		PolicyContainerResourceURI,
+		PolicyContainerRunningAsUserURI,
+		PolicyEnvSecretScannerURI,
+		PolicyEnvironmentVariableURI,
+		PolicyHighRiskServiceAccountURI,
+		PolicyHostNamespacesPSPURI,
+		ImageCVEPolicyURI,
+		PolicyLabelsPolicyURI,
+		PolicyPVCStorageClassURI,
+		PolicyPodPrivilegedURI,
+		PolicyTrustedReposPolicyURI,
+	}
+
+	for _, module := range modules {
+		assert.True(t, HasSettingsSchema(module), "missing settings schema of %s", module)
+	}
+	assert.False(t, HasSettingsSchema("registry://ghcr.io/acme/policies/team-label:v1.0.0"))
+	assert.False(t, HasSettingsSchema("registry://ghcr.io/kubewarden/policies/pod-privileged:latest"))
+}
+
+func TestValidateSettings(t *testing.T) {
+	tests := []struct {
+		name          string
+		module        string
+		settings      string
+		expectedError string
+	}{
+		{
+			name:     "valid settings",
+			module:   PolicyTrustedReposPolicyURI,
+			settings: `{"images": {"reject": ["nginx"]}, "registries": {"allow": ["docker.io"]}}`,
+		},
+		{
+			name:     "empty settings",
+			module:   PolicyPodPrivilegedURI,
+			settings: ``,
+		},
+		{
+			name:          "invalid nested settings",
+			module:        PolicyTrustedReposPolicyURI,
+			settings:      `{"images": {"reject": "nginx"}}`,
+			expectedError: "/images/reject: expected array, but got string",
+		},
+		{
+			name:          "unknown setting",
+			module:        PolicyPodPrivilegedURI,
+			settings:      `{"privileged": true}`,
+			expectedError: "/: additionalProperties 'privileged' not allowed",
+		},
+		{
+			name:          "missing required setting",
+			module:        PolicyLabelsPolicyURI,
+			settings:      `{"criteria": "containsAnyOf", "values": []}`,
+			expectedError: "/values: minimum 1 items required, but found 0 items",
+		},
+		{
+			name:          "compatible module version",
+			module:        "registry://registry.internal/policies/pod-privileged:v1.2.0",
+			settings:      `{"privileged": true}`,
+			expectedError: "invalid settings of module registry://registry.internal/policies/pod-privileged:v1.2.0",
+		},
+		{
+			name:     "module without settings schema",
+			module:   "registry://ghcr.io/acme/policies/team-label:v1.0.0",
+			settings: `{"anything": true}`,
+		},
+		{
+			name:          "invalid JSON",
+			module:        PolicyPodPrivilegedURI,
+			settings:      `{`,
+			expectedError: "invalid settings of module " + PolicyPodPrivilegedURI,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSettings(tt.module, []byte(tt.settings))
+			if tt.expectedError == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tt.expectedError)
+		})
+	}
+}
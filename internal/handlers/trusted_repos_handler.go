@@ -3,6 +3,7 @@ package handlers
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/share"
@@ -15,6 +16,8 @@ const (
 
 	RuleImageRegistry = "imageRegistry"
 	RuleImage         = "image"
+
+	dockerHubRegistry = "docker.io"
 )
 
 // TrustedReposHandler handles trusted repository policies.
@@ -29,10 +32,13 @@ func NewTrustedReposHandler() *TrustedReposHandler {
 			SupportedOps: map[string]bool{
 				nvdata.CriteriaOpContainsAny:    true,
 				nvdata.CriteriaOpNotContainsAny: true,
+				nvdata.CriteriaOpRegex:          true,
+				nvdata.CriteriaOpNotRegex:       true,
 			},
 			Name:               share.ExtractModuleName(PolicyTrustedReposPolicyURI),
 			Module:             PolicyTrustedReposPolicyURI,
 			ApplicableResource: ResourceWorkload,
+			Polarity:           share.PolarityRejectOnMatch,
 		},
 	}
 }
@@ -73,7 +79,11 @@ func (h *TrustedReposHandler) BuildPolicySettings(criteria []*nvapis.RESTAdmRule
 			if settings["registries"] == nil {
 				settings["registries"] = make(map[string][]string)
 			}
-			settings["registries"][operator] = strings.Split(criterion.Value, ",")
+			registries, err := normalizeRegistries(criterion.Value)
+			if err != nil {
+				return nil, err
+			}
+			settings["registries"][operator] = registries
 		case RuleImage:
 			if settings["images"] == nil {
 				settings["images"] = make(map[string][]string)
@@ -90,3 +100,246 @@ func (h *TrustedReposHandler) BuildPolicySettings(criteria []*nvapis.RESTAdmRule
 	}
 	return settingsBytes, nil
 }
+
+// RequiresCELPolicy returns true for the regex operators, the wildcard values and the registries with a path,
+// which aren't supported by the trusted repos policy.
+func (h *TrustedReposHandler) RequiresCELPolicy(criterion *nvapis.RESTAdmRuleCriterion) bool {
+	return isRegexOp(criterion.Op) || share.HasWildcard(criterion.Value) || hasRegistryPath(criterion)
+}
+
+// BuildCELValidations builds the validations matching the container images or registries against the criteria.
+// The images are normalized (docker.io/library prefix and latest tag) before being matched.
+func (h *TrustedReposHandler) BuildCELValidations(
+	criteria []*nvapis.RESTAdmRuleCriterion,
+) ([]share.CELValidation, error) {
+	validations := make([]share.CELValidation, 0, len(criteria))
+	for _, criterion := range criteria {
+		var (
+			validation share.CELValidation
+			err        error
+		)
+		if isRegexOp(criterion.Op) {
+			validation, err = h.buildRegexValidation(criterion)
+		} else {
+			validation, err = h.buildWildcardValidation(criterion)
+		}
+		if err != nil {
+			return nil, err
+		}
+		validations = append(validations, validation)
+	}
+	return validations, nil
+}
+
+// ConversionWarnings returns the values whose meaning is altered by the normalization.
+func (h *TrustedReposHandler) ConversionWarnings(criterion *nvapis.RESTAdmRuleCriterion) []string {
+	if isRegexOp(criterion.Op) {
+		return nil
+	}
+
+	var warnings []string
+	for _, value := range splitValues(criterion.Value) {
+		if criterion.Name == RuleImage && share.HasWildcard(value) {
+			_, warning := imagePattern(value)
+			warnings = appendWarning(warnings, warning)
+		}
+	}
+	return warnings
+}
+
+// buildRegexValidation builds the validation of a regex criterion.
+// The regex operator rejects the workloads with a container matching the pattern and the !regex operator
+// the ones with a container not matching it.
+func (h *TrustedReposHandler) buildRegexValidation(criterion *nvapis.RESTAdmRuleCriterion) (share.CELValidation, error) {
+	pattern, err := celRegexPattern(criterion)
+	if err != nil {
+		return share.CELValidation{}, err
+	}
+
+	// The registries are matched on the normalized images, the images on the container images as they are
+	var all, field, kind string
+	switch criterion.Name {
+	case RuleImageRegistry:
+		all, field, kind = celImagesVar+".all(i, %s)", "i.split('/')[0]", "registries"
+	case RuleImage:
+		all, field, kind = celContainersVar+".all(c, %s)", "c.image", "images"
+	default:
+		return share.CELValidation{}, fmt.Errorf("unsupported criterion: %s", criterion.Name)
+	}
+
+	match := fmt.Sprintf("%s.matches(%s)", field, pattern)
+	if criterion.Op == nvdata.CriteriaOpRegex {
+		return share.CELValidation{
+			Expression: fmt.Sprintf(all, "!"+match),
+			Message:    fmt.Sprintf("%s matching %s are not allowed", kind, pattern),
+		}, nil
+	}
+	return share.CELValidation{
+		Expression: fmt.Sprintf(all, match),
+		Message:    fmt.Sprintf("%s not matching %s are not allowed", kind, pattern),
+	}, nil
+}
+
+// buildWildcardValidation builds the validation of a set criterion whose values contain wildcards or registry
+// paths, the exact values of the criterion are matched too. The registries without path are matched on the host
+// of the images, the ones with a path on the repositories of the images under the path.
+func (h *TrustedReposHandler) buildWildcardValidation(
+	criterion *nvapis.RESTAdmRuleCriterion,
+) (share.CELValidation, error) {
+	values := splitValues(criterion.Value)
+	if len(values) == 0 {
+		return share.CELValidation{}, fmt.Errorf("no value for criterion %s", criterion.Name)
+	}
+
+	var match, kind string
+	switch criterion.Name {
+	case RuleImageRegistry:
+		kind = "registries"
+		var hostPatterns, pathPatterns []string
+		for _, value := range values {
+			host, path := normalizeRegistry(value)
+			if path == "" {
+				hostPatterns = append(hostPatterns, share.ConvertToRegexPattern(host))
+				continue
+			}
+			pattern := strings.TrimSuffix(share.ConvertToRegexPattern(host+"/"+path), "$")
+			pathPatterns = append(pathPatterns, pattern+"/.+$")
+		}
+
+		var matches []string
+		if len(hostPatterns) > 0 {
+			matches = append(matches, celMatches("i.split('/')[0]", hostPatterns))
+		}
+		if len(pathPatterns) > 0 {
+			matches = append(matches, celMatches("i", pathPatterns))
+		}
+		match = strings.Join(matches, " || ")
+		if len(matches) > 1 {
+			match = "(" + match + ")"
+		}
+	case RuleImage:
+		kind = "images"
+		patterns := make([]string, 0, len(values))
+		for _, value := range values {
+			pattern, _ := imagePattern(value)
+			patterns = append(patterns, pattern)
+		}
+		match = celMatches("i", patterns)
+	default:
+		return share.CELValidation{}, fmt.Errorf("unsupported criterion: %s", criterion.Name)
+	}
+
+	switch criterion.Op {
+	case nvdata.CriteriaOpContainsAny:
+		return share.CELValidation{
+			Expression: fmt.Sprintf("%s.all(i, !%s)", celImagesVar, match),
+			Message:    fmt.Sprintf("%s matching any of %q are not allowed", kind, criterion.Value),
+		}, nil
+	case nvdata.CriteriaOpNotContainsAny:
+		return share.CELValidation{
+			Expression: fmt.Sprintf("%s.all(i, %s)", celImagesVar, match),
+			Message:    fmt.Sprintf("%s not matching any of %q are not allowed", kind, criterion.Value),
+		}, nil
+	default:
+		return share.CELValidation{}, fmt.Errorf("unsupported criteria operator for CEL policy: %s", criterion.Op)
+	}
+}
+
+// celMatches returns the CEL expression matching the field against any of the patterns.
+func celMatches(field string, patterns []string) string {
+	return fmt.Sprintf("%s.matches(%s)", field, strconv.Quote(strings.Join(patterns, "|")))
+}
+
+// splitValues splits the comma separated values of a criterion, and trims them.
+func splitValues(input string) []string {
+	var values []string
+	for _, value := range strings.Split(input, ",") {
+		if trimmed := strings.TrimSpace(value); trimmed != "" {
+			values = append(values, trimmed)
+		}
+	}
+	return values
+}
+
+func appendWarning(warnings []string, warning string) []string {
+	if warning == "" {
+		return warnings
+	}
+	return append(warnings, warning)
+}
+
+// normalizeRegistries normalizes the comma separated registries of a criterion. The trusted repos policy only
+// matches the registry hosts, the registries with a path are rejected rather than widened to their host.
+func normalizeRegistries(input string) ([]string, error) {
+	values := splitValues(input)
+	registries := make([]string, 0, len(values))
+	for _, value := range values {
+		registry, path := normalizeRegistry(value)
+		if path != "" {
+			return nil, fmt.Errorf("registry %q with a path requires a CEL policy", value)
+		}
+		registries = append(registries, registry)
+	}
+	return registries, nil
+}
+
+// hasRegistryPath returns true if a registry value of the criterion has a path.
+func hasRegistryPath(criterion *nvapis.RESTAdmRuleCriterion) bool {
+	if criterion.Name != RuleImageRegistry || isRegexOp(criterion.Op) {
+		return false
+	}
+	for _, value := range splitValues(criterion.Value) {
+		if _, path := normalizeRegistry(value); path != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeRegistry splits a NeuVector registry value in its host and path, after removing its scheme, and maps
+// the Docker Hub aliases to docker.io.
+func normalizeRegistry(value string) (string, string) {
+	registry := strings.TrimPrefix(strings.TrimPrefix(value, "https://"), "http://")
+	host, path, _ := strings.Cut(strings.Trim(registry, "/"), "/")
+
+	switch host {
+	case "index.docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+		host = dockerHubRegistry
+	}
+	return host, path
+}
+
+// imagePattern converts a NeuVector image value with wildcards to a regex matching the normalized images.
+// The Docker Hub images are prefixed with docker.io (and library for the official ones), the values without
+// tag or digest match any tag and digest. A warning is returned when the registry of the value can't be
+// determined because of a leading wildcard.
+func imagePattern(value string) (string, string) {
+	name, digest, hasDigest := strings.Cut(value, "@")
+
+	var warning string
+	segments := strings.Split(name, "/")
+	switch {
+	case len(segments) == 1:
+		name = dockerHubRegistry + "/library/" + name
+	case share.HasWildcard(segments[0]):
+		warning = fmt.Sprintf("image %q: the leading wildcard matches any registry and repository path", value)
+	case !strings.ContainsAny(segments[0], ".:") && segments[0] != "localhost":
+		name = dockerHubRegistry + "/" + name
+	}
+
+	normalized := name
+	if hasDigest {
+		normalized += "@" + digest
+	}
+	pattern := strings.TrimSuffix(share.ConvertToRegexPattern(normalized), "$")
+
+	hasTag := strings.Contains(segments[len(segments)-1], ":")
+	switch {
+	case hasDigest:
+	case hasTag:
+		pattern += "(@.+)?"
+	default:
+		pattern += "(:[^/@]+)?(@.+)?"
+	}
+	return pattern + "$", warning
+}
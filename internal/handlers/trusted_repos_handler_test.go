@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"testing"
 
 	nvapis "github.com/neuvector/neuvector/controller/api"
@@ -47,13 +48,118 @@ func TestBuildTrustedReposPolicySettings(t *testing.T) {
 				`{"registries":{"allow":["docker.io","quay.io"]},"images":{"reject":["nginx","redis"]}}`,
 			),
 		},
+		{
+			name: "image registry with scheme and docker hub alias",
+			criteria: []*nvapis.RESTAdmRuleCriterion{
+				{
+					Name:  RuleImageRegistry,
+					Op:    nvdata.CriteriaOpContainsAny,
+					Value: "https://index.docker.io/, quay.io",
+				},
+			},
+			expectedSettings: []byte(`{"registries":{"reject":["docker.io","quay.io"]}}`),
+		},
+		{
+			name: "image registry with a path",
+			criteria: []*nvapis.RESTAdmRuleCriterion{
+				{
+					Name:  RuleImageRegistry,
+					Op:    nvdata.CriteriaOpNotContainsAny,
+					Value: "docker.io,quay.io/myorg",
+				},
+			},
+			expectedError: errors.New(`registry "quay.io/myorg" with a path requires a CEL policy`),
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			generatedSettings, err := handler.BuildPolicySettings(tt.criteria)
-			require.JSONEq(t, string(tt.expectedSettings), string(generatedSettings))
 			require.Equal(t, tt.expectedError, err)
+			if tt.expectedError != nil {
+				return
+			}
+			require.JSONEq(t, string(tt.expectedSettings), string(generatedSettings))
+		})
+	}
+}
+
+func TestImagePattern(t *testing.T) {
+	tests := []struct {
+		value           string
+		expectedPattern string
+		expectedWarning string
+	}{
+		{
+			value:           "nginx:1.2*",
+			expectedPattern: `^docker\.io/library/nginx:1\.2.*(@.+)?$`,
+		},
+		{
+			value:           "bitnami/redis*",
+			expectedPattern: `^docker\.io/bitnami/redis.*(:[^/@]+)?(@.+)?$`,
+		},
+		{
+			value:           "docker.io/library/nginx:*",
+			expectedPattern: `^docker\.io/library/nginx:.*(@.+)?$`,
+		},
+		{
+			value:           "localhost:5000/app@sha256:*",
+			expectedPattern: `^localhost:5000/app@sha256:.*$`,
+		},
+		{
+			value:           "*/busybox",
+			expectedPattern: `^.*/busybox(:[^/@]+)?(@.+)?$`,
+			expectedWarning: `image "*/busybox": the leading wildcard matches any registry and repository path`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			pattern, warning := imagePattern(tt.value)
+			require.Equal(t, tt.expectedPattern, pattern)
+			require.Equal(t, tt.expectedWarning, warning)
+		})
+	}
+}
+
+func TestNormalizeRegistry(t *testing.T) {
+	tests := []struct {
+		value        string
+		expectedHost string
+		expectedPath string
+	}{
+		{value: "quay.io", expectedHost: "quay.io"},
+		{value: "https://index.docker.io/", expectedHost: "docker.io"},
+		{value: "http://registry.my-corp.com:5000", expectedHost: "registry.my-corp.com:5000"},
+		{value: "registry.my-corp.com/team/", expectedHost: "registry.my-corp.com", expectedPath: "team"},
+		{value: "https://index.docker.io/library", expectedHost: "docker.io", expectedPath: "library"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			host, path := normalizeRegistry(tt.value)
+			require.Equal(t, tt.expectedHost, host)
+			require.Equal(t, tt.expectedPath, path)
 		})
 	}
 }
+
+func TestTrustedReposConversionWarnings(t *testing.T) {
+	handler := NewTrustedReposHandler()
+
+	warnings := handler.ConversionWarnings(&nvapis.RESTAdmRuleCriterion{
+		Name:  RuleImage,
+		Op:    nvdata.CriteriaOpContainsAny,
+		Value: "nginx,*/busybox",
+	})
+	require.Equal(t, []string{
+		`image "*/busybox": the leading wildcard matches any registry and repository path`,
+	}, warnings)
+
+	warnings = handler.ConversionWarnings(&nvapis.RESTAdmRuleCriterion{
+		Name:  RuleImageRegistry,
+		Op:    nvdata.CriteriaOpNotContainsAny,
+		Value: "docker.io,quay.io/coreos",
+	})
+	require.Empty(t, warnings)
+}
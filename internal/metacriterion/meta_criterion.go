@@ -5,9 +5,15 @@ import nvapis "github.com/neuvector/neuvector/controller/api"
 // MetaCriterion represents a composite criterion that expands into multiple basic criteria.
 type MetaCriterion interface {
 	// Expand returns the list of basic criteria that this meta criterion represents.
-	// These expanded criteria will replace the original meta criterion in the rule.
+	// These expanded criteria will replace the original meta criterion in the rule, their path is the name of
+	// the meta criterion: the meta criterion matches the resources matching any of them.
 	Expand() []*nvapis.RESTAdmRuleCriterion
 
 	// GetSupportedOps returns a map of supported operators for this criterion
 	GetSupportedOps() map[string]bool
 }
+
+// IsMetaCriterion returns true if the criterion name, or the path of an expanded criterion, is a meta criterion.
+func IsMetaCriterion(name string) bool {
+	return name == RulePSPBestPractices
+}
@@ -32,31 +32,37 @@ func (p *PSPBestPracticeMetaCriterion) Expand() []*nvapis.RESTAdmRuleCriterion {
 			Name:  handlers.RuleShareIPC,
 			Op:    nvdata.CriteriaOpEqual,
 			Value: "true",
+			Path:  RulePSPBestPractices,
 		},
 		{
 			Name:  handlers.RuleShareNetwork,
 			Op:    nvdata.CriteriaOpEqual,
 			Value: "true",
+			Path:  RulePSPBestPractices,
 		},
 		{
 			Name:  handlers.RuleSharePID,
 			Op:    nvdata.CriteriaOpEqual,
 			Value: "true",
+			Path:  RulePSPBestPractices,
 		},
 		{
 			Name:  handlers.RuleRunAsPrivileged,
 			Op:    nvdata.CriteriaOpEqual,
 			Value: "true",
+			Path:  RulePSPBestPractices,
 		},
 		{
 			Name:  handlers.RuleRunAsRoot,
 			Op:    nvdata.CriteriaOpEqual,
 			Value: "true",
+			Path:  RulePSPBestPractices,
 		},
 		{
 			Name:  handlers.RuleAllowPrivilegedEscalation,
 			Op:    nvdata.CriteriaOpEqual,
 			Value: "true",
+			Path:  RulePSPBestPractices,
 		},
 	}
 }
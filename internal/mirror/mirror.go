@@ -0,0 +1,100 @@
+package mirror
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// registryScheme is the scheme of the module URIs pulled from an OCI registry.
+const registryScheme = "registry://"
+
+// Module is a module referenced by the generated policies, with the mirror it's pulled from.
+// The mirror is empty when no registry mirror applies to the module.
+type Module struct {
+	Source string
+	Mirror string
+}
+
+// ParseMirror parses a "registry=mirror" registry mirror, for example ghcr.io=registry.internal:5000.
+// The registry may include a path, to only mirror its repositories: ghcr.io/kubewarden=registry.internal/kw.
+func ParseMirror(mirror string) (string, string, error) {
+	registry, target, ok := strings.Cut(mirror, "=")
+	registry = strings.Trim(strings.TrimSpace(registry), "/")
+	target = strings.Trim(strings.TrimSpace(target), "/")
+	if !ok || registry == "" || target == "" {
+		return "", "", fmt.Errorf("invalid registry mirror %q, expected registry=mirror", mirror)
+	}
+	return strings.TrimPrefix(registry, registryScheme), strings.TrimPrefix(target, registryScheme), nil
+}
+
+// Rewrite returns the module pulled from its registry mirror, the longest matching registry wins.
+// The modules without matching registry, or not pulled from a registry, are returned unchanged.
+func Rewrite(module string, mirrors map[string]string) string {
+	reference, ok := strings.CutPrefix(module, registryScheme)
+	if !ok {
+		return module
+	}
+
+	var matched string
+	for registry := range mirrors {
+		if len(registry) > len(matched) &&
+			(reference == registry || strings.HasPrefix(reference, registry+"/")) {
+			matched = registry
+		}
+	}
+	if matched == "" {
+		return module
+	}
+	return registryScheme + mirrors[matched] + strings.TrimPrefix(reference, matched)
+}
+
+// PullScript returns the shell script seeding the registry mirrors with the modules. The pull step saves the
+// modules to an archive where the upstream registries are reachable, the push step loads the archive and pushes
+// the modules to their mirror.
+func PullScript(modules []Module) string {
+	var sources []string
+	var pushes []string
+	for _, module := range modules {
+		if slices.Contains(sources, module.Source) {
+			continue
+		}
+		sources = append(sources, module.Source)
+		if module.Mirror != "" {
+			pushes = append(pushes, fmt.Sprintf("\tkwctl push %s %s\n", module.Source, module.Mirror))
+		}
+	}
+
+	var script strings.Builder
+	script.WriteString(`#!/bin/sh
+# Seed the registry mirrors with the modules of the generated policies.
+# Run "pull" where the upstream registries are reachable, then "push" with the archive where the mirrors are.
+set -eu
+
+ARCHIVE="${ARCHIVE:-kubewarden-modules.tar.gz}"
+
+pull() {
+`)
+	for _, source := range sources {
+		fmt.Fprintf(&script, "\tkwctl pull %s\n", source)
+	}
+	fmt.Fprintf(&script, "\tkwctl save --output \"$ARCHIVE\" %s\n", strings.Join(sources, " "))
+	script.WriteString(`}
+
+push() {
+	kwctl load --input "$ARCHIVE"
+`)
+	for _, push := range pushes {
+		script.WriteString(push)
+	}
+	script.WriteString(`}
+
+case "${1:-all}" in
+pull) pull ;;
+push) push ;;
+all) pull && push ;;
+*) echo "usage: $0 [pull|push|all]" >&2 && exit 1 ;;
+esac
+`)
+	return script.String()
+}
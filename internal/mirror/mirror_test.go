@@ -0,0 +1,75 @@
+package mirror
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMirror(t *testing.T) {
+	registry, target, err := ParseMirror("ghcr.io/kubewarden/=registry://registry.internal:5000/kw")
+	require.NoError(t, err)
+	require.Equal(t, "ghcr.io/kubewarden", registry)
+	require.Equal(t, "registry.internal:5000/kw", target)
+
+	_, _, err = ParseMirror("ghcr.io")
+	require.ErrorContains(t, err, "expected registry=mirror")
+}
+
+func TestRewrite(t *testing.T) {
+	mirrors := map[string]string{
+		"ghcr.io":                     "registry.internal:5000",
+		"ghcr.io/kubewarden/policies": "registry.internal:5000/kw",
+	}
+
+	tests := []struct {
+		name     string
+		module   string
+		expected string
+	}{
+		{
+			name:     "longest registry prefix",
+			module:   "registry://ghcr.io/kubewarden/policies/pod-privileged:v1.0.3",
+			expected: "registry://registry.internal:5000/kw/pod-privileged:v1.0.3",
+		},
+		{
+			name:     "registry host",
+			module:   "registry://ghcr.io/acme/policies/nv-rule-1000:v0.1.0",
+			expected: "registry://registry.internal:5000/acme/policies/nv-rule-1000:v0.1.0",
+		},
+		{
+			name:     "other registry",
+			module:   "registry://ghcr.iox/acme/policy:v1.0.0",
+			expected: "registry://ghcr.iox/acme/policy:v1.0.0",
+		},
+		{
+			name:     "module not pulled from a registry",
+			module:   "https://example.com/policy.wasm",
+			expected: "https://example.com/policy.wasm",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, Rewrite(tt.module, mirrors))
+		})
+	}
+}
+
+func TestPullScript(t *testing.T) {
+	script := PullScript([]Module{
+		{
+			Source: "registry://ghcr.io/kubewarden/policies/pod-privileged:v1.0.3",
+			Mirror: "registry://registry.internal:5000/kubewarden/policies/pod-privileged:v1.0.3",
+		},
+		{Source: "registry://registry.internal:5000/acme/policy:v1.0.0"},
+	})
+
+	require.Contains(t, script, "\tkwctl pull registry://ghcr.io/kubewarden/policies/pod-privileged:v1.0.3\n")
+	require.Contains(t, script, "\tkwctl pull registry://registry.internal:5000/acme/policy:v1.0.0\n")
+	require.Contains(t, script, `kwctl save --output "$ARCHIVE" `+
+		"registry://ghcr.io/kubewarden/policies/pod-privileged:v1.0.3 registry://registry.internal:5000/acme/policy:v1.0.0\n")
+	require.Contains(t, script, "\tkwctl push registry://ghcr.io/kubewarden/policies/pod-privileged:v1.0.3 "+
+		"registry://registry.internal:5000/kubewarden/policies/pod-privileged:v1.0.3\n")
+	require.NotContains(t, script, "kwctl push registry://registry.internal:5000/acme/policy:v1.0.0")
+}
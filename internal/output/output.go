@@ -0,0 +1,123 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+// Stdout is the output file name printing the conversion output to stdout.
+const Stdout = "-"
+
+// Writer writes the files generated by the conversion, the policies YAML as well as the Rego policies.
+type Writer interface {
+	WriteFile(path string, data []byte) error
+}
+
+// NewWriter returns the writer of the conversion output: the files are only listed in dry-run mode,
+// written to the filesystem otherwise, and the policies are printed to stdout when the output file is "-".
+func NewWriter(outputFile string, dryRun bool) Writer {
+	switch {
+	case dryRun:
+		return &DryRunWriter{Out: os.Stdout}
+	case outputFile == Stdout:
+		return &StreamWriter{Out: os.Stdout, Files: &FileWriter{}}
+	default:
+		return &FileWriter{}
+	}
+}
+
+// WriteObjects writes the objects, the policies or the PolicyServer manifests, as a multi-document YAML file.
+func WriteObjects[T runtime.Object](writer Writer, objects []T, path string) error {
+	var buf bytes.Buffer
+
+	for idx, object := range objects {
+		yamlBytes, err := yaml.Marshal(object)
+		if err != nil {
+			return fmt.Errorf("failed to marshal object at index %d: %w", idx, err)
+		}
+
+		buf.Write(yamlBytes)
+		if idx < len(objects)-1 {
+			buf.WriteString("\n---\n")
+		}
+	}
+
+	return writer.WriteFile(path, buf.Bytes())
+}
+
+// FileWriter writes the files to the filesystem, creating their parent directories.
+type FileWriter struct{}
+
+func (w *FileWriter) WriteFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return fmt.Errorf("failed to create directory of %s: %w", path, err)
+	}
+
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// StreamWriter prints the stdout output to a stream, separated as YAML documents, so that the stream stays valid
+// Kubernetes YAML. The other files, such as the PolicyServer manifests, are written by the files writer; the Rego
+// policies aren't written at all when streaming, the converter skips their rules.
+type StreamWriter struct {
+	Out   io.Writer
+	Files Writer
+
+	written int
+}
+
+func (w *StreamWriter) WriteFile(path string, data []byte) error {
+	if path != Stdout {
+		return w.Files.WriteFile(path, data)
+	}
+
+	if w.written > 0 {
+		if _, err := io.WriteString(w.Out, "\n---\n"); err != nil {
+			return err
+		}
+	}
+	w.written++
+
+	_, err := w.Out.Write(data)
+	return err
+}
+
+// DryRunWriter lists the files which would be written, without writing them.
+type DryRunWriter struct {
+	Out io.Writer
+}
+
+func (w *DryRunWriter) WriteFile(path string, data []byte) error {
+	_, err := fmt.Fprintf(w.Out, "would write %s (%d bytes)\n", path, len(data))
+	return err
+}
+
+// MemoryWriter keeps the files in memory, in the order they're written.
+// A file written twice keeps its first position and its last content.
+type MemoryWriter struct {
+	Paths []string
+	Files map[string][]byte
+}
+
+// NewMemoryWriter returns an empty in-memory writer.
+func NewMemoryWriter() *MemoryWriter {
+	return &MemoryWriter{Files: map[string][]byte{}}
+}
+
+func (w *MemoryWriter) WriteFile(path string, data []byte) error {
+	if _, ok := w.Files[path]; !ok {
+		w.Paths = append(w.Paths, path)
+	}
+	w.Files[path] = slices.Clone(data)
+	return nil
+}
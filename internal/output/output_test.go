@@ -0,0 +1,74 @@
+package output
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestWriteObjects(t *testing.T) {
+	writer := NewMemoryWriter()
+	objects := []*corev1.ServiceAccount{
+		{ObjectMeta: metav1.ObjectMeta{Name: "first"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "second"}},
+	}
+	require.NoError(t, WriteObjects(writer, objects, "policies.yaml"))
+
+	require.Equal(t, "metadata:\n  name: first\n\n---\nmetadata:\n  name: second\n",
+		string(writer.Files["policies.yaml"]))
+}
+
+func TestFileWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rego_policies", "nv_rule_1000.rego")
+
+	writer := &FileWriter{}
+	require.NoError(t, writer.WriteFile(path, []byte("package kubernetes.admission")))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "package kubernetes.admission", string(data))
+}
+
+func TestStreamWriter(t *testing.T) {
+	var out bytes.Buffer
+
+	files := NewMemoryWriter()
+
+	writer := &StreamWriter{Out: &out, Files: files}
+	require.NoError(t, writer.WriteFile(Stdout, []byte("kind: ClusterAdmissionPolicy")))
+	require.NoError(t, writer.WriteFile("rego_policies/nv_rule_1000.rego", []byte("package kubernetes.admission")))
+	require.NoError(t, writer.WriteFile(Stdout, []byte("kind: ClusterAdmissionPolicyGroup")))
+
+	require.Equal(t, "kind: ClusterAdmissionPolicy\n---\nkind: ClusterAdmissionPolicyGroup", out.String())
+	require.Equal(t, []string{"rego_policies/nv_rule_1000.rego"}, files.Paths)
+	require.Equal(t, "package kubernetes.admission", string(files.Files["rego_policies/nv_rule_1000.rego"]))
+}
+
+func TestDryRunWriter(t *testing.T) {
+	t.Chdir(t.TempDir())
+	var out bytes.Buffer
+
+	writer := &DryRunWriter{Out: &out}
+	require.NoError(t, writer.WriteFile("policies.yaml", []byte("kind: ClusterAdmissionPolicy")))
+
+	require.Equal(t, "would write policies.yaml (28 bytes)\n", out.String())
+	require.NoFileExists(t, "policies.yaml")
+}
+
+func TestMemoryWriter(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	writer := NewMemoryWriter()
+	require.NoError(t, writer.WriteFile("rego_policies/nv_rule_1001.rego", []byte("first")))
+	require.NoError(t, writer.WriteFile("rego_policies/nv_rule_1000.rego", []byte("package kubernetes.admission")))
+	require.NoError(t, writer.WriteFile("rego_policies/nv_rule_1001.rego", []byte("second")))
+
+	require.Equal(t, []string{"rego_policies/nv_rule_1001.rego", "rego_policies/nv_rule_1000.rego"}, writer.Paths)
+	require.Equal(t, "second", string(writer.Files["rego_policies/nv_rule_1001.rego"]))
+	require.NoDirExists(t, "rego_policies")
+}
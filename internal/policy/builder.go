@@ -2,29 +2,37 @@ package policy
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/handlers"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/resources"
 	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/share"
 
 	nvapis "github.com/neuvector/neuvector/controller/api"
-	nvdata "github.com/neuvector/neuvector/share"
 
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 const (
 	kwAPIVersion                    = "policies.kubewarden.io/v1"
 	clusterAdmissionPolicyKind      = "ClusterAdmissionPolicy"
 	clusterAdmissionPolicyGroupKind = "ClusterAdmissionPolicyGroup"
+	admissionPolicyKind             = "AdmissionPolicy"
+	admissionPolicyGroupKind        = "AdmissionPolicyGroup"
 	defaultMode                     = "protect"
 )
 
-type Policy interface{} // *policiesv1.ClusterAdmissionPolicy | *policiesv1.ClusterAdmissionPolicyGroup
+// *policiesv1.ClusterAdmissionPolicy | *policiesv1.ClusterAdmissionPolicyGroup |
+// *policiesv1.AdmissionPolicy | *policiesv1.AdmissionPolicyGroup.
+type Policy interface{}
 
 type Builder interface {
-	BuildRules(resources []string) []admissionregistrationv1.RuleWithOperations
+	BuildRules(
+		ruleID uint32,
+		applicableResources []string,
+		config share.ConversionConfig,
+	) []admissionregistrationv1.RuleWithOperations
 
 	// It will be used to generate a single policy or a policy group.
 	GeneratePolicy(rule *nvapis.RESTAdmissionRule, config share.ConversionConfig) (Policy, error)
@@ -32,78 +40,44 @@ type Builder interface {
 
 type BaseBuilder struct{}
 
-// BuildRules determines which Kubernetes resources to apply admission rules to.
-func (b *BaseBuilder) BuildRules(resources []string) []admissionregistrationv1.RuleWithOperations {
-	rules := []admissionregistrationv1.RuleWithOperations{}
-	resourcesMap := make(map[string]struct{}, len(resources))
-	for _, resource := range resources {
+// BuildRules determines which Kubernetes resources to apply admission rules to, from the resources configured
+// for the rule.
+func (b *BaseBuilder) BuildRules(
+	ruleID uint32,
+	applicableResources []string,
+	config share.ConversionConfig,
+) []admissionregistrationv1.RuleWithOperations {
+	return resources.Rules(b.resolveResources(ruleID, applicableResources, config))
+}
+
+// resolveResources returns the resources of the applicable resource types configured for the rule.
+func (b *BaseBuilder) resolveResources(
+	ruleID uint32,
+	applicableResources []string,
+	config share.ConversionConfig,
+) []resources.Resource {
+	var policyResources []resources.Resource
+	resourcesMap := make(map[string]struct{}, len(applicableResources))
+	for _, resourceType := range applicableResources {
 		// Avoid duplicate resources
-		if _, ok := resourcesMap[resource]; ok {
+		if _, ok := resourcesMap[resourceType]; ok {
 			continue
 		}
-		resourcesMap[resource] = struct{}{}
-		switch resource {
-		case handlers.ResourcePVC:
-			rules = append(rules, b.BuildPVCRules()...)
-		case handlers.ResourceWorkload:
-			rules = append(rules, b.BuildWorkloadRules()...)
-		}
-	}
-
-	return rules
-}
-
-func (b *BaseBuilder) BuildPVCRules() []admissionregistrationv1.RuleWithOperations {
-	return []admissionregistrationv1.RuleWithOperations{
-		{
-			Operations: []admissionregistrationv1.OperationType{
-				admissionregistrationv1.Create,
-			},
-			Rule: admissionregistrationv1.Rule{
-				APIGroups:   []string{""},
-				APIVersions: []string{"v1"},
-				Resources:   []string{"persistentvolumeclaims"},
-			},
-		},
+		resourcesMap[resourceType] = struct{}{}
+		policyResources = append(policyResources, config.Resources.Resolve(ruleID, resourceType)...)
 	}
+	return policyResources
 }
 
-func (b *BaseBuilder) BuildWorkloadRules() []admissionregistrationv1.RuleWithOperations {
-	return []admissionregistrationv1.RuleWithOperations{
-		{
-			Operations: []admissionregistrationv1.OperationType{
-				admissionregistrationv1.Create,
-				admissionregistrationv1.Update,
-			},
-			Rule: admissionregistrationv1.Rule{
-				APIGroups:   []string{""},
-				APIVersions: []string{"v1"},
-				Resources:   []string{"pods"},
-			},
-		},
-		{
-			Operations: []admissionregistrationv1.OperationType{
-				admissionregistrationv1.Create,
-				admissionregistrationv1.Update,
-			},
-			Rule: admissionregistrationv1.Rule{
-				APIGroups:   []string{"apps"},
-				APIVersions: []string{"v1"},
-				Resources:   []string{"deployments", "replicasets", "daemonsets", "statefulsets"},
-			},
-		},
-		{
-			Operations: []admissionregistrationv1.OperationType{
-				admissionregistrationv1.Create,
-				admissionregistrationv1.Update,
-			},
-			Rule: admissionregistrationv1.Rule{
-				APIGroups:   []string{"batch"},
-				APIVersions: []string{"v1"},
-				Resources:   []string{"jobs", "cronjobs"},
-			},
-		},
+// checkApplicableResources returns an error if the criteria of a rule apply to different resource types. NeuVector
+// evaluates all the criteria of a rule against the same resource, so no resource matches them all.
+func checkApplicableResources(applicableResources []string) error {
+	types := slices.Compact(slices.Sorted(slices.Values(applicableResources)))
+	if len(types) > 1 {
+		return fmt.Errorf("criteria apply to different resources (%s), no resource matches them all",
+			strings.Join(types, ", "))
 	}
+	return nil
 }
 
 // generatePolicyName generates a unique policy name based on the rule ID.
@@ -125,20 +99,53 @@ func (b *BaseBuilder) getRulelMode(rule *nvapis.RESTAdmissionRule, config share.
 	return defaultMode
 }
 
-func (b *BaseBuilder) buildNamespaceSelector(criterion *nvapis.RESTAdmRuleCriterion) *metav1.LabelSelector {
-	operator := metav1.LabelSelectorOpIn
+// criterionModule returns the module enforcing the criterion, the handlers fall back to the CEL policy
+// for the operators not supported by their module.
+func (b *BaseBuilder) criterionModule(
+	handler share.PolicyHandler,
+	criterion *nvapis.RESTAdmRuleCriterion,
+	config share.ConversionConfig,
+) string {
+	if celHandler, ok := handler.(share.CELPolicyHandler); ok && celHandler.RequiresCELPolicy(criterion) {
+		return b.celPolicyModule(config)
+	}
+	return handler.GetModule()
+}
+
+// celPolicyModule returns the CEL policy module, unless overridden.
+func (b *BaseBuilder) celPolicyModule(config share.ConversionConfig) string {
+	if config.CELPolicyModule != "" {
+		return config.CELPolicyModule
+	}
+	return handlers.PolicyCELPolicyURI
+}
 
-	if criterion.Op == nvdata.CriteriaOpContainsAny {
-		operator = metav1.LabelSelectorOpNotIn
+// buildPolicySettings builds the settings of the module enforcing the criteria of the rule.
+// The CEL policy validations of all the criteria are merged, even if they come from different handlers,
+// and run against the workloads configured for the rule.
+func (b *BaseBuilder) buildPolicySettings(
+	policyHandlers map[string]share.PolicyHandler,
+	module string,
+	ruleID uint32,
+	criteria []*nvapis.RESTAdmRuleCriterion,
+	config share.ConversionConfig,
+) ([]byte, error) {
+	if module != b.celPolicyModule(config) {
+		return policyHandlers[criteria[0].Name].BuildPolicySettings(criteria)
 	}
 
-	return &metav1.LabelSelector{
-		MatchExpressions: []metav1.LabelSelectorRequirement{
-			{
-				Key:      "metadata.namespace",
-				Operator: operator,
-				Values:   strings.Split(criterion.Value, ","),
-			},
-		},
+	var validations []share.CELValidation
+	for _, criterion := range criteria {
+		celHandler, ok := policyHandlers[criterion.Name].(share.CELPolicyHandler)
+		if !ok {
+			return nil, fmt.Errorf("criterion %s cannot be enforced by the CEL policy", criterion.Name)
+		}
+
+		criterionValidations, err := celHandler.BuildCELValidations([]*nvapis.RESTAdmRuleCriterion{criterion})
+		if err != nil {
+			return nil, err
+		}
+		validations = append(validations, criterionValidations...)
 	}
+	return handlers.BuildCELPolicySettings(validations, config.Resources.Resolve(ruleID, resources.TypeWorkload)...)
 }
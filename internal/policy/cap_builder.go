@@ -22,7 +22,7 @@ type CAPBuilder struct {
 }
 
 func (b *CAPBuilder) GeneratePolicy(rule *nvapis.RESTAdmissionRule, config share.ConversionConfig) (Policy, error) {
-	var namespaceSelector *metav1.LabelSelector
+	var namespaceCriteria []*nvapis.RESTAdmRuleCriterion
 	var policyHandler share.PolicyHandler
 	var applicableResources []string
 	var policyCriteria []*nvapis.RESTAdmRuleCriterion
@@ -35,10 +35,7 @@ func (b *CAPBuilder) GeneratePolicy(rule *nvapis.RESTAdmissionRule, config share
 
 		// Handle namespace selector separately
 		if criterion.Name == handlers.RuleNamespace {
-			if namespaceSelector != nil {
-				return nil, errors.New("rule skipped: contains multiple namespace selectors")
-			}
-			namespaceSelector = b.buildNamespaceSelector(criterion)
+			namespaceCriteria = append(namespaceCriteria, criterion)
 			continue
 		}
 
@@ -53,8 +50,15 @@ func (b *CAPBuilder) GeneratePolicy(rule *nvapis.RESTAdmissionRule, config share
 		)
 	}
 
-	// Build policy settings using handler
-	settings, err := policyHandler.BuildPolicySettings(policyCriteria)
+	namespaceSelector, namespaceCondition := b.buildNamespaceScope(namespaceCriteria)
+
+	// Build policy settings using handler, or the CEL policy if the handler module can't enforce the criteria
+	module := b.criterionModule(policyHandler, policyCriteria[0], config)
+	policyResources := b.resolveResources(rule.ID, []string{policyHandler.GetApplicableResource()}, config)
+	if err := handlers.CheckModuleResources(module, policyResources); err != nil {
+		return nil, fmt.Errorf("rule skipped: %w", err)
+	}
+	settings, err := b.buildPolicySettings(b.handlers, module, rule.ID, policyCriteria, config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build policy settings: %w", err)
 	}
@@ -69,10 +73,10 @@ func (b *CAPBuilder) GeneratePolicy(rule *nvapis.RESTAdmissionRule, config share
 		},
 		Spec: policiesv1.ClusterAdmissionPolicySpec{
 			PolicySpec: policiesv1.PolicySpec{
-				Rules:           b.BuildRules(applicableResources),
-				MatchConditions: []admissionregistrationv1.MatchCondition{},
+				Rules:           b.BuildRules(rule.ID, applicableResources, config),
+				MatchConditions: mergeMatchCondition([]admissionregistrationv1.MatchCondition{}, namespaceCondition),
 				Mode:            policiesv1.PolicyMode(b.getRulelMode(rule, config)),
-				Module:          policyHandler.GetModule(),
+				Module:          module,
 				PolicyServer:    config.PolicyServer,
 				BackgroundAudit: config.BackgroundAudit,
 				Settings: runtime.RawExtension{
@@ -8,10 +8,12 @@ import (
 	v1 "github.com/kubewarden/adm-controller/api/policies/v1"
 	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/customrule"
 	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/handlers"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/resources"
 	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/share"
 	nvapis "github.com/neuvector/neuvector/controller/api"
 	nvdata "github.com/neuvector/neuvector/share"
 	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestCAPBuilder_GeneratePolicy(t *testing.T) {
@@ -25,6 +27,8 @@ func TestCAPBuilder_GeneratePolicy(t *testing.T) {
 		expectedSettings   map[string]interface{}
 		expectedMode       string
 		expectedError      error
+
+		expectedNamespaceSelector *metav1.LabelSelector
 	}{
 		{
 			name: "successful policy generation with comment",
@@ -117,7 +121,7 @@ func TestCAPBuilder_GeneratePolicy(t *testing.T) {
 			expectedError: errors.New("no handler found for criterion: shareIpcWithHost"),
 		},
 		{
-			name: "error when handler has multiple namespace selectors",
+			name: "successful policy generation with multiple namespace criteria",
 			rule: &nvapis.RESTAdmissionRule{
 				ID:      1243,
 				Comment: "Test Policy",
@@ -134,7 +138,7 @@ func TestCAPBuilder_GeneratePolicy(t *testing.T) {
 					},
 					{
 						Name:  handlers.RuleNamespace,
-						Op:    nvdata.CriteriaOpContainsAny,
+						Op:    nvdata.CriteriaOpNotContainsAny,
 						Value: "test2",
 					},
 				},
@@ -148,7 +152,20 @@ func TestCAPBuilder_GeneratePolicy(t *testing.T) {
 				handlers.RuleShareIPC:  handlers.NewHostNamespaceHandler(),
 				handlers.RuleNamespace: handlers.NewNamespaceHandler(),
 			},
-			expectedError: errors.New("rule skipped: contains multiple namespace selectors"),
+			expectedPolicyName: "neuvector-rule-1243-conversion",
+			expectedModule:     handlers.PolicyHostNamespacesPSPURI,
+			expectedSettings: map[string]interface{}{
+				"allow_host_network": true,
+				"allow_host_ipc":     false,
+				"allow_host_pid":     true,
+			},
+			expectedMode: "monitor",
+			expectedNamespaceSelector: &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: namespaceNameLabel, Operator: metav1.LabelSelectorOpIn, Values: []string{"test1"}},
+					{Key: namespaceNameLabel, Operator: metav1.LabelSelectorOpNotIn, Values: []string{"test2"}},
+				},
+			},
 		},
 		{
 			name: "error when rule contains only customPath criterion",
@@ -207,6 +224,7 @@ func TestCAPBuilder_GeneratePolicy(t *testing.T) {
 			require.Equal(t, tt.config.PolicyServer, admissionPolicy.Spec.PolicySpec.PolicyServer)
 			require.Equal(t, tt.config.BackgroundAudit, admissionPolicy.Spec.PolicySpec.BackgroundAudit)
 			require.Equal(t, v1.PolicyMode(tt.expectedMode), admissionPolicy.Spec.PolicySpec.Mode)
+			require.Equal(t, tt.expectedNamespaceSelector, admissionPolicy.Spec.NamespaceSelector)
 
 			// Verify settings
 			var actualSettings map[string]interface{}
@@ -220,3 +238,55 @@ func TestCAPBuilder_GeneratePolicy(t *testing.T) {
 		})
 	}
 }
+
+func TestCAPBuilder_GeneratePolicy_Resources(t *testing.T) {
+	rollout := resources.Resource{
+		APIGroup:   "argoproj.io",
+		APIVersion: "v1alpha1",
+		Resource:   "rollouts",
+		Kind:       "Rollout",
+	}
+	config := share.ConversionConfig{
+		Resources: resources.Config{
+			Rules: map[uint32]resources.Catalog{
+				1001: {resources.TypeWorkload: {rollout}},
+			},
+		},
+	}
+	builder := &CAPBuilder{
+		handlers: map[string]share.PolicyHandler{
+			handlers.RuleImage:   handlers.NewTrustedReposHandler(),
+			handlers.RuleEnvVars: handlers.NewEnvVarHandler(),
+		},
+	}
+
+	// The rule of another ID validates the default workloads
+	rule := &nvapis.RESTAdmissionRule{
+		ID:       1000,
+		Criteria: []*nvapis.RESTAdmRuleCriterion{
+			{Name: handlers.RuleImage, Op: nvdata.CriteriaOpContainsAny, Value: "nginx"},
+		},
+	}
+	policy, err := builder.GeneratePolicy(rule, config)
+	require.NoError(t, err)
+	capPolicy, ok := policy.(*v1.ClusterAdmissionPolicy)
+	require.True(t, ok)
+	require.Len(t, capPolicy.Spec.Rules, 3)
+
+	// The trusted repos module can't read the pod spec of the rollouts
+	rule.ID = 1001
+	_, err = builder.GeneratePolicy(rule, config)
+	require.ErrorContains(t, err, "rule skipped: module "+handlers.PolicyTrustedReposPolicyURI+
+		" can't handle the Rollout kind of the rollouts resource")
+
+	// The CEL policy reads it from their pod template
+	rule.Criteria = []*nvapis.RESTAdmRuleCriterion{
+		{Name: handlers.RuleEnvVars, Op: nvdata.CriteriaOpRegex, Value: "^DB_"},
+	}
+	policy, err = builder.GeneratePolicy(rule, config)
+	require.NoError(t, err)
+	capPolicy, ok = policy.(*v1.ClusterAdmissionPolicy)
+	require.True(t, ok)
+	require.Equal(t, handlers.PolicyCELPolicyURI, capPolicy.Spec.Module)
+	require.Equal(t, resources.Rules([]resources.Resource{rollout}), capPolicy.Spec.Rules)
+}
@@ -3,11 +3,15 @@ package policy
 import (
 	"errors"
 	"fmt"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 
 	policiesv1 "github.com/kubewarden/adm-controller/api/policies/v1"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/customrule"
 	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/handlers"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/metacriterion"
 	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/share"
 	nvapis "github.com/neuvector/neuvector/controller/api"
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
@@ -21,82 +25,237 @@ type CAPGBuilder struct {
 	handlers map[string]share.PolicyHandler
 }
 
-func (b *CAPGBuilder) groupCriteriaByModule(
+// groupMember is a member of the policy group of a rule, enforcing criteria of the rule with a module.
+type groupMember struct {
+	name     string
+	module   string
+	criteria []*nvapis.RESTAdmRuleCriterion
+	// handler is the handler of the criteria, nil for the custom criteria
+	handler  share.PolicyHandler
+	polarity share.Polarity
+}
+
+// customCriteria is the key of the custom criteria of a rule, enforced together by the Rego policy of the rule.
+const customCriteria = "custom"
+
+// groupCriteria groups the criteria of the rule in the members of its policy group, by NeuVector criterion and
+// by module. Every criterion is enforced by its own member, but the criteria expanded from a meta criterion and
+// the custom criteria: they're enforced by the members of their modules. The criteria are returned by NeuVector
+// criterion, with the namespace criteria and the applicable resources of the criteria.
+func (b *CAPGBuilder) groupCriteria(
 	rule *nvapis.RESTAdmissionRule,
-) (map[string][]*nvapis.RESTAdmRuleCriterion, []string, error) {
-	// Group criteria by their policy module
-	applicableResources := []string{}
-	moduleGroups := make(map[string][]*nvapis.RESTAdmRuleCriterion)
-	for _, criterion := range rule.Criteria {
-		// Group non-namespace criteria by their handler's module
-		handler, exists := b.handlers[criterion.Name]
-		if !exists {
-			return nil, nil, fmt.Errorf("no handler found for criterion: %s", criterion.Name)
+	config share.ConversionConfig,
+) ([][]*groupMember, []*nvapis.RESTAdmRuleCriterion, []string, error) {
+	var (
+		criteria            [][]*groupMember
+		criterionIndex      = map[string]int{}
+		namespaceCriteria   []*nvapis.RESTAdmRuleCriterion
+		applicableResources []string
+	)
+	for idx, criterion := range rule.Criteria {
+		key := strconv.Itoa(idx)
+		member := &groupMember{polarity: share.PolarityRejectOnMatch}
+		if customrule.IsCustomRule(criterion.Name) {
+			// The custom criteria are enforced by the module built from their Rego policy, it rejects the resources
+			// matching all of them
+			if config.CustomModuleRegistry == "" {
+				return nil, nil, nil, errors.New("custom criteria require a custom module registry")
+			}
+			applicableResources = append(applicableResources, handlers.ResourceWorkload)
+			key = customCriteria
+			member.module = CustomModuleURI(config.CustomModuleRegistry, config.CustomModuleVersion, rule.ID)
+		} else {
+			handler, exists := b.handlers[criterion.Name]
+			if !exists {
+				return nil, nil, nil, fmt.Errorf("no handler found for criterion: %s", criterion.Name)
+			}
+
+			applicableResources = append(applicableResources, handler.GetApplicableResource())
+			if criterion.Name == handlers.RuleNamespace {
+				namespaceCriteria = append(namespaceCriteria, criterion)
+				continue
+			}
+			if metacriterion.IsMetaCriterion(criterion.Path) {
+				key = criterion.Path
+			}
+			member.module = b.criterionModule(handler, criterion, config)
+			member.handler = handler
+			member.polarity = handler.GetPolarity()
 		}
 
-		applicableResources = append(applicableResources, handler.GetApplicableResource())
-		module := handler.GetModule()
-		moduleGroups[module] = append(moduleGroups[module], criterion)
+		// Group the criteria of a NeuVector criterion by their module
+		index, exists := criterionIndex[key]
+		if !exists {
+			index = len(criteria)
+			criterionIndex[key] = index
+			criteria = append(criteria, nil)
+		}
+		sameModule := func(m *groupMember) bool { return m.module == member.module }
+		if existing := slices.IndexFunc(criteria[index], sameModule); existing >= 0 {
+			member = criteria[index][existing]
+		} else {
+			criteria[index] = append(criteria[index], member)
+		}
+		member.criteria = append(member.criteria, criterion)
 	}
+	nameGroupMembers(criteria)
 	sort.Strings(applicableResources) // Ensure the resources are sorted in fixed order
-	return moduleGroups, applicableResources, nil
+	return criteria, namespaceCriteria, applicableResources, nil
+}
+
+// memberResources returns the applicable resources of the criteria enforced by the members, the custom criteria
+// are evaluated against the workloads.
+func memberResources(criteria [][]*groupMember) []string {
+	var applicableResources []string
+	for _, members := range criteria {
+		for _, member := range members {
+			if member.handler == nil {
+				applicableResources = append(applicableResources, handlers.ResourceWorkload)
+				continue
+			}
+			applicableResources = append(applicableResources, member.handler.GetApplicableResource())
+		}
+	}
+	return applicableResources
+}
+
+// nameGroupMembers names the members after their module, suffixed with their index in the rule when several
+// members use the same module.
+func nameGroupMembers(criteria [][]*groupMember) {
+	moduleMembers := map[string]int{}
+	for _, members := range criteria {
+		for _, member := range members {
+			moduleMembers[share.ExtractModuleName(member.module)]++
+		}
+	}
+
+	moduleIndex := map[string]int{}
+	for _, members := range criteria {
+		for _, member := range members {
+			member.name = share.ExtractModuleName(member.module)
+			if moduleMembers[member.name] > 1 {
+				moduleIndex[member.name]++
+				member.name = fmt.Sprintf("%s_%d", member.name, moduleIndex[member.name])
+			}
+		}
+	}
+}
+
+// groupExpression returns the expression of the policy group enforcing the criteria: NeuVector denies the
+// resources matching all the criteria of a rule, the group accepts the resources not matching any of them.
+// A member rejecting the resources matching its criterion accepts the resources not matching it, and a member
+// accepting them rejects the others. A meta criterion isn't matched when none of its expanded criteria is.
+func groupExpression(criteria [][]*groupMember) (string, error) {
+	terms := make([]string, 0, len(criteria))
+	for _, members := range criteria {
+		memberTerms := make([]string, 0, len(members))
+		for _, member := range members {
+			switch member.polarity {
+			case share.PolarityRejectOnMatch:
+				memberTerms = append(memberTerms, member.name+"()")
+			case share.PolarityAcceptOnMatch:
+				memberTerms = append(memberTerms, "!"+member.name+"()")
+			case share.PolarityUnknown:
+				return "", fmt.Errorf("no polarity declared for criterion: %s", member.criteria[0].Name)
+			}
+		}
+
+		sort.Strings(memberTerms)
+		term := strings.Join(memberTerms, " && ")
+		if len(memberTerms) > 1 && len(criteria) > 1 {
+			term = "(" + term + ")"
+		}
+		terms = append(terms, term)
+	}
+
+	// Ensure the terms are sorted in fixed order
+	sort.Strings(terms)
+	return strings.Join(terms, " || "), nil
 }
 
 func (b *CAPGBuilder) GeneratePolicy(rule *nvapis.RESTAdmissionRule, config share.ConversionConfig) (Policy, error) {
 	var (
 		policies            = policiesv1.PolicyGroupMembersWithContext{}
-		conditions          []string
 		matchConds          []admissionregistrationv1.MatchCondition
-		moduleGroups        map[string][]*nvapis.RESTAdmRuleCriterion
+		criteria            [][]*groupMember
+		namespaceCriteria   []*nvapis.RESTAdmRuleCriterion
 		applicableResources []string
+		expression          string
+		message             string
 		settings            []byte
 		err                 error
 	)
 
-	moduleGroups, applicableResources, err = b.groupCriteriaByModule(rule)
+	criteria, namespaceCriteria, applicableResources, err = b.groupCriteria(rule, config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to group criteria by module: %w", err)
 	}
+	expression, err = groupExpression(criteria)
+	if err != nil {
+		return nil, fmt.Errorf("rule skipped: %w", err)
+	}
+	message, err = ruleMessage(rule, config)
+	if err != nil {
+		return nil, fmt.Errorf("rule skipped: %w", err)
+	}
+	if err = checkApplicableResources(memberResources(criteria)); err != nil {
+		return nil, fmt.Errorf("rule skipped: %w", err)
+	}
 
 	var namespaceSelector *metav1.LabelSelector
-	for module, criteria := range moduleGroups {
-		// Get handler from the first criterion (all criteria in this group use the same handler)
-		handler := b.handlers[criteria[0].Name]
-		policyName := share.ExtractModuleName(module)
-
-		if criteria[0].Name == handlers.RuleNamespace {
-			if len(criteria) > 1 {
-				return nil, errors.New("rule skipped: contains multiple namespace selectors")
-			}
-			namespaceSelector = b.buildNamespaceSelector(criteria[0])
-			continue
-		}
+	if len(namespaceCriteria) > 0 {
+		var namespaceCondition *admissionregistrationv1.MatchCondition
+		namespaceSelector, namespaceCondition = b.buildNamespaceScope(namespaceCriteria)
+		matchConds = mergeMatchCondition(matchConds, namespaceCondition)
+	}
 
-		settings, err = handler.BuildPolicySettings(criteria)
-		if err != nil {
-			return nil, fmt.Errorf("failed to build policy settings: %w", err)
-		}
+	for _, members := range criteria {
+		for _, gm := range members {
+			// The Rego policy of the custom criteria has no settings, the rule values are embedded in the policy
+			settings = []byte("{}")
+			if gm.handler != nil {
+				policyResources := b.resolveResources(
+					rule.ID,
+					[]string{gm.handler.GetApplicableResource()},
+					config,
+				)
+				if err = handlers.CheckModuleResources(gm.module, policyResources); err != nil {
+					return nil, fmt.Errorf("rule skipped: %w", err)
+				}
+				settings, err = b.buildPolicySettings(
+					b.handlers,
+					gm.module,
+					rule.ID,
+					gm.criteria,
+					config,
+				)
+				if err != nil {
+					return nil, fmt.Errorf("failed to build policy settings: %w", err)
+				}
+			} else {
+				policyResources := b.resolveResources(rule.ID, []string{handlers.ResourceWorkload}, config)
+				if err = handlers.CheckRegoModuleResources(gm.module, policyResources); err != nil {
+					return nil, fmt.Errorf("rule skipped: %w", err)
+				}
+			}
 
-		member := policiesv1.PolicyGroupMemberWithContext{
-			PolicyGroupMember: policiesv1.PolicyGroupMember{
-				Module: module,
-				Settings: runtime.RawExtension{
-					Raw: settings,
+			member := policiesv1.PolicyGroupMemberWithContext{
+				PolicyGroupMember: policiesv1.PolicyGroupMember{
+					Module: gm.module,
+					Settings: runtime.RawExtension{
+						Raw: settings,
+					},
 				},
-			},
-		}
+			}
 
-		if ctxResources := handler.GetContextAwareResources(); len(ctxResources) > 0 {
-			member.ContextAwareResources = ctxResources
-		}
+			if gm.handler != nil && len(gm.handler.GetContextAwareResources()) > 0 {
+				member.ContextAwareResources = gm.handler.GetContextAwareResources()
+			}
 
-		policies[policyName] = member
-		conditions = append(conditions, fmt.Sprintf("%s()", policyName))
+			policies[gm.name] = member
+		}
 	}
 
-	// Ensure the conditions are sorted in fixed order
-	sort.Strings(conditions)
-
 	group := policiesv1.ClusterAdmissionPolicyGroup{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       clusterAdmissionPolicyGroupKind,
@@ -108,13 +267,13 @@ func (b *CAPGBuilder) GeneratePolicy(rule *nvapis.RESTAdmissionRule, config shar
 		Spec: policiesv1.ClusterAdmissionPolicyGroupSpec{
 			ClusterPolicyGroupSpec: policiesv1.ClusterPolicyGroupSpec{
 				GroupSpec: policiesv1.GroupSpec{
-					Message:         fmt.Sprintf("violate NeuVector rule (id=%d), comment %s", rule.ID, rule.Comment),
-					Rules:           b.BuildRules(applicableResources),
+					Message:         message,
+					Rules:           b.BuildRules(rule.ID, applicableResources, config),
 					Mode:            policiesv1.PolicyMode(b.getRulelMode(rule, config)),
 					PolicyServer:    config.PolicyServer,
 					BackgroundAudit: config.BackgroundAudit,
 					MatchConditions: matchConds,
-					Expression:      strings.Join(conditions, " && "),
+					Expression:      expression,
 				},
 				Policies: policies,
 			},
@@ -4,14 +4,22 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"slices"
 	"testing"
 
 	v1 "github.com/kubewarden/adm-controller/api/policies/v1"
 	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/handlers"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/metacriterion"
 	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/share"
 	nvapis "github.com/neuvector/neuvector/controller/api"
 	nvdata "github.com/neuvector/neuvector/share"
 	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestCAPGBuilder_GeneratePolicy(t *testing.T) {
@@ -22,9 +30,13 @@ func TestCAPGBuilder_GeneratePolicy(t *testing.T) {
 		handlers            map[string]share.PolicyHandler
 		expectedPolicyName  string
 		expectedPoliciesLen int
+		expectedExpression  string
 		expectedError       error
 		expectedMode        string
 		expectedMessage     string
+		expectedCustomRule  string
+
+		expectedNamespaceSelector *metav1.LabelSelector
 	}{
 		{
 			name: "single criterion - uses BuildPolicySettings",
@@ -50,12 +62,13 @@ func TestCAPGBuilder_GeneratePolicy(t *testing.T) {
 			},
 			expectedPolicyName:  "neuvector-rule-1234-conversion",
 			expectedPoliciesLen: 1,
+			expectedExpression:  "host_namespaces_psp()",
 			expectedMode:        "monitor",
 			expectedMessage:     "violate NeuVector rule (id=1234), comment Single Criterion Test",
 			expectedError:       nil,
 		},
 		{
-			name: "multiple criteria same module - uses BuildGroupedPolicySettings",
+			name: "multiple criteria same module - a member per criterion",
 			rule: &nvapis.RESTAdmissionRule{
 				ID:      1235,
 				Comment: "Multiple Same Module",
@@ -82,7 +95,8 @@ func TestCAPGBuilder_GeneratePolicy(t *testing.T) {
 				handlers.RuleShareNetwork: handlers.NewHostNamespaceHandler(),
 			},
 			expectedPolicyName:  "neuvector-rule-1235-conversion",
-			expectedPoliciesLen: 1,
+			expectedPoliciesLen: 2,
+			expectedExpression:  "host_namespaces_psp_1() || host_namespaces_psp_2()",
 			expectedMode:        "monitor",
 			expectedMessage:     "violate NeuVector rule (id=1235), comment Multiple Same Module",
 		},
@@ -108,7 +122,7 @@ func TestCAPGBuilder_GeneratePolicy(t *testing.T) {
 			),
 		},
 		{
-			name: "error when handler has multiple namespace selectors",
+			name: "successful policy generation with multiple namespace criteria",
 			rule: &nvapis.RESTAdmissionRule{
 				ID:      1243,
 				Comment: "Test Policy",
@@ -130,7 +144,7 @@ func TestCAPGBuilder_GeneratePolicy(t *testing.T) {
 					},
 					{
 						Name:  handlers.RuleNamespace,
-						Op:    nvdata.CriteriaOpContainsAny,
+						Op:    nvdata.CriteriaOpNotContainsAny,
 						Value: "test2",
 					},
 				},
@@ -145,10 +159,20 @@ func TestCAPGBuilder_GeneratePolicy(t *testing.T) {
 				handlers.RuleShareNetwork: handlers.NewHostNamespaceHandler(),
 				handlers.RuleNamespace:    handlers.NewNamespaceHandler(),
 			},
-			expectedError: errors.New("rule skipped: contains multiple namespace selectors"),
+			expectedPolicyName:  "neuvector-rule-1243-conversion",
+			expectedPoliciesLen: 2,
+			expectedExpression:  "host_namespaces_psp_1() || host_namespaces_psp_2()",
+			expectedMode:        "monitor",
+			expectedMessage:     "violate NeuVector rule (id=1243), comment Test Policy",
+			expectedNamespaceSelector: &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: namespaceNameLabel, Operator: metav1.LabelSelectorOpIn, Values: []string{"test1"}},
+					{Key: namespaceNameLabel, Operator: metav1.LabelSelectorOpNotIn, Values: []string{"test2"}},
+				},
+			},
 		},
 		{
-			name: "when custom rule criterion is mixed with other criteria, it is ignored, it will not be converted to a policy",
+			name: "when custom rule criterion is mixed with other criteria without custom module registry, it is rejected",
 			rule: &nvapis.RESTAdmissionRule{
 				ID:      1236,
 				Comment: "Mixed Criteria with Custom Rule",
@@ -187,10 +211,115 @@ func TestCAPGBuilder_GeneratePolicy(t *testing.T) {
 			expectedMode:        "monitor",
 			expectedError: fmt.Errorf(
 				"failed to group criteria by module: %w",
-				fmt.Errorf("no handler found for criterion: %s", ""),
+				errors.New("custom criteria require a custom module registry"),
 			),
 			expectedMessage: "violate NeuVector rule (id=1236), comment Mixed Criteria with Custom Rule",
 		},
+		{
+			name: "when custom rule criterion is mixed with other criteria, it is enforced by the custom module",
+			rule: &nvapis.RESTAdmissionRule{
+				ID:      1236,
+				Comment: "Mixed Criteria with Custom Rule",
+				Criteria: []*nvapis.RESTAdmRuleCriterion{
+					{
+						Name:  handlers.RuleShareIPC,
+						Op:    nvdata.CriteriaOpEqual,
+						Value: "true",
+					},
+					{
+						Name:      "",
+						Op:        nvdata.CriteriaOpExist,
+						Path:      "item.spec.initContainers",
+						Type:      "customPath",
+						Value:     "",
+						ValueType: "key",
+					},
+					{
+						Name:  handlers.RuleShareNetwork,
+						Op:    nvdata.CriteriaOpEqual,
+						Value: "false",
+					},
+				},
+			},
+			config: share.ConversionConfig{
+				PolicyServer:         "test-server",
+				Mode:                 "monitor",
+				BackgroundAudit:      false,
+				CustomModuleRegistry: "registry://ghcr.io/acme/policies",
+				CustomModuleVersion:  "v0.1.0",
+			},
+			handlers: map[string]share.PolicyHandler{
+				handlers.RuleShareIPC:     handlers.NewHostNamespaceHandler(),
+				handlers.RuleShareNetwork: handlers.NewHostNamespaceHandler(),
+			},
+			expectedPolicyName:  "neuvector-rule-1236-conversion",
+			expectedPoliciesLen: 3,
+			expectedExpression:  "host_namespaces_psp_1() || host_namespaces_psp_2() || nv_rule_1236()",
+			expectedCustomRule:  "registry://ghcr.io/acme/policies/nv-rule-1236:v0.1.0",
+			expectedMode:        "monitor",
+			expectedMessage:     "violate NeuVector rule (id=1236), comment Mixed Criteria with Custom Rule",
+		},
+		{
+			name: "meta criterion - its criteria are enforced together",
+			rule: &nvapis.RESTAdmissionRule{
+				ID:      1237,
+				Comment: "Meta Criterion",
+				Criteria: []*nvapis.RESTAdmRuleCriterion{
+					{
+						Name:  handlers.RuleShareIPC,
+						Op:    nvdata.CriteriaOpEqual,
+						Value: "true",
+						Path:  metacriterion.RulePSPBestPractices,
+					},
+					{
+						Name:  handlers.RuleAllowPrivilegedEscalation,
+						Op:    nvdata.CriteriaOpEqual,
+						Value: "true",
+						Path:  metacriterion.RulePSPBestPractices,
+					},
+					{
+						Name:  handlers.RuleImage,
+						Op:    nvdata.CriteriaOpContainsAny,
+						Value: "nginx",
+					},
+				},
+			},
+			config: share.ConversionConfig{
+				PolicyServer: "test-server",
+				Mode:         "monitor",
+			},
+			handlers: map[string]share.PolicyHandler{
+				handlers.RuleShareIPC:                  handlers.NewHostNamespaceHandler(),
+				handlers.RuleAllowPrivilegedEscalation: handlers.NewAllowPrivilegedEscalationHandler(),
+				handlers.RuleImage:                     handlers.NewTrustedReposHandler(),
+			},
+			expectedPolicyName:  "neuvector-rule-1237-conversion",
+			expectedPoliciesLen: 3,
+			expectedExpression:  "(allow_privilege_escalation_psp() && host_namespaces_psp()) || trusted_repos()",
+			expectedMode:        "monitor",
+			expectedMessage:     "violate NeuVector rule (id=1237), comment Meta Criterion",
+		},
+		{
+			name: "handler without polarity error",
+			rule: &nvapis.RESTAdmissionRule{
+				ID: 1238,
+				Criteria: []*nvapis.RESTAdmRuleCriterion{
+					{Name: handlers.RuleShareIPC, Op: nvdata.CriteriaOpEqual, Value: "true"},
+					{Name: handlers.RuleRunAsPrivileged, Op: nvdata.CriteriaOpEqual, Value: "true"},
+				},
+			},
+			config: share.ConversionConfig{
+				Mode: "monitor",
+			},
+			handlers: map[string]share.PolicyHandler{
+				handlers.RuleShareIPC:        handlers.NewHostNamespaceHandler(),
+				handlers.RuleRunAsPrivileged: &handlers.PodPrivilegedHandler{},
+			},
+			expectedError: fmt.Errorf(
+				"rule skipped: %w",
+				fmt.Errorf("no polarity declared for criterion: %s", handlers.RuleRunAsPrivileged),
+			),
+		},
 	}
 
 	for _, tt := range tests {
@@ -223,19 +352,32 @@ func TestCAPGBuilder_GeneratePolicy(t *testing.T) {
 			require.Equal(t, tt.config.BackgroundAudit, capg.Spec.GroupSpec.BackgroundAudit)
 			require.Equal(t, v1.PolicyMode(tt.expectedMode), capg.Spec.GroupSpec.Mode)
 			require.Equal(t, tt.expectedMessage, capg.Spec.GroupSpec.Message)
+			require.Equal(t, tt.expectedNamespaceSelector, capg.Spec.NamespaceSelector)
 
 			// Verify policies count
 			require.Len(t, capg.Spec.Policies, tt.expectedPoliciesLen)
+			require.Equal(t, tt.expectedExpression, capg.Spec.Expression)
 
 			// Verify rules
 			rules := capg.Spec.GroupSpec.Rules
 			require.Len(t, rules, 3) // Default rules from BuildRules()
 
+			// Verify that the custom criteria are enforced by the custom module, without settings
+			if tt.expectedCustomRule != "" {
+				member, exists := capg.Spec.Policies[share.ExtractModuleName(tt.expectedCustomRule)]
+				require.True(t, exists)
+				require.Equal(t, tt.expectedCustomRule, member.Module)
+				require.JSONEq(t, "{}", string(member.Settings.Raw))
+			}
+
 			// Verify that each policy has proper settings
 			for policyName, member := range capg.Spec.Policies {
 				require.NotEmpty(t, policyName)
 				require.NotEmpty(t, member.Module)
 				require.NotEmpty(t, member.Settings.Raw)
+				if member.Module == tt.expectedCustomRule {
+					continue
+				}
 
 				// Verify settings can be unmarshaled
 				var settings map[string]interface{}
@@ -246,3 +388,214 @@ func TestCAPGBuilder_GeneratePolicy(t *testing.T) {
 		})
 	}
 }
+
+func TestGroupExpression(t *testing.T) {
+	member := func(name string, polarity share.Polarity) *groupMember {
+		return &groupMember{
+			name:     name,
+			criteria: []*nvapis.RESTAdmRuleCriterion{{Name: name}},
+			polarity: polarity,
+		}
+	}
+	rejectOnMatch, acceptOnMatch := share.PolarityRejectOnMatch, share.PolarityAcceptOnMatch
+
+	tests := []struct {
+		name                  string
+		criteria              [][]*groupMember
+		expectedExpression    string
+		expectedErrorContains string
+	}{
+		{
+			name:               "single criterion",
+			criteria:           [][]*groupMember{{member("a", rejectOnMatch)}},
+			expectedExpression: "a()",
+		},
+		{
+			name:               "criteria",
+			criteria:           [][]*groupMember{{member("b", rejectOnMatch)}, {member("a", rejectOnMatch)}},
+			expectedExpression: "a() || b()",
+		},
+		{
+			name:               "accept on match",
+			criteria:           [][]*groupMember{{member("a", rejectOnMatch)}, {member("b", acceptOnMatch)}},
+			expectedExpression: "!b() || a()",
+		},
+		{
+			name:               "single meta criterion",
+			criteria:           [][]*groupMember{{member("a", rejectOnMatch), member("b", rejectOnMatch)}},
+			expectedExpression: "a() && b()",
+		},
+		{
+			name: "meta criterion and criterion",
+			criteria: [][]*groupMember{
+				{member("a", rejectOnMatch), member("b", acceptOnMatch)},
+				{member("c", rejectOnMatch)},
+			},
+			expectedExpression: "(!b() && a()) || c()",
+		},
+		{
+			name:                  "unknown polarity",
+			criteria:              [][]*groupMember{{member("a", rejectOnMatch)}, {member("b", share.PolarityUnknown)}},
+			expectedErrorContains: "no polarity declared for criterion: b",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expression, err := groupExpression(tt.criteria)
+			if tt.expectedErrorContains != "" {
+				require.ErrorContains(t, err, tt.expectedErrorContains)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedExpression, expression)
+		})
+	}
+}
+
+// TestCAPGBuilder_GroupExpressionTruthTable checks, for every multi-criteria rule fixture, that the policy group
+// denies the resources matching all the NeuVector criteria of the rule only, for every combination of the criteria
+// matched by a resource. The members decide as their modules do, per moduleRejectsMatches rather than the polarity
+// declared by the handlers, so that a wrong declaration fails the test.
+func TestCAPGBuilder_GroupExpressionTruthTable(t *testing.T) {
+	// moduleRejectsMatches is the reference decision of the module enforcing a criterion, true when the module
+	// rejects the resources matching the criterion and accepts the others.
+	moduleRejectsMatches := map[string]bool{
+		handlers.RuleShareIPC:                  true, // host-namespaces-psp rejects hostIPC
+		handlers.RuleShareNetwork:              true, // host-namespaces-psp rejects hostNetwork
+		handlers.RuleSharePID:                  true, // host-namespaces-psp rejects hostPID
+		handlers.RuleAllowPrivilegedEscalation: true, // allow-privilege-escalation-psp rejects the escalation
+		handlers.RuleRunAsRoot:                 true, // container-running-as-user rejects the root user
+		handlers.RuleRunAsPrivileged:           true, // pod-privileged rejects the privileged containers
+		handlers.RuleStorageClass:              true, // persistentvolumeclaim-storageclass-policy rejects the classes
+		handlers.RuleImage:                     true, // trusted-repos rejects the rejected images
+		handlers.RuleImageRegistry:             true, // trusted-repos rejects the rejected registries
+		handlers.RuleHighCVECount:              true, // image-cve-policy rejects the vulnerable images
+		handlers.RuleMedCVECount:               true, // image-cve-policy rejects the vulnerable images
+	}
+
+	ruleFiles, err := filepath.Glob("../../test/rules/multi_criteria/*/rule.json")
+	require.NoError(t, err)
+	require.NotEmpty(t, ruleFiles)
+
+	metaCriteria := map[string]metacriterion.MetaCriterion{
+		metacriterion.RulePSPBestPractices: metacriterion.NewPSPBestPracticeMetaCriterion(),
+	}
+	builder := &CAPGBuilder{handlers: map[string]share.PolicyHandler{
+		handlers.RuleShareIPC:                  handlers.NewHostNamespaceHandler(),
+		handlers.RuleShareNetwork:              handlers.NewHostNamespaceHandler(),
+		handlers.RuleSharePID:                  handlers.NewHostNamespaceHandler(),
+		handlers.RuleAllowPrivilegedEscalation: handlers.NewAllowPrivilegedEscalationHandler(),
+		handlers.RuleRunAsRoot:                 handlers.NewContainerRunningAsUserHandler(),
+		handlers.RuleRunAsPrivileged:           handlers.NewPodPrivilegedHandler(),
+		handlers.RuleStorageClass:              handlers.NewPVCStorageClassHandler(),
+		handlers.RuleImage:                     handlers.NewTrustedReposHandler(),
+		handlers.RuleImageRegistry:             handlers.NewTrustedReposHandler(),
+		handlers.RuleHighCVECount:              handlers.NewImageCVEHandler("default", "amd64"),
+		handlers.RuleMedCVECount:               handlers.NewImageCVEHandler("default", "amd64"),
+	}}
+
+	for _, ruleFile := range ruleFiles {
+		t.Run(filepath.Base(filepath.Dir(ruleFile)), func(t *testing.T) {
+			data, readErr := os.ReadFile(ruleFile)
+			require.NoError(t, readErr)
+			var rules struct {
+				Rules []*nvapis.RESTAdmissionRule `json:"rules"`
+			}
+			require.NoError(t, json.Unmarshal(data, &rules))
+			require.Len(t, rules.Rules, 1)
+			rule := rules.Rules[0]
+
+			// Expand the meta criteria, and index the criteria by the NeuVector criterion they're expanded from
+			var criteria []*nvapis.RESTAdmRuleCriterion
+			criteriaCount := len(rule.Criteria)
+			criterionIndex := map[*nvapis.RESTAdmRuleCriterion]int{}
+			for idx, criterion := range rule.Criteria {
+				expanded := []*nvapis.RESTAdmRuleCriterion{criterion}
+				if metaCriterion, exists := metaCriteria[criterion.Name]; exists {
+					expanded = metaCriterion.Expand()
+				}
+				for _, expandedCriterion := range expanded {
+					criterionIndex[expandedCriterion] = idx
+				}
+				criteria = append(criteria, expanded...)
+			}
+			rule.Criteria = criteria
+
+			// The rules whose criteria no resource matches all are skipped
+			var config struct {
+				Skipped bool `json:"skipped"`
+			}
+			configData, readErr := os.ReadFile(filepath.Join(filepath.Dir(ruleFile), "config.json"))
+			require.NoError(t, readErr)
+			require.NoError(t, json.Unmarshal(configData, &config))
+
+			policy, generateErr := builder.GeneratePolicy(rule, share.ConversionConfig{Mode: "protect"})
+			if config.Skipped {
+				require.ErrorContains(t, generateErr, "no resource matches them all")
+				return
+			}
+			require.NoError(t, generateErr)
+			group, ok := policy.(*v1.ClusterAdmissionPolicyGroup)
+			require.True(t, ok)
+			expression, parseErr := parser.ParseExpr(group.Spec.Expression)
+			require.NoError(t, parseErr)
+
+			members, _, _, groupErr := builder.groupCriteria(rule, share.ConversionConfig{Mode: "protect"})
+			require.NoError(t, groupErr)
+
+			// Every combination of the criteria matched by a resource
+			for matches := range 1 << len(criteria) {
+				matched := func(criterion *nvapis.RESTAdmRuleCriterion) bool {
+					return matches&(1<<slices.Index(criteria, criterion)) != 0
+				}
+
+				accepted := map[string]bool{}
+				for _, criterionMembers := range members {
+					for _, member := range criterionMembers {
+						rejectsMatches, exists := moduleRejectsMatches[member.criteria[0].Name]
+						require.True(t, exists, "no reference decision for criterion %s", member.criteria[0].Name)
+						memberMatched := slices.ContainsFunc(member.criteria, matched)
+						accepted[member.name] = memberMatched != rejectsMatches
+					}
+				}
+
+				ruleMatched := make([]bool, criteriaCount)
+				for _, criterion := range criteria {
+					index := criterionIndex[criterion]
+					ruleMatched[index] = ruleMatched[index] || matched(criterion)
+				}
+				denied := !slices.Contains(ruleMatched, false)
+
+				require.Equal(t, denied, !evalGroupExpression(t, expression, accepted),
+					"criteria matches %0*b, members accepting %v", len(criteria), matches, accepted)
+			}
+		})
+	}
+}
+
+// evalGroupExpression evaluates the expression of a policy group, with the members accepting the request.
+func evalGroupExpression(t *testing.T, expression ast.Expr, accepted map[string]bool) bool {
+	switch expr := expression.(type) {
+	case *ast.ParenExpr:
+		return evalGroupExpression(t, expr.X, accepted)
+	case *ast.UnaryExpr:
+		require.Equal(t, token.NOT, expr.Op)
+		return !evalGroupExpression(t, expr.X, accepted)
+	case *ast.BinaryExpr:
+		switch expr.Op {
+		case token.LAND:
+			return evalGroupExpression(t, expr.X, accepted) && evalGroupExpression(t, expr.Y, accepted)
+		case token.LOR:
+			return evalGroupExpression(t, expr.X, accepted) || evalGroupExpression(t, expr.Y, accepted)
+		}
+	case *ast.CallExpr:
+		name, ok := expr.Fun.(*ast.Ident)
+		require.True(t, ok)
+		memberAccepted, exists := accepted[name.Name]
+		require.True(t, exists, "unknown member %s", name.Name)
+		return memberAccepted
+	}
+	require.Failf(t, "unsupported expression", "%T", expression)
+	return false
+}
@@ -0,0 +1,112 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/handlers"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/share"
+
+	policiesv1 "github.com/kubewarden/adm-controller/api/policies/v1"
+	nvapis "github.com/neuvector/neuvector/controller/api"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// CustomModuleBuilder builds the ClusterAdmissionPolicy of the rules converted to a Rego policy.
+// The policy references the Wasm module built from the Rego policy and pushed to the custom module registry.
+type CustomModuleBuilder struct {
+	BaseBuilder
+
+	handlers map[string]share.PolicyHandler
+}
+
+// CustomModuleURI returns the module of the Rego policy generated for the rule: <registry>/nv-rule-<id>:<version>.
+func CustomModuleURI(registry string, version string, ruleID uint32) string {
+	return fmt.Sprintf("%s/nv-rule-%d:%s", strings.TrimSuffix(registry, "/"), ruleID, version)
+}
+
+func (b *CustomModuleBuilder) GeneratePolicy(
+	rule *nvapis.RESTAdmissionRule,
+	config share.ConversionConfig,
+) (Policy, error) {
+	if config.CustomModuleRegistry == "" {
+		return nil, errors.New("no custom module registry configured")
+	}
+
+	var namespaceCriteria []*nvapis.RESTAdmRuleCriterion
+	var applicableResources []string
+	var ctxResources []policiesv1.ContextAwareResource
+
+	for _, criterion := range rule.Criteria {
+		if criterion.Name == handlers.RuleNamespace {
+			namespaceCriteria = append(namespaceCriteria, criterion)
+			continue
+		}
+
+		// The custom criteria have no handler, they're evaluated against the workloads
+		handler, exists := b.handlers[criterion.Name]
+		if !exists {
+			applicableResources = append(applicableResources, handlers.ResourceWorkload)
+			continue
+		}
+
+		applicableResources = append(applicableResources, handler.GetApplicableResource())
+		for _, resource := range handler.GetContextAwareResources() {
+			if !slices.Contains(ctxResources, resource) {
+				ctxResources = append(ctxResources, resource)
+			}
+		}
+	}
+	if len(applicableResources) == 0 {
+		return nil, errors.New(
+			"rule skipped: contains only namespace selector without enforceable policy conditions for criteria",
+		)
+	}
+	if err := checkApplicableResources(applicableResources); err != nil {
+		return nil, fmt.Errorf("rule skipped: %w", err)
+	}
+
+	namespaceSelector, namespaceCondition := b.buildNamespaceScope(namespaceCriteria)
+
+	module := CustomModuleURI(config.CustomModuleRegistry, config.CustomModuleVersion, rule.ID)
+	policyResources := b.resolveResources(rule.ID, applicableResources, config)
+	if err := handlers.CheckRegoModuleResources(module, policyResources); err != nil {
+		return nil, fmt.Errorf("rule skipped: %w", err)
+	}
+
+	policy := policiesv1.ClusterAdmissionPolicy{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       clusterAdmissionPolicyKind,
+			APIVersion: kwAPIVersion,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: b.generatePolicyName(rule),
+		},
+		Spec: policiesv1.ClusterAdmissionPolicySpec{
+			PolicySpec: policiesv1.PolicySpec{
+				Rules:           b.BuildRules(rule.ID, applicableResources, config),
+				MatchConditions: mergeMatchCondition([]admissionregistrationv1.MatchCondition{}, namespaceCondition),
+				Mode:            policiesv1.PolicyMode(b.getRulelMode(rule, config)),
+				Module:          module,
+				PolicyServer:    config.PolicyServer,
+				BackgroundAudit: config.BackgroundAudit,
+				// The Rego policies have no settings, the rule values are embedded in the policy
+				Settings: runtime.RawExtension{
+					Raw: []byte("{}"),
+				},
+			},
+			NamespaceSelector: namespaceSelector,
+		},
+	}
+
+	if len(ctxResources) > 0 {
+		policy.Spec.ContextAwareResources = ctxResources
+	}
+
+	return &policy, nil
+}
@@ -0,0 +1,119 @@
+package policy
+
+import (
+	"testing"
+
+	v1 "github.com/kubewarden/adm-controller/api/policies/v1"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/customrule"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/handlers"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/share"
+	nvapis "github.com/neuvector/neuvector/controller/api"
+	nvdata "github.com/neuvector/neuvector/share"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCustomModuleURI(t *testing.T) {
+	require.Equal(t,
+		"registry://ghcr.io/acme/policies/nv-rule-1001:v0.1.0",
+		CustomModuleURI("registry://ghcr.io/acme/policies", "v0.1.0", 1001),
+	)
+	require.Equal(t,
+		"registry://ghcr.io/acme/policies/nv-rule-1001:v0.1.0",
+		CustomModuleURI("registry://ghcr.io/acme/policies/", "v0.1.0", 1001),
+	)
+}
+
+func TestCustomModuleBuilder_GeneratePolicy(t *testing.T) {
+	policyHandlers := map[string]share.PolicyHandler{
+		handlers.RuleNamespace: handlers.NewNamespaceHandler(),
+		handlers.RuleModules:   handlers.NewModulesHandler("sbomscanner", "amd64"),
+	}
+	config := share.ConversionConfig{
+		PolicyServer:         "test-server",
+		Mode:                 "monitor",
+		BackgroundAudit:      true,
+		CustomModuleRegistry: "registry://ghcr.io/acme/policies",
+		CustomModuleVersion:  "v0.1.0",
+	}
+
+	tests := []struct {
+		name                  string
+		rule                  *nvapis.RESTAdmissionRule
+		config                share.ConversionConfig
+		expectedNamespaces    bool
+		expectedCtxResources  int
+		expectedErrorContains string
+	}{
+		{
+			name: "custom rule",
+			rule: &nvapis.RESTAdmissionRule{
+				ID: 1001,
+				Criteria: []*nvapis.RESTAdmRuleCriterion{
+					{Name: customrule.RuleCustom, Path: "item.metadata.name", Op: nvdata.CriteriaOpExist},
+				},
+			},
+			config: config,
+		},
+		{
+			name: "rego handler rule with namespace",
+			rule: &nvapis.RESTAdmissionRule{
+				ID: 1001,
+				Criteria: []*nvapis.RESTAdmRuleCriterion{
+					{Name: handlers.RuleModules, Op: nvdata.CriteriaOpContainsAny, Value: "openssl"},
+					{Name: handlers.RuleNamespace, Op: nvdata.CriteriaOpContainsAny, Value: "default"},
+				},
+			},
+			config:               config,
+			expectedNamespaces:   true,
+			expectedCtxResources: 1,
+		},
+		{
+			name: "multiple namespace criteria",
+			rule: &nvapis.RESTAdmissionRule{
+				ID: 1001,
+				Criteria: []*nvapis.RESTAdmRuleCriterion{
+					{Name: customrule.RuleCustom, Path: "item.metadata.name", Op: nvdata.CriteriaOpExist},
+					{Name: handlers.RuleNamespace, Op: nvdata.CriteriaOpContainsAny, Value: "default"},
+					{Name: handlers.RuleNamespace, Op: nvdata.CriteriaOpNotContainsAny, Value: "kube-system"},
+				},
+			},
+			config:             config,
+			expectedNamespaces: true,
+		},
+		{
+			name: "no custom module registry",
+			rule: &nvapis.RESTAdmissionRule{
+				ID: 1001,
+				Criteria: []*nvapis.RESTAdmRuleCriterion{
+					{Name: customrule.RuleCustom, Path: "item.metadata.name", Op: nvdata.CriteriaOpExist},
+				},
+			},
+			config:                share.ConversionConfig{},
+			expectedErrorContains: "no custom module registry configured",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := &CustomModuleBuilder{handlers: policyHandlers}
+			generated, err := builder.GeneratePolicy(tt.rule, tt.config)
+			if tt.expectedErrorContains != "" {
+				require.ErrorContains(t, err, tt.expectedErrorContains)
+				return
+			}
+			require.NoError(t, err)
+
+			policy, ok := generated.(*v1.ClusterAdmissionPolicy)
+			require.True(t, ok)
+			require.Equal(t, "neuvector-rule-1001-conversion", policy.Name)
+			require.Equal(t, "registry://ghcr.io/acme/policies/nv-rule-1001:v0.1.0", policy.Spec.Module)
+			require.Equal(t, v1.PolicyMode("monitor"), policy.Spec.Mode)
+			require.Equal(t, "test-server", policy.Spec.PolicyServer)
+			rules := builder.BuildRules(1001, []string{handlers.ResourceWorkload}, tt.config)
+			require.Equal(t, rules, policy.Spec.Rules)
+			require.JSONEq(t, "{}", string(policy.Spec.Settings.Raw))
+			require.Equal(t, tt.expectedNamespaces, policy.Spec.NamespaceSelector != nil)
+			require.Len(t, policy.Spec.ContextAwareResources, tt.expectedCtxResources)
+		})
+	}
+}
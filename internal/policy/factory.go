@@ -33,15 +33,57 @@ func (f *Factory) CreateBuilder(rule *nvapis.RESTAdmissionRule) Builder {
 }
 
 func (f *Factory) GeneratePolicy(rule *nvapis.RESTAdmissionRule, config share.ConversionConfig) (Policy, error) {
-	builder := f.CreateBuilder(rule)
+	builder := f.namespacedBuilder(messageBuilder(f.CreateBuilder(rule), config), rule, config)
 	return builder.GeneratePolicy(rule, config)
 }
 
+// GenerateCustomModulePolicy generates the policy referencing the Wasm module built from the Rego policy of the rule.
+func (f *Factory) GenerateCustomModulePolicy(
+	rule *nvapis.RESTAdmissionRule,
+	config share.ConversionConfig,
+) (Policy, error) {
+	builder := &CustomModuleBuilder{}
+	builder.handlers = f.handlers
+	return f.namespacedBuilder(messageBuilder(builder, config), rule, config).GeneratePolicy(rule, config)
+}
+
+// namespacedBuilder wraps the builder to generate a namespaced policy, if preferred and the rule targets a single
+// namespace. The namespaced policies can't access the context aware resources, the rules of the handlers using
+// them keep a cluster-wide policy.
+func (f *Factory) namespacedBuilder(
+	builder Builder,
+	rule *nvapis.RESTAdmissionRule,
+	config share.ConversionConfig,
+) Builder {
+	if !config.PreferNamespaced {
+		return builder
+	}
+
+	for _, criterion := range rule.Criteria {
+		if handler, exists := f.handlers[criterion.Name]; exists && len(handler.GetContextAwareResources()) > 0 {
+			return builder
+		}
+	}
+
+	namespace, ok := singleNamespace(rule)
+	if !ok {
+		return builder
+	}
+	return &NamespacedBuilder{Builder: builder, namespace: namespace}
+}
+
+// requiresPolicyGroup returns true if the rule has several non-namespace criteria, or a criterion whose module
+// accepts the resources matching it: only the expression of a policy group can negate it.
 func (f *Factory) requiresPolicyGroup(rule *nvapis.RESTAdmissionRule) bool {
 	count := 0
 	for _, criterion := range rule.Criteria {
-		if criterion.Name != nvdata.CriteriaKeyNamespace {
-			count++
+		if criterion.Name == nvdata.CriteriaKeyNamespace {
+			continue
+		}
+		count++
+		handler, exists := f.handlers[criterion.Name]
+		if exists && handler.GetPolarity() == share.PolarityAcceptOnMatch {
+			return true
 		}
 	}
 	return count > 1
@@ -9,6 +9,8 @@ import (
 	nvapis "github.com/neuvector/neuvector/controller/api"
 	nvdata "github.com/neuvector/neuvector/share"
 	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 func TestFactory_CreateBuilder(t *testing.T) {
@@ -294,6 +296,123 @@ func TestFactory_GeneratePolicy(t *testing.T) {
 	}
 }
 
+func TestFactory_GeneratePolicy_PreferNamespaced(t *testing.T) {
+	shareIPC := &nvapis.RESTAdmRuleCriterion{Name: handlers.RuleShareIPC, Op: nvdata.CriteriaOpEqual, Value: "true"}
+	shareNetwork := &nvapis.RESTAdmRuleCriterion{
+		Name:  handlers.RuleShareNetwork,
+		Op:    nvdata.CriteriaOpEqual,
+		Value: "false",
+	}
+	namespace := func(op, value string) *nvapis.RESTAdmRuleCriterion {
+		return &nvapis.RESTAdmRuleCriterion{Name: handlers.RuleNamespace, Op: op, Value: value}
+	}
+	preferNamespaced := share.ConversionConfig{Mode: "protect", PreferNamespaced: true}
+
+	tests := []struct {
+		name              string
+		criteria          []*nvapis.RESTAdmRuleCriterion
+		config            share.ConversionConfig
+		expectedKind      string
+		expectedNamespace string
+	}{
+		{
+			name: "single namespace",
+			criteria: []*nvapis.RESTAdmRuleCriterion{
+				shareIPC, namespace(nvdata.CriteriaOpContainsAny, " team-a "),
+			},
+			config:            preferNamespaced,
+			expectedKind:      admissionPolicyKind,
+			expectedNamespace: "team-a",
+		},
+		{
+			name: "single namespace with policy group",
+			criteria: []*nvapis.RESTAdmRuleCriterion{
+				shareIPC, shareNetwork, namespace(nvdata.CriteriaOpContainsAny, "team-a"),
+			},
+			config:            preferNamespaced,
+			expectedKind:      admissionPolicyGroupKind,
+			expectedNamespace: "team-a",
+		},
+		{
+			name:         "namespaced policies not preferred",
+			criteria:     []*nvapis.RESTAdmRuleCriterion{shareIPC, namespace(nvdata.CriteriaOpContainsAny, "team-a")},
+			config:       share.ConversionConfig{Mode: "protect"},
+			expectedKind: clusterAdmissionPolicyKind,
+		},
+		{
+			name:         "without namespace criterion",
+			criteria:     []*nvapis.RESTAdmRuleCriterion{shareIPC, shareNetwork},
+			config:       preferNamespaced,
+			expectedKind: clusterAdmissionPolicyGroupKind,
+		},
+		{
+			name: "multiple namespaces",
+			criteria: []*nvapis.RESTAdmRuleCriterion{
+				shareIPC, namespace(nvdata.CriteriaOpContainsAny, "team-a,team-b"),
+			},
+			config:       preferNamespaced,
+			expectedKind: clusterAdmissionPolicyKind,
+		},
+		{
+			name: "not contains any namespace",
+			criteria: []*nvapis.RESTAdmRuleCriterion{
+				shareIPC, namespace(nvdata.CriteriaOpNotContainsAny, "team-a"),
+			},
+			config:       preferNamespaced,
+			expectedKind: clusterAdmissionPolicyKind,
+		},
+		{
+			name:         "wildcard namespace",
+			criteria:     []*nvapis.RESTAdmRuleCriterion{shareIPC, namespace(nvdata.CriteriaOpContainsAny, "team-*")},
+			config:       preferNamespaced,
+			expectedKind: clusterAdmissionPolicyKind,
+		},
+		{
+			name: "multiple namespace criteria",
+			criteria: []*nvapis.RESTAdmRuleCriterion{
+				shareIPC,
+				namespace(nvdata.CriteriaOpContainsAny, "team-a"),
+				namespace(nvdata.CriteriaOpContainsAny, "team-a"),
+			},
+			config:       preferNamespaced,
+			expectedKind: clusterAdmissionPolicyKind,
+		},
+		{
+			name: "context aware resources",
+			criteria: []*nvapis.RESTAdmRuleCriterion{
+				{Name: handlers.RuleHighCVECount, Op: nvdata.CriteriaOpBiggerEqualThan, Value: "10"},
+				namespace(nvdata.CriteriaOpContainsAny, "team-a"),
+			},
+			config:       preferNamespaced,
+			expectedKind: clusterAdmissionPolicyKind,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			factory := NewFactory()
+			factory.SetHandlers(map[string]share.PolicyHandler{
+				handlers.RuleShareIPC:     handlers.NewHostNamespaceHandler(),
+				handlers.RuleShareNetwork: handlers.NewHostNamespaceHandler(),
+				handlers.RuleHighCVECount: handlers.NewImageCVEHandler("sbomscanner", "amd64"),
+				handlers.RuleNamespace:    handlers.NewNamespaceHandler(),
+			})
+
+			policy, err := factory.GeneratePolicy(&nvapis.RESTAdmissionRule{ID: 1234, Criteria: tt.criteria}, tt.config)
+			require.NoError(t, err)
+
+			object, ok := policy.(interface {
+				metav1.Object
+				runtime.Object
+			})
+			require.True(t, ok)
+			require.Equal(t, tt.expectedKind, object.GetObjectKind().GroupVersionKind().Kind)
+			require.Equal(t, tt.expectedNamespace, object.GetNamespace())
+			require.Equal(t, "neuvector-rule-1234-conversion", object.GetName())
+		})
+	}
+}
+
 func getTypeName(v interface{}) string {
 	switch v.(type) {
 	case *CAPBuilder:
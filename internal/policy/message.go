@@ -0,0 +1,183 @@
+package policy
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/metacriterion"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/share"
+
+	policiesv1 "github.com/kubewarden/adm-controller/api/policies/v1"
+	nvapis "github.com/neuvector/neuvector/controller/api"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// DefaultMessageTemplate is the template of the message of the policy groups when none is set.
+	DefaultMessageTemplate = "violate NeuVector rule (id={{.ID}}), comment {{.Comment}}"
+
+	// DefaultMergedMessageTemplate is the template of the message of the consolidated policy groups when none is set.
+	DefaultMergedMessageTemplate = "violate NeuVector rules (ids={{.ID}})"
+)
+
+// messageData is the data of the message template. The consolidated policy groups join the IDs of their rules
+// with commas, and their distinct comments and criteria summaries with semicolons.
+type messageData struct {
+	ID       string
+	Comment  string
+	Criteria string
+}
+
+// ParseMessageTemplate parses the template of the rejection message of the policies.
+func ParseMessageTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("message").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid message template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// ruleMessage returns the rejection message of the rule, from the message template or the default one.
+func ruleMessage(rule *nvapis.RESTAdmissionRule, config share.ConversionConfig) (string, error) {
+	text := config.MessageTemplate
+	if text == "" {
+		text = DefaultMessageTemplate
+	}
+	return renderMessage(text, messageData{
+		ID:       strconv.FormatUint(uint64(rule.ID), 10),
+		Comment:  rule.Comment,
+		Criteria: criteriaSummary(rule),
+	})
+}
+
+// RulesMessage returns the rejection message of the policy group consolidating the rules, from the message
+// template or the default one of the consolidated policy groups.
+func RulesMessage(rules []*nvapis.RESTAdmissionRule, config share.ConversionConfig) (string, error) {
+	text := config.MessageTemplate
+	if text == "" {
+		text = DefaultMergedMessageTemplate
+	}
+
+	var ids, comments, criteria []string
+	for _, rule := range rules {
+		ids = append(ids, strconv.FormatUint(uint64(rule.ID), 10))
+		if rule.Comment != "" && !slices.Contains(comments, rule.Comment) {
+			comments = append(comments, rule.Comment)
+		}
+		if summary := criteriaSummary(rule); summary != "" && !slices.Contains(criteria, summary) {
+			criteria = append(criteria, summary)
+		}
+	}
+	return renderMessage(text, messageData{
+		ID:       strings.Join(ids, ","),
+		Comment:  strings.Join(comments, "; "),
+		Criteria: strings.Join(criteria, "; "),
+	})
+}
+
+// renderMessage renders the message template with the data of the rules.
+func renderMessage(text string, data messageData) (string, error) {
+	tmpl, err := ParseMessageTemplate(text)
+	if err != nil {
+		return "", err
+	}
+
+	var message strings.Builder
+	if err = tmpl.Execute(&message, data); err != nil {
+		return "", fmt.Errorf("failed to render message template: %w", err)
+	}
+	return message.String(), nil
+}
+
+// criteriaSummary summarizes the criteria of the rule, as "name op value" separated by commas. The criteria
+// expanded from a meta criterion are summarized by the name of the meta criterion.
+func criteriaSummary(rule *nvapis.RESTAdmissionRule) string {
+	var (
+		summaries     []string
+		metaCriterion = map[string]bool{}
+	)
+	for _, criterion := range rule.Criteria {
+		if metacriterion.IsMetaCriterion(criterion.Path) {
+			if !metaCriterion[criterion.Path] {
+				metaCriterion[criterion.Path] = true
+				summaries = append(summaries, criterion.Path)
+			}
+			continue
+		}
+		summaries = append(summaries, fmt.Sprintf("%s %s %s", criterion.Name, criterion.Op, criterion.Value))
+	}
+	return strings.Join(summaries, ", ")
+}
+
+// MessageBuilder wraps the policy generated by the builder it wraps in a single-member policy group when a message
+// template is set: unlike the policy groups, the policies can't carry a rejection message.
+type MessageBuilder struct {
+	Builder
+}
+
+// messageBuilder wraps the builder to carry the rejection message of the rule, if a message template is set.
+func messageBuilder(builder Builder, config share.ConversionConfig) Builder {
+	if config.MessageTemplate == "" {
+		return builder
+	}
+	return &MessageBuilder{Builder: builder}
+}
+
+func (b *MessageBuilder) GeneratePolicy(rule *nvapis.RESTAdmissionRule, config share.ConversionConfig) (Policy, error) {
+	policy, err := b.Builder.GeneratePolicy(rule, config)
+	if err != nil {
+		return nil, err
+	}
+
+	p, ok := policy.(*policiesv1.ClusterAdmissionPolicy)
+	if !ok {
+		return policy, nil
+	}
+	message, err := ruleMessage(rule, config)
+	if err != nil {
+		return nil, fmt.Errorf("rule skipped: %w", err)
+	}
+	return singleMemberGroup(p, message), nil
+}
+
+// singleMemberGroup returns the policy group with the policy as its only member, named after its module.
+func singleMemberGroup(
+	policy *policiesv1.ClusterAdmissionPolicy,
+	message string,
+) *policiesv1.ClusterAdmissionPolicyGroup {
+	name := share.ExtractModuleName(policy.Spec.Module)
+	return &policiesv1.ClusterAdmissionPolicyGroup{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       clusterAdmissionPolicyGroupKind,
+			APIVersion: kwAPIVersion,
+		},
+		ObjectMeta: policy.ObjectMeta,
+		Spec: policiesv1.ClusterAdmissionPolicyGroupSpec{
+			ClusterPolicyGroupSpec: policiesv1.ClusterPolicyGroupSpec{
+				GroupSpec: policiesv1.GroupSpec{
+					Message:         message,
+					Rules:           policy.Spec.Rules,
+					Mode:            policy.Spec.Mode,
+					PolicyServer:    policy.Spec.PolicyServer,
+					BackgroundAudit: policy.Spec.BackgroundAudit,
+					MatchConditions: policy.Spec.MatchConditions,
+					Expression:      name + "()",
+				},
+				Policies: policiesv1.PolicyGroupMembersWithContext{
+					name: policiesv1.PolicyGroupMemberWithContext{
+						PolicyGroupMember: policiesv1.PolicyGroupMember{
+							Module:   policy.Spec.Module,
+							Settings: policy.Spec.Settings,
+						},
+						ContextAwareResources: policy.Spec.ContextAwareResources,
+					},
+				},
+			},
+			NamespaceSelector: policy.Spec.NamespaceSelector,
+		},
+	}
+}
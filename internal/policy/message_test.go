@@ -0,0 +1,222 @@
+package policy
+
+import (
+	"testing"
+
+	policiesv1 "github.com/kubewarden/adm-controller/api/policies/v1"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/handlers"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/metacriterion"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/share"
+	nvapis "github.com/neuvector/neuvector/controller/api"
+	nvdata "github.com/neuvector/neuvector/share"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuleMessage(t *testing.T) {
+	rule := &nvapis.RESTAdmissionRule{
+		ID:      1234,
+		Comment: "no host IPC",
+		Criteria: []*nvapis.RESTAdmRuleCriterion{
+			{Name: handlers.RuleShareIPC, Op: nvdata.CriteriaOpEqual, Value: "true"},
+			{Name: handlers.RuleNamespace, Op: nvdata.CriteriaOpContainsAny, Value: "team-a,team-b"},
+		},
+	}
+
+	tests := []struct {
+		name            string
+		rule            *nvapis.RESTAdmissionRule
+		messageTemplate string
+		expectedMessage string
+		expectedErr     string
+	}{
+		{
+			name:            "default message template",
+			rule:            rule,
+			expectedMessage: "violate NeuVector rule (id=1234), comment no host IPC",
+		},
+		{
+			name:            "message template with the criteria summary",
+			rule:            rule,
+			messageTemplate: "blocked by NeuVector rule {{.ID}} ({{.Comment}}): {{.Criteria}}",
+			expectedMessage: "blocked by NeuVector rule 1234 (no host IPC): " +
+				"shareIpcWithHost = true, namespace containsAny team-a,team-b",
+		},
+		{
+			name: "meta criterion summarized by its name",
+			rule: &nvapis.RESTAdmissionRule{
+				ID: 1235,
+				Criteria: []*nvapis.RESTAdmRuleCriterion{
+					{Name: handlers.RuleShareIPC, Path: metacriterion.RulePSPBestPractices},
+					{Name: handlers.RuleRunAsPrivileged, Path: metacriterion.RulePSPBestPractices},
+					{Name: handlers.RuleNamespace, Op: nvdata.CriteriaOpContainsAny, Value: "team-a"},
+				},
+			},
+			messageTemplate: "{{.Criteria}}",
+			expectedMessage: "pspCompliance, namespace containsAny team-a",
+		},
+		{
+			name:            "invalid message template",
+			rule:            rule,
+			messageTemplate: "{{.ID",
+			expectedErr:     "invalid message template",
+		},
+		{
+			name:            "unknown field",
+			rule:            rule,
+			messageTemplate: "{{.Name}}",
+			expectedErr:     "failed to render message template",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, err := ruleMessage(tt.rule, share.ConversionConfig{MessageTemplate: tt.messageTemplate})
+			if tt.expectedErr != "" {
+				require.ErrorContains(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedMessage, message)
+		})
+	}
+}
+
+func TestRulesMessage(t *testing.T) {
+	nginx := &nvapis.RESTAdmRuleCriterion{Name: handlers.RuleImage, Op: nvdata.CriteriaOpContainsAny, Value: "nginx"}
+	rules := []*nvapis.RESTAdmissionRule{
+		{
+			ID:       1000,
+			Comment:  "no nginx",
+			Criteria: []*nvapis.RESTAdmRuleCriterion{nginx},
+		},
+		{
+			ID:       1001,
+			Comment:  "no nginx",
+			Criteria: []*nvapis.RESTAdmRuleCriterion{nginx},
+		},
+		{ID: 1002, Comment: "no nginx in team-a"},
+	}
+
+	message, err := RulesMessage(rules, share.ConversionConfig{})
+	require.NoError(t, err)
+	require.Equal(t, "violate NeuVector rules (ids=1000,1001,1002)", message)
+
+	message, err = RulesMessage(rules, share.ConversionConfig{MessageTemplate: "{{.ID}}: {{.Comment}} ({{.Criteria}})"})
+	require.NoError(t, err)
+	require.Equal(t, "1000,1001,1002: no nginx; no nginx in team-a (image containsAny nginx)", message)
+}
+
+func TestFactory_GeneratePolicy_MessageTemplate(t *testing.T) {
+	factory := NewFactory()
+	factory.SetHandlers(map[string]share.PolicyHandler{
+		handlers.RuleShareIPC:                  handlers.NewHostNamespaceHandler(),
+		handlers.RuleShareNetwork:              handlers.NewHostNamespaceHandler(),
+		handlers.RuleNamespace:                 handlers.NewNamespaceHandler(),
+		handlers.RuleImageScanned:              handlers.NewImageCVEHandler("sbomscanner", "amd64"),
+		handlers.RuleAllowPrivilegedEscalation: handlers.NewAllowPrivilegedEscalationHandler(),
+	})
+	shareIPC := &nvapis.RESTAdmRuleCriterion{Name: handlers.RuleShareIPC, Op: nvdata.CriteriaOpEqual, Value: "true"}
+	shareNetwork := &nvapis.RESTAdmRuleCriterion{
+		Name:  handlers.RuleShareNetwork,
+		Op:    nvdata.CriteriaOpEqual,
+		Value: "true",
+	}
+	config := share.ConversionConfig{Mode: "protect", MessageTemplate: "NeuVector rule {{.ID}}: {{.Criteria}}"}
+
+	t.Run("policy wrapped in a single-member policy group", func(t *testing.T) {
+		rule := &nvapis.RESTAdmissionRule{ID: 1234, Criteria: []*nvapis.RESTAdmRuleCriterion{shareIPC}}
+		expected, err := (&CAPBuilder{handlers: factory.handlers}).GeneratePolicy(rule, config)
+		require.NoError(t, err)
+		policy := expected.(*policiesv1.ClusterAdmissionPolicy)
+
+		generated, err := factory.GeneratePolicy(rule, config)
+		require.NoError(t, err)
+		group, ok := generated.(*policiesv1.ClusterAdmissionPolicyGroup)
+		require.True(t, ok)
+		require.Equal(t, clusterAdmissionPolicyGroupKind, group.Kind)
+		require.Equal(t, "neuvector-rule-1234-conversion", group.Name)
+		require.Equal(t, "NeuVector rule 1234: shareIpcWithHost = true", group.Spec.Message)
+		require.Equal(t, "host_namespaces_psp()", group.Spec.Expression)
+		require.Equal(t, policy.Spec.Rules, group.Spec.Rules)
+		require.Equal(t, policy.Spec.Mode, group.Spec.Mode)
+		require.Len(t, group.Spec.Policies, 1)
+		require.Equal(t, policy.Spec.Module, group.Spec.Policies["host_namespaces_psp"].Module)
+		require.JSONEq(t,
+			string(policy.Spec.Settings.Raw),
+			string(group.Spec.Policies["host_namespaces_psp"].Settings.Raw),
+		)
+	})
+
+	t.Run("policy group message", func(t *testing.T) {
+		rule := &nvapis.RESTAdmissionRule{ID: 1234, Criteria: []*nvapis.RESTAdmRuleCriterion{shareIPC, shareNetwork}}
+		generated, err := factory.GeneratePolicy(rule, config)
+		require.NoError(t, err)
+		group, ok := generated.(*policiesv1.ClusterAdmissionPolicyGroup)
+		require.True(t, ok)
+		require.Equal(t, "NeuVector rule 1234: shareIpcWithHost = true, shareNetWithHost = true", group.Spec.Message)
+	})
+
+	t.Run("context aware resources moved to the member", func(t *testing.T) {
+		rule := &nvapis.RESTAdmissionRule{
+			ID: 1234,
+			Criteria: []*nvapis.RESTAdmRuleCriterion{
+				{Name: handlers.RuleImageScanned, Op: nvdata.CriteriaOpEqual, Value: "true"},
+			},
+		}
+		generated, err := factory.GeneratePolicy(rule, config)
+		require.NoError(t, err)
+		group, ok := generated.(*policiesv1.ClusterAdmissionPolicyGroup)
+		require.True(t, ok)
+		for _, member := range group.Spec.Policies {
+			require.NotEmpty(t, member.ContextAwareResources)
+		}
+	})
+
+	t.Run("namespaced policy group", func(t *testing.T) {
+		rule := &nvapis.RESTAdmissionRule{
+			ID: 1234,
+			Criteria: []*nvapis.RESTAdmRuleCriterion{
+				shareIPC,
+				{Name: handlers.RuleNamespace, Op: nvdata.CriteriaOpContainsAny, Value: "team-a"},
+			},
+		}
+		namespacedConfig := config
+		namespacedConfig.PreferNamespaced = true
+		generated, err := factory.GeneratePolicy(rule, namespacedConfig)
+		require.NoError(t, err)
+		group, ok := generated.(*policiesv1.AdmissionPolicyGroup)
+		require.True(t, ok)
+		require.Equal(t, "team-a", group.Namespace)
+		require.Equal(t,
+			"NeuVector rule 1234: shareIpcWithHost = true, namespace containsAny team-a",
+			group.Spec.Message,
+		)
+	})
+
+	t.Run("split policy groups", func(t *testing.T) {
+		psp := metacriterion.RulePSPBestPractices
+		rule := &nvapis.RESTAdmissionRule{
+			ID: 1234,
+			Criteria: []*nvapis.RESTAdmRuleCriterion{
+				{Name: handlers.RuleShareIPC, Op: nvdata.CriteriaOpEqual, Value: "true", Path: psp},
+				{Name: handlers.RuleAllowPrivilegedEscalation, Op: nvdata.CriteriaOpEqual, Value: "true", Path: psp},
+			},
+		}
+		splitConfig := config
+		splitConfig.GroupStrategy = share.GroupStrategySplit
+		policies, err := factory.GeneratePolicies(rule, splitConfig)
+		require.NoError(t, err)
+		require.Len(t, policies, 2)
+		var names []string
+		for _, policy := range policies {
+			group, ok := policy.(*policiesv1.ClusterAdmissionPolicyGroup)
+			require.True(t, ok)
+			require.Equal(t, "NeuVector rule 1234: pspCompliance", group.Spec.Message)
+			names = append(names, group.Name)
+		}
+		require.Equal(t, []string{
+			"neuvector-rule-1234-conversion-allow-privilege-escalation-psp",
+			"neuvector-rule-1234-conversion-host-namespaces-psp",
+		}, names)
+	})
+}
@@ -0,0 +1,151 @@
+package policy
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/handlers"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/share"
+
+	nvapis "github.com/neuvector/neuvector/controller/api"
+	nvdata "github.com/neuvector/neuvector/share"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// namespaceNameLabel is the label Kubernetes sets on every namespace to its name
+	namespaceNameLabel = "kubernetes.io/metadata.name"
+	// namespaceMatchConditionName is the match condition scoping the policy to the namespaces of the rule
+	namespaceMatchConditionName = "neuvector-namespace"
+)
+
+// buildNamespaceScope scopes the policy to the namespaces of the namespace criteria, which must all match. The
+// namespace names are selected by a namespace selector, with the match expressions of every criterion. The values
+// the selector can't express, the patterns with the * and ? wildcards matched as NeuVector does, need a match
+// condition on the request namespace, which then enforces all the values of their criterion.
+func (b *BaseBuilder) buildNamespaceScope(
+	criteria []*nvapis.RESTAdmRuleCriterion,
+) (*metav1.LabelSelector, *admissionregistrationv1.MatchCondition) {
+	var selector *metav1.LabelSelector
+	var conditions []admissionregistrationv1.MatchCondition
+	for _, criterion := range criteria {
+		namespaces := namespaceValues(criterion)
+		if !slices.ContainsFunc(namespaces, requiresNamespaceMatchCondition) {
+			if selector == nil {
+				selector = &metav1.LabelSelector{}
+			}
+			requirement := buildNamespaceRequirement(criterion, namespaces)
+			selector.MatchExpressions = append(selector.MatchExpressions, requirement)
+			continue
+		}
+
+		conditions = mergeMatchCondition(conditions, buildNamespaceMatchCondition(criterion, namespaces))
+	}
+
+	if len(conditions) == 0 {
+		return selector, nil
+	}
+	return selector, &conditions[0]
+}
+
+// buildNamespaceRequirement selects the namespaces by their name label, set by Kubernetes on every namespace.
+// A deny rule applies in the namespaces the criterion contains, or in every other namespace for notContainsAny.
+func buildNamespaceRequirement(
+	criterion *nvapis.RESTAdmRuleCriterion,
+	namespaces []string,
+) metav1.LabelSelectorRequirement {
+	operator := metav1.LabelSelectorOpIn
+	if criterion.Op == nvdata.CriteriaOpNotContainsAny {
+		operator = metav1.LabelSelectorOpNotIn
+	}
+	return metav1.LabelSelectorRequirement{Key: namespaceNameLabel, Operator: operator, Values: namespaces}
+}
+
+// buildNamespaceMatchCondition matches the request namespace against the names and the patterns of the criterion.
+func buildNamespaceMatchCondition(
+	criterion *nvapis.RESTAdmRuleCriterion,
+	namespaces []string,
+) *admissionregistrationv1.MatchCondition {
+	var names []string
+	var matches []string
+	for _, namespace := range namespaces {
+		if !share.HasWildcard(namespace) {
+			names = append(names, strconv.Quote(namespace))
+			continue
+		}
+
+		pattern := share.ConvertToRegexPattern(namespace)
+		matches = append(matches, fmt.Sprintf("request.namespace.matches(%s)", strconv.Quote(pattern)))
+	}
+	if len(names) > 0 {
+		matches = slices.Insert(matches, 0, fmt.Sprintf("request.namespace in [%s]", strings.Join(names, ", ")))
+	}
+
+	expression := strings.Join(matches, " || ")
+	if criterion.Op == nvdata.CriteriaOpNotContainsAny {
+		expression = fmt.Sprintf("!(%s)", expression)
+	}
+	return &admissionregistrationv1.MatchCondition{Name: namespaceMatchConditionName, Expression: expression}
+}
+
+// mergeMatchCondition adds the match condition to the match conditions of the policy. The expression of a
+// match condition with the same name is combined with it, both must match.
+func mergeMatchCondition(
+	conditions []admissionregistrationv1.MatchCondition,
+	condition *admissionregistrationv1.MatchCondition,
+) []admissionregistrationv1.MatchCondition {
+	if condition == nil {
+		return conditions
+	}
+
+	idx := slices.IndexFunc(conditions, func(existing admissionregistrationv1.MatchCondition) bool {
+		return existing.Name == condition.Name
+	})
+	if idx == -1 {
+		return append(conditions, *condition)
+	}
+
+	conditions[idx].Expression = fmt.Sprintf("(%s) && (%s)", conditions[idx].Expression, condition.Expression)
+	return conditions
+}
+
+// singleNamespace returns the namespace of the rule, if its namespace criterion selects a single namespace by name.
+func singleNamespace(rule *nvapis.RESTAdmissionRule) (string, bool) {
+	var namespaces []string
+	for _, criterion := range rule.Criteria {
+		if criterion.Name != handlers.RuleNamespace {
+			continue
+		}
+		if criterion.Op != nvdata.CriteriaOpContainsAny || len(namespaces) > 0 {
+			return "", false
+		}
+		namespaces = namespaceValues(criterion)
+	}
+
+	if len(namespaces) != 1 || len(validation.IsDNS1123Label(namespaces[0])) > 0 {
+		return "", false
+	}
+	return namespaces[0], true
+}
+
+// namespaceValues returns the namespaces of the criterion, trimmed and without duplicates.
+func namespaceValues(criterion *nvapis.RESTAdmRuleCriterion) []string {
+	var namespaces []string
+	for namespace := range strings.SplitSeq(criterion.Value, ",") {
+		if namespace = strings.TrimSpace(namespace); namespace != "" && !slices.Contains(namespaces, namespace) {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	return namespaces
+}
+
+// requiresNamespaceMatchCondition returns true if the namespace value can't be selected by its name label:
+// a pattern, or a value which isn't a valid label value.
+func requiresNamespaceMatchCondition(namespace string) bool {
+	return share.HasWildcard(namespace) || len(validation.IsValidLabelValue(namespace)) > 0
+}
@@ -0,0 +1,145 @@
+package policy
+
+import (
+	"testing"
+
+	nvapis "github.com/neuvector/neuvector/controller/api"
+	"github.com/stretchr/testify/require"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestBuildNamespaceScope(t *testing.T) {
+	builder := BaseBuilder{}
+
+	tests := []struct {
+		name              string
+		criteria          []*nvapis.RESTAdmRuleCriterion
+		expectedSelector  *metav1.LabelSelector
+		expectedCondition string
+	}{
+		{
+			name: "contains any",
+			criteria: []*nvapis.RESTAdmRuleCriterion{
+				{Name: "namespace", Op: "containsAny", Value: "foo,bar"},
+			},
+			expectedSelector: &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: namespaceNameLabel, Operator: metav1.LabelSelectorOpIn, Values: []string{"foo", "bar"}},
+				},
+			},
+		},
+		{
+			name: "not contains any with spaces and duplicates",
+			criteria: []*nvapis.RESTAdmRuleCriterion{
+				{Name: "namespace", Op: "notContainsAny", Value: " foo, bar ,,foo"},
+			},
+			expectedSelector: &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: namespaceNameLabel, Operator: metav1.LabelSelectorOpNotIn, Values: []string{"foo", "bar"}},
+				},
+			},
+		},
+		{
+			name: "wildcard",
+			criteria: []*nvapis.RESTAdmRuleCriterion{
+				{Name: "namespace", Op: "containsAny", Value: "dev-*"},
+			},
+			expectedCondition: `request.namespace.matches("^dev-.*$")`,
+		},
+		{
+			name: "wildcard with regex syntax",
+			criteria: []*nvapis.RESTAdmRuleCriterion{
+				{Name: "namespace", Op: "containsAny", Value: "team-[ab]?.x*"},
+			},
+			expectedCondition: `request.namespace.matches("^team-\\[ab\\].\\.x.*$")`,
+		},
+		{
+			name: "names and wildcards",
+			criteria: []*nvapis.RESTAdmRuleCriterion{
+				{Name: "namespace", Op: "containsAny", Value: "foo, dev-*, bar"},
+			},
+			expectedCondition: `request.namespace in ["foo", "bar"] || ` +
+				`request.namespace.matches("^dev-.*$")`,
+		},
+		{
+			name: "not contains any wildcard",
+			criteria: []*nvapis.RESTAdmRuleCriterion{
+				{Name: "namespace", Op: "notContainsAny", Value: "kube-*,cattle-*"},
+			},
+			expectedCondition: `!(request.namespace.matches("^kube-.*$") || request.namespace.matches("^cattle-.*$"))`,
+		},
+		{
+			name: "contains any and not contains any",
+			criteria: []*nvapis.RESTAdmRuleCriterion{
+				{Name: "namespace", Op: "containsAny", Value: "foo,bar"},
+				{Name: "namespace", Op: "notContainsAny", Value: "bar"},
+			},
+			expectedSelector: &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: namespaceNameLabel, Operator: metav1.LabelSelectorOpIn, Values: []string{"foo", "bar"}},
+					{Key: namespaceNameLabel, Operator: metav1.LabelSelectorOpNotIn, Values: []string{"bar"}},
+				},
+			},
+		},
+		{
+			name: "names and wildcard criteria",
+			criteria: []*nvapis.RESTAdmRuleCriterion{
+				{Name: "namespace", Op: "notContainsAny", Value: "kube-system"},
+				{Name: "namespace", Op: "containsAny", Value: "dev-*"},
+			},
+			expectedSelector: &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: namespaceNameLabel, Operator: metav1.LabelSelectorOpNotIn, Values: []string{"kube-system"}},
+				},
+			},
+			expectedCondition: `request.namespace.matches("^dev-.*$")`,
+		},
+		{
+			name: "wildcard criteria",
+			criteria: []*nvapis.RESTAdmRuleCriterion{
+				{Name: "namespace", Op: "containsAny", Value: "dev-*"},
+				{Name: "namespace", Op: "notContainsAny", Value: "dev-test-*"},
+			},
+			expectedCondition: `(request.namespace.matches("^dev-.*$")) && ` +
+				`(!(request.namespace.matches("^dev-test-.*$")))`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selector, condition := builder.buildNamespaceScope(tt.criteria)
+			require.Equal(t, tt.expectedSelector, selector)
+			if tt.expectedCondition == "" {
+				require.Nil(t, condition)
+				return
+			}
+			require.Equal(t, &admissionregistrationv1.MatchCondition{
+				Name:       namespaceMatchConditionName,
+				Expression: tt.expectedCondition,
+			}, condition)
+		})
+	}
+}
+
+func TestMergeMatchCondition(t *testing.T) {
+	existing := []admissionregistrationv1.MatchCondition{
+		{Name: "exclude-system", Expression: "request.userInfo.username != 'system:admin'"},
+		{Name: namespaceMatchConditionName, Expression: `request.namespace in ["foo"]`},
+	}
+	condition := &admissionregistrationv1.MatchCondition{
+		Name:       namespaceMatchConditionName,
+		Expression: `request.namespace.matches("^dev-.*$")`,
+	}
+
+	require.Equal(t, existing, mergeMatchCondition(existing, nil))
+	require.Equal(t, []admissionregistrationv1.MatchCondition{*condition}, mergeMatchCondition(nil, condition))
+
+	merged := mergeMatchCondition(existing, condition)
+	require.Len(t, merged, 2)
+	require.Equal(t, existing[0], merged[0])
+	require.Equal(t,
+		`(request.namespace in ["foo"]) && (request.namespace.matches("^dev-.*$"))`,
+		merged[1].Expression,
+	)
+}
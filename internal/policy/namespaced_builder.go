@@ -0,0 +1,91 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/share"
+
+	policiesv1 "github.com/kubewarden/adm-controller/api/policies/v1"
+	nvapis "github.com/neuvector/neuvector/controller/api"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NamespacedBuilder generates the namespaced AdmissionPolicy or AdmissionPolicyGroup of a rule targeting a single
+// namespace, from the ClusterAdmissionPolicy or ClusterAdmissionPolicyGroup of the builder it wraps.
+type NamespacedBuilder struct {
+	Builder
+
+	namespace string
+}
+
+func (b *NamespacedBuilder) GeneratePolicy(
+	rule *nvapis.RESTAdmissionRule,
+	config share.ConversionConfig,
+) (Policy, error) {
+	policy, err := b.Builder.GeneratePolicy(rule, config)
+	if err != nil {
+		return nil, err
+	}
+
+	switch p := policy.(type) {
+	case *policiesv1.ClusterAdmissionPolicy:
+		return b.admissionPolicy(p)
+	case *policiesv1.ClusterAdmissionPolicyGroup:
+		return b.admissionPolicyGroup(p)
+	default:
+		return nil, fmt.Errorf("unexpected policy type %T", policy)
+	}
+}
+
+// admissionPolicy moves the policy in the namespace, which replaces its namespace selector.
+func (b *NamespacedBuilder) admissionPolicy(
+	policy *policiesv1.ClusterAdmissionPolicy,
+) (*policiesv1.AdmissionPolicy, error) {
+	if len(policy.Spec.ContextAwareResources) > 0 {
+		return nil, errors.New("namespaced policies can't access context aware resources")
+	}
+
+	return &policiesv1.AdmissionPolicy{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       admissionPolicyKind,
+			APIVersion: kwAPIVersion,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      policy.Name,
+			Namespace: b.namespace,
+		},
+		Spec: policiesv1.AdmissionPolicySpec{
+			PolicySpec: policy.Spec.PolicySpec,
+		},
+	}, nil
+}
+
+// admissionPolicyGroup moves the policy group in the namespace, which replaces its namespace selector.
+func (b *NamespacedBuilder) admissionPolicyGroup(
+	group *policiesv1.ClusterAdmissionPolicyGroup,
+) (*policiesv1.AdmissionPolicyGroup, error) {
+	policies := policiesv1.PolicyGroupMembers{}
+	for name, member := range group.Spec.Policies {
+		if len(member.ContextAwareResources) > 0 {
+			return nil, errors.New("namespaced policies can't access context aware resources")
+		}
+		policies[name] = member.PolicyGroupMember
+	}
+
+	return &policiesv1.AdmissionPolicyGroup{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       admissionPolicyGroupKind,
+			APIVersion: kwAPIVersion,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      group.Name,
+			Namespace: b.namespace,
+		},
+		Spec: policiesv1.AdmissionPolicyGroupSpec{
+			GroupSpec: group.Spec.GroupSpec,
+			Policies:  policies,
+		},
+	}, nil
+}
@@ -0,0 +1,135 @@
+package policy
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/customrule"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/share"
+
+	policiesv1 "github.com/kubewarden/adm-controller/api/policies/v1"
+	nvapis "github.com/neuvector/neuvector/controller/api"
+)
+
+// GeneratePolicies generates the policies of the rule: its policy, or a policy per member instead of its policy
+// group when the group strategy splits it. A policy group is only split when it rejects the requests rejected by
+// any of its members, as independent policies do, such as the group of a meta criterion: the criteria of the other
+// groups must be evaluated together. The auto strategy only keeps the groups whose members use several modules.
+func (f *Factory) GeneratePolicies(rule *nvapis.RESTAdmissionRule, config share.ConversionConfig) ([]Policy, error) {
+	policy, err := f.GeneratePolicy(rule, config)
+	if err != nil {
+		return nil, err
+	}
+	if config.GroupStrategy != share.GroupStrategySplit && config.GroupStrategy != share.GroupStrategyAuto {
+		return []Policy{policy}, nil
+	}
+
+	members, modules, expression, ok := groupMembers(policy)
+	if !ok || !isConjunction(expression, members) {
+		return []Policy{policy}, nil
+	}
+	if config.GroupStrategy == share.GroupStrategyAuto && len(modules) > 1 {
+		return []Policy{policy}, nil
+	}
+
+	memberRules, err := f.splitRule(rule, config)
+	if err != nil {
+		return nil, err
+	}
+
+	policies := make([]Policy, 0, len(memberRules))
+	for _, member := range members {
+		memberRule := memberRules[member]
+		var builder Builder = &CAPBuilder{handlers: f.handlers}
+		if customrule.IsCustomRule(memberRule.Criteria[0].Name) {
+			builder = &CustomModuleBuilder{handlers: f.handlers}
+		}
+
+		builder = f.namespacedBuilder(messageBuilder(builder, config), memberRule, config)
+		memberPolicy, memberErr := builder.GeneratePolicy(memberRule, config)
+		if memberErr != nil {
+			return nil, fmt.Errorf("failed to generate the policy of %s: %w", member, memberErr)
+		}
+		if len(members) > 1 {
+			renamePolicy(memberPolicy, member)
+		}
+		policies = append(policies, memberPolicy)
+	}
+	return policies, nil
+}
+
+// splitRule splits the rule in a rule per member of its policy group enforcing its criteria, by member name.
+// The rules keep the namespace criteria of the rule.
+func (f *Factory) splitRule(
+	rule *nvapis.RESTAdmissionRule,
+	config share.ConversionConfig,
+) (map[string]*nvapis.RESTAdmissionRule, error) {
+	groupBuilder := &CAPGBuilder{handlers: f.handlers}
+	criteria, namespaceCriteria, _, err := groupBuilder.groupCriteria(rule, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to group criteria by module: %w", err)
+	}
+
+	memberRules := map[string]*nvapis.RESTAdmissionRule{}
+	for _, members := range criteria {
+		for _, member := range members {
+			memberRule := *rule
+			memberRule.Criteria = slices.Concat(member.criteria, namespaceCriteria)
+			memberRules[member.name] = &memberRule
+		}
+	}
+	return memberRules, nil
+}
+
+// groupMembers returns the sorted member names, the sorted modules of the members and the expression of a
+// policy group.
+func groupMembers(policy Policy) ([]string, []string, string, bool) {
+	modules := map[string]bool{}
+	switch p := policy.(type) {
+	case *policiesv1.ClusterAdmissionPolicyGroup:
+		for _, member := range p.Spec.Policies {
+			modules[member.Module] = true
+		}
+		return slices.Sorted(maps.Keys(p.Spec.Policies)), slices.Sorted(maps.Keys(modules)), p.Spec.Expression, true
+	case *policiesv1.AdmissionPolicyGroup:
+		for _, member := range p.Spec.Policies {
+			modules[member.Module] = true
+		}
+		return slices.Sorted(maps.Keys(p.Spec.Policies)), slices.Sorted(maps.Keys(modules)), p.Spec.Expression, true
+	default:
+		return nil, nil, "", false
+	}
+}
+
+// isConjunction returns true if the expression accepts the requests accepted by every member.
+func isConjunction(expression string, members []string) bool {
+	var calls []string
+	for _, call := range strings.Split(expression, "&&") {
+		calls = append(calls, strings.TrimSpace(call))
+	}
+	slices.Sort(calls)
+
+	expected := make([]string, 0, len(members))
+	for _, member := range members {
+		expected = append(expected, member+"()")
+	}
+	return slices.Equal(calls, expected)
+}
+
+// renamePolicy suffixes the name of the policy generated for a member of the policy group of the rule with the
+// member name, or of its single-member policy group when it carries the rejection message.
+func renamePolicy(policy Policy, member string) {
+	suffix := "-" + strings.ReplaceAll(member, "_", "-")
+	switch p := policy.(type) {
+	case *policiesv1.ClusterAdmissionPolicy:
+		p.Name += suffix
+	case *policiesv1.AdmissionPolicy:
+		p.Name += suffix
+	case *policiesv1.ClusterAdmissionPolicyGroup:
+		p.Name += suffix
+	case *policiesv1.AdmissionPolicyGroup:
+		p.Name += suffix
+	}
+}
@@ -0,0 +1,242 @@
+package policy
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/handlers"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/metacriterion"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/share"
+	nvapis "github.com/neuvector/neuvector/controller/api"
+	nvdata "github.com/neuvector/neuvector/share"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestFactory_GeneratePolicies(t *testing.T) {
+	shareIPC := &nvapis.RESTAdmRuleCriterion{Name: handlers.RuleShareIPC, Op: nvdata.CriteriaOpEqual, Value: "true"}
+	shareNetwork := &nvapis.RESTAdmRuleCriterion{
+		Name:  handlers.RuleShareNetwork,
+		Op:    nvdata.CriteriaOpEqual,
+		Value: "true",
+	}
+	escalation := &nvapis.RESTAdmRuleCriterion{
+		Name:  handlers.RuleAllowPrivilegedEscalation,
+		Op:    nvdata.CriteriaOpEqual,
+		Value: "true",
+	}
+	namespace := &nvapis.RESTAdmRuleCriterion{
+		Name:  handlers.RuleNamespace,
+		Op:    nvdata.CriteriaOpContainsAny,
+		Value: "team-a",
+	}
+	// The criteria expanded from the pspCompliance meta criterion
+	psp := func(name string) *nvapis.RESTAdmRuleCriterion {
+		return &nvapis.RESTAdmRuleCriterion{
+			Name:  name,
+			Op:    nvdata.CriteriaOpEqual,
+			Value: "true",
+			Path:  metacriterion.RulePSPBestPractices,
+		}
+	}
+	pspCriteria := []*nvapis.RESTAdmRuleCriterion{
+		psp(handlers.RuleShareIPC),
+		psp(handlers.RuleAllowPrivilegedEscalation),
+	}
+
+	tests := []struct {
+		name               string
+		criteria           []*nvapis.RESTAdmRuleCriterion
+		config             share.ConversionConfig
+		expectedKinds      []string
+		expectedNames      []string
+		expectedNamespaces []string
+	}{
+		{
+			name:          "group strategy keeps the policy group",
+			criteria:      pspCriteria,
+			config:        share.ConversionConfig{Mode: "protect", GroupStrategy: share.GroupStrategyGroup},
+			expectedKinds: []string{clusterAdmissionPolicyGroupKind},
+			expectedNames: []string{"neuvector-rule-1234-conversion"},
+		},
+		{
+			name:     "split strategy splits the policy group of a meta criterion",
+			criteria: pspCriteria,
+			config:   share.ConversionConfig{Mode: "protect", GroupStrategy: share.GroupStrategySplit},
+			expectedKinds: []string{
+				clusterAdmissionPolicyKind,
+				clusterAdmissionPolicyKind,
+			},
+			expectedNames: []string{
+				"neuvector-rule-1234-conversion-allow-privilege-escalation-psp",
+				"neuvector-rule-1234-conversion-host-namespaces-psp",
+			},
+		},
+		{
+			name:          "split strategy keeps the policy group of the criteria evaluated together",
+			criteria:      []*nvapis.RESTAdmRuleCriterion{shareIPC, escalation},
+			config:        share.ConversionConfig{Mode: "protect", GroupStrategy: share.GroupStrategySplit},
+			expectedKinds: []string{clusterAdmissionPolicyGroupKind},
+			expectedNames: []string{"neuvector-rule-1234-conversion"},
+		},
+		{
+			name:          "split strategy keeps the policy group of the criteria of a single module",
+			criteria:      []*nvapis.RESTAdmRuleCriterion{shareIPC, shareNetwork},
+			config:        share.ConversionConfig{Mode: "protect", GroupStrategy: share.GroupStrategySplit},
+			expectedKinds: []string{clusterAdmissionPolicyGroupKind},
+			expectedNames: []string{"neuvector-rule-1234-conversion"},
+		},
+		{
+			name:     "split strategy keeps the namespace criteria",
+			criteria: append(slices.Clone(pspCriteria), namespace),
+			config: share.ConversionConfig{
+				Mode:             "protect",
+				GroupStrategy:    share.GroupStrategySplit,
+				PreferNamespaced: true,
+			},
+			expectedKinds: []string{admissionPolicyKind, admissionPolicyKind},
+			expectedNames: []string{
+				"neuvector-rule-1234-conversion-allow-privilege-escalation-psp",
+				"neuvector-rule-1234-conversion-host-namespaces-psp",
+			},
+			expectedNamespaces: []string{"team-a", "team-a"},
+		},
+		{
+			name:          "auto strategy keeps the policy group of several modules",
+			criteria:      pspCriteria,
+			config:        share.ConversionConfig{Mode: "protect", GroupStrategy: share.GroupStrategyAuto},
+			expectedKinds: []string{clusterAdmissionPolicyGroupKind},
+			expectedNames: []string{"neuvector-rule-1234-conversion"},
+		},
+		{
+			name:          "auto strategy merges the criteria of a single module",
+			criteria:      []*nvapis.RESTAdmRuleCriterion{psp(handlers.RuleShareIPC), psp(handlers.RuleShareNetwork)},
+			config:        share.ConversionConfig{Mode: "protect", GroupStrategy: share.GroupStrategyAuto},
+			expectedKinds: []string{clusterAdmissionPolicyKind},
+			expectedNames: []string{"neuvector-rule-1234-conversion"},
+		},
+		{
+			name:          "single criterion",
+			criteria:      []*nvapis.RESTAdmRuleCriterion{shareIPC},
+			config:        share.ConversionConfig{Mode: "protect", GroupStrategy: share.GroupStrategySplit},
+			expectedKinds: []string{clusterAdmissionPolicyKind},
+			expectedNames: []string{"neuvector-rule-1234-conversion"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			factory := NewFactory()
+			factory.SetHandlers(map[string]share.PolicyHandler{
+				handlers.RuleShareIPC:                  handlers.NewHostNamespaceHandler(),
+				handlers.RuleShareNetwork:              handlers.NewHostNamespaceHandler(),
+				handlers.RuleNamespace:                 handlers.NewNamespaceHandler(),
+				handlers.RuleAllowPrivilegedEscalation: handlers.NewAllowPrivilegedEscalationHandler(),
+			})
+
+			policies, err := factory.GeneratePolicies(
+				&nvapis.RESTAdmissionRule{ID: 1234, Criteria: tt.criteria},
+				tt.config,
+			)
+			require.NoError(t, err)
+			require.Len(t, policies, len(tt.expectedKinds))
+
+			for idx, policy := range policies {
+				object, ok := policy.(interface {
+					metav1.Object
+					runtime.Object
+				})
+				require.True(t, ok)
+				require.Equal(t, tt.expectedKinds[idx], object.GetObjectKind().GroupVersionKind().Kind)
+				require.Equal(t, tt.expectedNames[idx], object.GetName())
+				if tt.expectedNamespaces != nil {
+					require.Equal(t, tt.expectedNamespaces[idx], object.GetNamespace())
+				}
+			}
+		})
+	}
+}
+
+func TestFactory_GeneratePolicies_AutoStrategy(t *testing.T) {
+	psp := func(name string) *nvapis.RESTAdmRuleCriterion {
+		return &nvapis.RESTAdmRuleCriterion{
+			Name:  name,
+			Op:    nvdata.CriteriaOpEqual,
+			Value: "true",
+			Path:  metacriterion.RulePSPBestPractices,
+		}
+	}
+
+	tests := []struct {
+		name          string
+		criteria      []*nvapis.RESTAdmRuleCriterion
+		expectedGroup []string
+		expectedAuto  []string
+	}{
+		{
+			name:          "criteria of a single module",
+			criteria:      []*nvapis.RESTAdmRuleCriterion{psp(handlers.RuleShareIPC), psp(handlers.RuleShareNetwork)},
+			expectedGroup: []string{clusterAdmissionPolicyGroupKind},
+			expectedAuto:  []string{clusterAdmissionPolicyKind},
+		},
+		{
+			name: "criteria of several modules",
+			criteria: []*nvapis.RESTAdmRuleCriterion{
+				psp(handlers.RuleShareIPC),
+				psp(handlers.RuleAllowPrivilegedEscalation),
+			},
+			expectedGroup: []string{clusterAdmissionPolicyGroupKind},
+			expectedAuto:  []string{clusterAdmissionPolicyGroupKind},
+		},
+		{
+			name: "criteria of a single module evaluated together",
+			criteria: []*nvapis.RESTAdmRuleCriterion{
+				{Name: handlers.RuleShareIPC, Op: nvdata.CriteriaOpEqual, Value: "true"},
+				{Name: handlers.RuleShareNetwork, Op: nvdata.CriteriaOpEqual, Value: "true"},
+			},
+			expectedGroup: []string{clusterAdmissionPolicyGroupKind},
+			expectedAuto:  []string{clusterAdmissionPolicyGroupKind},
+		},
+	}
+
+	factory := NewFactory()
+	factory.SetHandlers(map[string]share.PolicyHandler{
+		handlers.RuleShareIPC:                  handlers.NewHostNamespaceHandler(),
+		handlers.RuleShareNetwork:              handlers.NewHostNamespaceHandler(),
+		handlers.RuleAllowPrivilegedEscalation: handlers.NewAllowPrivilegedEscalationHandler(),
+	})
+	kinds := func(t *testing.T, criteria []*nvapis.RESTAdmRuleCriterion, strategy string) []string {
+		policies, err := factory.GeneratePolicies(
+			&nvapis.RESTAdmissionRule{ID: 1234, Criteria: criteria},
+			share.ConversionConfig{Mode: "protect", GroupStrategy: strategy},
+		)
+		require.NoError(t, err)
+
+		var result []string
+		for _, policy := range policies {
+			object, ok := policy.(runtime.Object)
+			require.True(t, ok)
+			result = append(result, object.GetObjectKind().GroupVersionKind().Kind)
+		}
+		return result
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expectedGroup, kinds(t, tt.criteria, share.GroupStrategyGroup))
+			require.Equal(t, tt.expectedAuto, kinds(t, tt.criteria, share.GroupStrategyAuto))
+		})
+	}
+}
+
+func TestIsConjunction(t *testing.T) {
+	members := []string{"a", "b"}
+
+	require.True(t, isConjunction("a() && b()", members))
+	require.True(t, isConjunction("b() && a()", members))
+	require.False(t, isConjunction("a() || b()", members))
+	require.False(t, isConjunction("a() && !b()", members))
+	require.False(t, isConjunction("a()", members))
+	require.False(t, isConjunction("(a() && b())", members))
+}
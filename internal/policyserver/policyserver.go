@@ -0,0 +1,217 @@
+package policyserver
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	policiesv1 "github.com/kubewarden/adm-controller/api/policies/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// DefaultNamespace is the namespace of the Kubewarden controller, where the PolicyServers run.
+	DefaultNamespace = "kubewarden"
+
+	// DefaultImage is the image of the PolicyServer, matching the version of the Kubewarden API of the policies.
+	DefaultImage = "ghcr.io/kubewarden/policy-server:v1.37.2"
+
+	// DefaultReplicas is the number of replicas of the PolicyServer.
+	DefaultReplicas = 1
+
+	kwAPIVersion     = "policies.kubewarden.io/v1"
+	policyServerKind = "PolicyServer"
+)
+
+// Config configures the PolicyServer of the policies.
+type Config struct {
+	// Namespace is the namespace of the service account of the PolicyServer, DefaultNamespace when empty
+	Namespace string
+	// Image is the image of the PolicyServer, DefaultImage when empty
+	Image string
+	// Replicas is the number of replicas of the PolicyServer, DefaultReplicas when zero
+	Replicas int32
+	// SourceAuthorities are the PEM certificates of the registries of the modules, by registry host
+	SourceAuthorities map[string][]string
+	// InsecureSources are the registries the modules are pulled from without TLS verification
+	InsecureSources []string
+}
+
+// ParseSourceAuthority parses a "host=path" source authority, the path of the PEM certificate of the registry,
+// for example registry.internal:5000=ca.pem.
+func ParseSourceAuthority(authority string) (string, string, error) {
+	host, path, ok := strings.Cut(authority, "=")
+	host = strings.TrimSpace(host)
+	path = strings.TrimSpace(path)
+	if !ok || host == "" || path == "" {
+		return "", "", fmt.Errorf("invalid source authority %q, expected host=path", authority)
+	}
+	return host, path, nil
+}
+
+// contextAwareResourceNames are the resources of the kinds the policies can read as context aware resources. The
+// plural of a kind isn't always its English plural, such as the endpoints of the Endpoints kind.
+var contextAwareResourceNames = map[schema.GroupKind]string{
+	{Group: "", Kind: "ConfigMap"}:                                            "configmaps",
+	{Group: "", Kind: "Endpoints"}:                                            "endpoints",
+	{Group: "", Kind: "LimitRange"}:                                           "limitranges",
+	{Group: "", Kind: "Namespace"}:                                            "namespaces",
+	{Group: "", Kind: "Node"}:                                                 "nodes",
+	{Group: "", Kind: "PersistentVolume"}:                                     "persistentvolumes",
+	{Group: "", Kind: "PersistentVolumeClaim"}:                                "persistentvolumeclaims",
+	{Group: "", Kind: "Pod"}:                                                  "pods",
+	{Group: "", Kind: "ReplicationController"}:                                "replicationcontrollers",
+	{Group: "", Kind: "ResourceQuota"}:                                        "resourcequotas",
+	{Group: "", Kind: "Secret"}:                                               "secrets",
+	{Group: "", Kind: "Service"}:                                              "services",
+	{Group: "", Kind: "ServiceAccount"}:                                       "serviceaccounts",
+	{Group: "apps", Kind: "DaemonSet"}:                                        "daemonsets",
+	{Group: "apps", Kind: "Deployment"}:                                       "deployments",
+	{Group: "apps", Kind: "ReplicaSet"}:                                       "replicasets",
+	{Group: "apps", Kind: "StatefulSet"}:                                      "statefulsets",
+	{Group: "batch", Kind: "CronJob"}:                                         "cronjobs",
+	{Group: "batch", Kind: "Job"}:                                             "jobs",
+	{Group: "discovery.k8s.io", Kind: "EndpointSlice"}:                        "endpointslices",
+	{Group: "networking.k8s.io", Kind: "Ingress"}:                             "ingresses",
+	{Group: "networking.k8s.io", Kind: "IngressClass"}:                        "ingressclasses",
+	{Group: "networking.k8s.io", Kind: "NetworkPolicy"}:                       "networkpolicies",
+	{Group: "policy", Kind: "PodDisruptionBudget"}:                            "poddisruptionbudgets",
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRole"}:                 "clusterroles",
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRoleBinding"}:          "clusterrolebindings",
+	{Group: "rbac.authorization.k8s.io", Kind: "Role"}:                        "roles",
+	{Group: "rbac.authorization.k8s.io", Kind: "RoleBinding"}:                 "rolebindings",
+	{Group: "storage.k8s.io", Kind: "StorageClass"}:                           "storageclasses",
+	{Group: "storage.sbomscanner.kubewarden.io", Kind: "VulnerabilityReport"}: "vulnerabilityreports",
+}
+
+// ResourceName returns the resource of a context aware resource, an error if its kind isn't known.
+func ResourceName(resource policiesv1.ContextAwareResource) (string, error) {
+	groupKind := schema.FromAPIVersionAndKind(resource.APIVersion, resource.Kind).GroupKind()
+	name, ok := contextAwareResourceNames[groupKind]
+	if !ok {
+		return "", fmt.Errorf("unknown context aware resource %s of %s", resource.Kind, resource.APIVersion)
+	}
+	return name, nil
+}
+
+// ContextAwareRules returns the RBAC rules reading the context aware resources, a rule per API group.
+func ContextAwareRules(resources []policiesv1.ContextAwareResource) ([]rbacv1.PolicyRule, error) {
+	groupResources := map[string][]string{}
+	for _, resource := range resources {
+		name, err := ResourceName(resource)
+		if err != nil {
+			return nil, err
+		}
+		group := schema.FromAPIVersionAndKind(resource.APIVersion, resource.Kind).Group
+		if !slices.Contains(groupResources[group], name) {
+			groupResources[group] = append(groupResources[group], name)
+		}
+	}
+
+	rules := make([]rbacv1.PolicyRule, 0, len(groupResources))
+	for _, group := range slices.Sorted(maps.Keys(groupResources)) {
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{group},
+			Resources: slices.Sorted(slices.Values(groupResources[group])),
+			Verbs:     []string{"get", "list", "watch"},
+		})
+	}
+	return rules, nil
+}
+
+// Manifests returns the PolicyServer named after the PolicyServer of the policies and its service account, with
+// the ClusterRole granting the rules to the service account, and its ClusterRoleBinding, when there are rules.
+// The duplicate rules are granted once.
+func Manifests(name string, config Config, rules []rbacv1.PolicyRule) []runtime.Object {
+	if config.Namespace == "" {
+		config.Namespace = DefaultNamespace
+	}
+	if config.Image == "" {
+		config.Image = DefaultImage
+	}
+	if config.Replicas == 0 {
+		config.Replicas = DefaultReplicas
+	}
+	serviceAccountName := "policy-server-" + name
+
+	manifests := []runtime.Object{
+		&policiesv1.PolicyServer{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       policyServerKind,
+				APIVersion: kwAPIVersion,
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+			},
+			Spec: policiesv1.PolicyServerSpec{
+				Image:              config.Image,
+				Replicas:           config.Replicas,
+				ServiceAccountName: serviceAccountName,
+				InsecureSources:    config.InsecureSources,
+				SourceAuthorities:  config.SourceAuthorities,
+			},
+		},
+		&corev1.ServiceAccount{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "ServiceAccount",
+				APIVersion: corev1.SchemeGroupVersion.String(),
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      serviceAccountName,
+				Namespace: config.Namespace,
+			},
+		},
+	}
+
+	var grantedRules []rbacv1.PolicyRule
+	for _, rule := range rules {
+		if !slices.ContainsFunc(grantedRules, func(granted rbacv1.PolicyRule) bool {
+			return reflect.DeepEqual(granted, rule)
+		}) {
+			grantedRules = append(grantedRules, rule)
+		}
+	}
+	if len(grantedRules) == 0 {
+		return manifests
+	}
+
+	return append(manifests,
+		&rbacv1.ClusterRole{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "ClusterRole",
+				APIVersion: rbacv1.SchemeGroupVersion.String(),
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name: serviceAccountName,
+			},
+			Rules: grantedRules,
+		},
+		&rbacv1.ClusterRoleBinding{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "ClusterRoleBinding",
+				APIVersion: rbacv1.SchemeGroupVersion.String(),
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name: serviceAccountName,
+			},
+			RoleRef: rbacv1.RoleRef{
+				APIGroup: rbacv1.GroupName,
+				Kind:     "ClusterRole",
+				Name:     serviceAccountName,
+			},
+			Subjects: []rbacv1.Subject{
+				{
+					Kind:      rbacv1.ServiceAccountKind,
+					Name:      serviceAccountName,
+					Namespace: config.Namespace,
+				},
+			},
+		},
+	)
+}
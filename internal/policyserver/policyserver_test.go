@@ -0,0 +1,113 @@
+package policyserver
+
+import (
+	"testing"
+
+	policiesv1 "github.com/kubewarden/adm-controller/api/policies/v1"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+func TestParseSourceAuthority(t *testing.T) {
+	host, path, err := ParseSourceAuthority(" registry.internal:5000 = ca.pem ")
+	require.NoError(t, err)
+	require.Equal(t, "registry.internal:5000", host)
+	require.Equal(t, "ca.pem", path)
+
+	for _, authority := range []string{"registry.internal:5000", "=ca.pem", "registry.internal:5000="} {
+		_, _, err = ParseSourceAuthority(authority)
+		require.ErrorContains(t, err, "invalid source authority", authority)
+	}
+}
+
+func TestContextAwareRules(t *testing.T) {
+	rules, err := ContextAwareRules([]policiesv1.ContextAwareResource{
+		{APIVersion: "storage.sbomscanner.kubewarden.io/v1alpha1", Kind: "VulnerabilityReport"},
+		{APIVersion: "v1", Kind: "Namespace"},
+		{APIVersion: "v1", Kind: "Endpoints"},
+		{APIVersion: "networking.k8s.io/v1", Kind: "NetworkPolicy"},
+		{APIVersion: "networking.k8s.io/v1", Kind: "Ingress"},
+		{APIVersion: "storage.sbomscanner.kubewarden.io/v1alpha1", Kind: "VulnerabilityReport"},
+	})
+	require.NoError(t, err)
+
+	verbs := []string{"get", "list", "watch"}
+	require.Equal(t, []rbacv1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"endpoints", "namespaces"}, Verbs: verbs},
+		{APIGroups: []string{"networking.k8s.io"}, Resources: []string{"ingresses", "networkpolicies"}, Verbs: verbs},
+		{
+			APIGroups: []string{"storage.sbomscanner.kubewarden.io"},
+			Resources: []string{"vulnerabilityreports"},
+			Verbs:     verbs,
+		},
+	}, rules)
+
+	rules, err = ContextAwareRules(nil)
+	require.NoError(t, err)
+	require.Empty(t, rules)
+
+	_, err = ContextAwareRules([]policiesv1.ContextAwareResource{{APIVersion: "example.com/v1", Kind: "Widget"}})
+	require.ErrorContains(t, err, "unknown context aware resource Widget of example.com/v1")
+}
+
+func TestManifests(t *testing.T) {
+	rule := rbacv1.PolicyRule{
+		APIGroups: []string{"storage.sbomscanner.kubewarden.io"},
+		Resources: []string{"vulnerabilityreports"},
+		Verbs:     []string{"get", "list", "watch"},
+	}
+
+	t.Run("defaults without rules", func(t *testing.T) {
+		manifests := Manifests("neuvector", Config{}, nil)
+		require.Len(t, manifests, 2)
+
+		policyServer, ok := manifests[0].(*policiesv1.PolicyServer)
+		require.True(t, ok)
+		require.Equal(t, "PolicyServer", policyServer.Kind)
+		require.Equal(t, "neuvector", policyServer.Name)
+		require.Equal(t, DefaultImage, policyServer.Spec.Image)
+		require.Equal(t, int32(DefaultReplicas), policyServer.Spec.Replicas)
+		require.Equal(t, "policy-server-neuvector", policyServer.Spec.ServiceAccountName)
+
+		serviceAccount, ok := manifests[1].(*corev1.ServiceAccount)
+		require.True(t, ok)
+		require.Equal(t, "policy-server-neuvector", serviceAccount.Name)
+		require.Equal(t, DefaultNamespace, serviceAccount.Namespace)
+	})
+
+	t.Run("rules granted to the service account", func(t *testing.T) {
+		config := Config{
+			Namespace:         "kw",
+			Image:             "registry.internal/policy-server:v1",
+			Replicas:          3,
+			SourceAuthorities: map[string][]string{"registry.internal": {"PEM"}},
+			InsecureSources:   []string{"registry.insecure:5000"},
+		}
+		manifests := Manifests("neuvector", config, []rbacv1.PolicyRule{rule, rule})
+		require.Len(t, manifests, 4)
+
+		policyServer, ok := manifests[0].(*policiesv1.PolicyServer)
+		require.True(t, ok)
+		require.Equal(t, "registry.internal/policy-server:v1", policyServer.Spec.Image)
+		require.Equal(t, int32(3), policyServer.Spec.Replicas)
+		require.Equal(t, config.SourceAuthorities, policyServer.Spec.SourceAuthorities)
+		require.Equal(t, config.InsecureSources, policyServer.Spec.InsecureSources)
+
+		clusterRole, ok := manifests[2].(*rbacv1.ClusterRole)
+		require.True(t, ok)
+		require.Equal(t, "policy-server-neuvector", clusterRole.Name)
+		require.Equal(t, []rbacv1.PolicyRule{rule}, clusterRole.Rules)
+
+		binding, ok := manifests[3].(*rbacv1.ClusterRoleBinding)
+		require.True(t, ok)
+		require.Equal(t, rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "ClusterRole",
+			Name:     "policy-server-neuvector",
+		}, binding.RoleRef)
+		require.Equal(t, []rbacv1.Subject{
+			{Kind: rbacv1.ServiceAccountKind, Name: "policy-server-neuvector", Namespace: "kw"},
+		}, binding.Subjects)
+	})
+}
@@ -0,0 +1,231 @@
+package resources
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// TypeWorkload is the applicable resource type of the criteria validating the pod spec of the workloads.
+	TypeWorkload = "workload"
+	// TypePVC is the applicable resource type of the criteria validating the persistent volume claims.
+	TypePVC = "pvc"
+
+	// defaultPodTemplatePath is the path of the pod template of the workload controllers.
+	defaultPodTemplatePath = "spec.template"
+)
+
+var (
+	// podTemplatePathPattern matches the dot-separated field path of a pod template.
+	podTemplatePathPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*(\.[A-Za-z][A-Za-z0-9]*)*$`)
+	// kindPattern matches the kind of a resource.
+	kindPattern = regexp.MustCompile(`^[A-Z][A-Za-z0-9]*$`)
+)
+
+// Resource is a Kubernetes resource the policies apply to, with the operations they validate, CREATE and UPDATE
+// by default. The pod template path locates the pod template of the workloads, spec.template by default: it's
+// only needed for the custom workloads storing it elsewhere.
+type Resource struct {
+	APIGroup        string                                  `json:"apiGroup"`
+	APIVersion      string                                  `json:"apiVersion"`
+	Resource        string                                  `json:"resource"`
+	Kind            string                                  `json:"kind"`
+	PodTemplatePath string                                  `json:"podTemplatePath,omitempty"`
+	Operations      []admissionregistrationv1.OperationType `json:"operations,omitempty"`
+}
+
+// Catalog maps the applicable resource types of the criteria, TypeWorkload and TypePVC, to their resources.
+type Catalog map[string][]Resource
+
+// Config is the content of the resources file. Its catalog replaces the resources of the default catalog
+// by applicable resource type, and the catalogs of the rules, by rule ID, replace them for a single rule:
+//
+//	resources:
+//	  workload:
+//	  - apiGroup: argoproj.io
+//	    apiVersion: v1alpha1
+//	    resource: rollouts
+//	    kind: Rollout
+//	rules:
+//	  "1001":
+//	    workload:
+//	    - apiGroup: ""
+//	      apiVersion: v1
+//	      resource: pods
+//	      kind: Pod
+//	      operations: [CREATE]
+type Config struct {
+	Resources Catalog            `json:"resources,omitempty"`
+	Rules     map[uint32]Catalog `json:"rules,omitempty"`
+}
+
+// DefaultCatalog returns the resources of the policies when not configured: the pods and their controllers,
+// created or updated, and the created persistent volume claims.
+func DefaultCatalog() Catalog {
+	workload := func(apiGroup, resource, kind string) Resource {
+		return Resource{APIGroup: apiGroup, APIVersion: "v1", Resource: resource, Kind: kind}
+	}
+
+	return Catalog{
+		TypeWorkload: {
+			workload("", "pods", "Pod"),
+			workload("apps", "deployments", "Deployment"),
+			workload("apps", "replicasets", "ReplicaSet"),
+			workload("apps", "daemonsets", "DaemonSet"),
+			workload("apps", "statefulsets", "StatefulSet"),
+			workload("batch", "jobs", "Job"),
+			workload("batch", "cronjobs", "CronJob"),
+		},
+		TypePVC: {
+			{
+				APIVersion: "v1",
+				Resource:   "persistentvolumeclaims",
+				Kind:       "PersistentVolumeClaim",
+				Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create},
+			},
+		},
+	}
+}
+
+// Load loads the resources file.
+func Load(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read resources file: %w", err)
+	}
+
+	var config Config
+	if err = yaml.UnmarshalStrict(data, &config); err != nil {
+		return Config{}, fmt.Errorf("failed to decode resources file: %w", err)
+	}
+	if err = config.Validate(); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+// Validate validates the catalogs of the configuration.
+func (c Config) Validate() error {
+	if err := c.Resources.validate(); err != nil {
+		return err
+	}
+	for _, ruleID := range slices.Sorted(maps.Keys(c.Rules)) {
+		if err := c.Rules[ruleID].validate(); err != nil {
+			return fmt.Errorf("rule %d: %w", ruleID, err)
+		}
+	}
+	return nil
+}
+
+// Resolve returns the resources of the applicable resource type for the rule: the resources of the rule,
+// or else of the configuration, or else of the default catalog.
+func (c Config) Resolve(ruleID uint32, resourceType string) []Resource {
+	if resources, ok := c.Rules[ruleID][resourceType]; ok {
+		return resources
+	}
+	if resources, ok := c.Resources[resourceType]; ok {
+		return resources
+	}
+	return DefaultCatalog()[resourceType]
+}
+
+// TemplatePath returns the path of the pod template of the workload, "" for the pods.
+func (r Resource) TemplatePath() string {
+	switch {
+	case r.PodTemplatePath != "":
+		return r.PodTemplatePath
+	case r.Kind == "Pod":
+		return ""
+	case r.Kind == "CronJob":
+		return "spec.jobTemplate.spec.template"
+	default:
+		return defaultPodTemplatePath
+	}
+}
+
+// HasCustomTemplatePath returns true when the pod template of the workload isn't at the default path of its kind.
+func (r Resource) HasCustomTemplatePath() bool {
+	return r.TemplatePath() != Resource{Kind: r.Kind}.TemplatePath()
+}
+
+// Rules returns the admission rules of the resources. The resources of the same API group and version,
+// validated for the same operations, share a rule.
+func Rules(resources []Resource) []admissionregistrationv1.RuleWithOperations {
+	rules := []admissionregistrationv1.RuleWithOperations{}
+	for _, resource := range resources {
+		operations := resource.operations()
+		idx := slices.IndexFunc(rules, func(rule admissionregistrationv1.RuleWithOperations) bool {
+			return rule.APIGroups[0] == resource.APIGroup && rule.APIVersions[0] == resource.APIVersion &&
+				slices.Equal(rule.Operations, operations)
+		})
+		if idx == -1 {
+			rules = append(rules, admissionregistrationv1.RuleWithOperations{
+				Operations: operations,
+				Rule: admissionregistrationv1.Rule{
+					APIGroups:   []string{resource.APIGroup},
+					APIVersions: []string{resource.APIVersion},
+				},
+			})
+			idx = len(rules) - 1
+		}
+		if !slices.Contains(rules[idx].Resources, resource.Resource) {
+			rules[idx].Resources = append(rules[idx].Resources, resource.Resource)
+		}
+	}
+	return rules
+}
+
+// operations returns the operations validated on the resource.
+func (r Resource) operations() []admissionregistrationv1.OperationType {
+	if len(r.Operations) == 0 {
+		return []admissionregistrationv1.OperationType{admissionregistrationv1.Create, admissionregistrationv1.Update}
+	}
+	return r.Operations
+}
+
+func (c Catalog) validate() error {
+	for _, resourceType := range slices.Sorted(maps.Keys(c)) {
+		if resourceType != TypeWorkload && resourceType != TypePVC {
+			return fmt.Errorf("invalid applicable resource: %s. Allowed values are \"%s\" or \"%s\"",
+				resourceType, TypeWorkload, TypePVC)
+		}
+		if len(c[resourceType]) == 0 {
+			return fmt.Errorf("no %s resources", resourceType)
+		}
+		for _, resource := range c[resourceType] {
+			if err := resource.validate(); err != nil {
+				return fmt.Errorf("%s resource %s: %w", resourceType, resource.Resource, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (r Resource) validate() error {
+	if r.Resource == "" || r.APIVersion == "" || r.Kind == "" {
+		return errors.New("resource, apiVersion and kind are required")
+	}
+	if !kindPattern.MatchString(r.Kind) {
+		return fmt.Errorf("invalid kind %q", r.Kind)
+	}
+	if r.PodTemplatePath != "" && !podTemplatePathPattern.MatchString(r.PodTemplatePath) {
+		return fmt.Errorf("invalid pod template path %q, expected a field path such as spec.template",
+			r.PodTemplatePath)
+	}
+	for _, operation := range r.Operations {
+		switch operation {
+		case admissionregistrationv1.Create, admissionregistrationv1.Update, admissionregistrationv1.Delete,
+			admissionregistrationv1.Connect, admissionregistrationv1.OperationAll:
+		default:
+			return fmt.Errorf("invalid operation: %s", operation)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package resources
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+)
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resources.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+resources:
+  workload:
+  - apiGroup: argoproj.io
+    apiVersion: v1alpha1
+    resource: rollouts
+    kind: Rollout
+rules:
+  "1001":
+    workload:
+    - apiGroup: ""
+      apiVersion: v1
+      resource: pods
+      kind: Pod
+      operations: [CREATE]
+`), 0o600))
+
+	config, err := Load(path)
+	require.NoError(t, err)
+	require.Equal(t, []Resource{
+		{APIGroup: "argoproj.io", APIVersion: "v1alpha1", Resource: "rollouts", Kind: "Rollout"},
+	}, config.Resolve(1000, TypeWorkload))
+	require.Equal(t, []Resource{
+		{
+			APIVersion: "v1",
+			Resource:   "pods",
+			Kind:       "Pod",
+			Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create},
+		},
+	}, config.Resolve(1001, TypeWorkload))
+	require.Equal(t, DefaultCatalog()[TypePVC], config.Resolve(1001, TypePVC))
+
+	unknownField := "resources:\n  workload:\n  - resource: rollouts\n    group: x\n"
+	require.NoError(t, os.WriteFile(path, []byte(unknownField), 0o600))
+	_, err = Load(path)
+	require.ErrorContains(t, err, "failed to decode resources file")
+}
+
+func TestConfigValidate(t *testing.T) {
+	rollout := Resource{APIGroup: "argoproj.io", APIVersion: "v1alpha1", Resource: "rollouts", Kind: "Rollout"}
+
+	tests := []struct {
+		name                  string
+		config                Config
+		expectedErrorContains string
+	}{
+		{
+			name: "valid configuration",
+			config: Config{
+				Resources: Catalog{TypeWorkload: {rollout}},
+				Rules:     map[uint32]Catalog{1001: {TypePVC: DefaultCatalog()[TypePVC]}},
+			},
+		},
+		{
+			name:                  "invalid applicable resource type",
+			config:                Config{Resources: Catalog{"service": {rollout}}},
+			expectedErrorContains: "invalid applicable resource: service",
+		},
+		{
+			name:                  "no resources",
+			config:                Config{Rules: map[uint32]Catalog{1001: {TypeWorkload: {}}}},
+			expectedErrorContains: "rule 1001: no workload resources",
+		},
+		{
+			name:                  "missing kind",
+			config:                Config{Resources: Catalog{TypeWorkload: {{APIVersion: "v1", Resource: "pods"}}}},
+			expectedErrorContains: "resource, apiVersion and kind are required",
+		},
+		{
+			name: "invalid kind",
+			config: Config{Resources: Catalog{TypeWorkload: {
+				{APIVersion: "v1", Resource: "pods", Kind: "pod"},
+			}}},
+			expectedErrorContains: `invalid kind "pod"`,
+		},
+		{
+			name: "invalid pod template path",
+			config: Config{Resources: Catalog{TypeWorkload: {
+				{APIVersion: "v1", Resource: "rollouts", Kind: "Rollout", PodTemplatePath: "spec.template[0]"},
+			}}},
+			expectedErrorContains: `invalid pod template path "spec.template[0]"`,
+		},
+		{
+			name: "invalid operation",
+			config: Config{Resources: Catalog{TypeWorkload: {
+				{
+					APIVersion: "v1",
+					Resource:   "pods",
+					Kind:       "Pod",
+					Operations: []admissionregistrationv1.OperationType{"PATCH"},
+				},
+			}}},
+			expectedErrorContains: "invalid operation: PATCH",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.expectedErrorContains != "" {
+				require.ErrorContains(t, err, tt.expectedErrorContains)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestTemplatePath(t *testing.T) {
+	require.Empty(t, Resource{Kind: "Pod"}.TemplatePath())
+	require.Equal(t, "spec.jobTemplate.spec.template", Resource{Kind: "CronJob"}.TemplatePath())
+	require.Equal(t, "spec.template", Resource{Kind: "Rollout"}.TemplatePath())
+	require.False(t, Resource{Kind: "Rollout"}.HasCustomTemplatePath())
+
+	service := Resource{Kind: "Service", PodTemplatePath: "spec.template.spec.template"}
+	require.Equal(t, "spec.template.spec.template", service.TemplatePath())
+	require.True(t, service.HasCustomTemplatePath())
+}
+
+func TestRules(t *testing.T) {
+	createUpdate := []admissionregistrationv1.OperationType{
+		admissionregistrationv1.Create,
+		admissionregistrationv1.Update,
+	}
+
+	rules := Rules(DefaultCatalog()[TypeWorkload])
+	require.Equal(t, []admissionregistrationv1.RuleWithOperations{
+		{
+			Operations: createUpdate,
+			Rule: admissionregistrationv1.Rule{
+				APIGroups:   []string{""},
+				APIVersions: []string{"v1"},
+				Resources:   []string{"pods"},
+			},
+		},
+		{
+			Operations: createUpdate,
+			Rule: admissionregistrationv1.Rule{
+				APIGroups:   []string{"apps"},
+				APIVersions: []string{"v1"},
+				Resources:   []string{"deployments", "replicasets", "daemonsets", "statefulsets"},
+			},
+		},
+		{
+			Operations: createUpdate,
+			Rule: admissionregistrationv1.Rule{
+				APIGroups:   []string{"batch"},
+				APIVersions: []string{"v1"},
+				Resources:   []string{"jobs", "cronjobs"},
+			},
+		},
+	}, rules)
+
+	rules = Rules([]Resource{
+		{APIVersion: "v1", Resource: "pods", Kind: "Pod"},
+		{
+			APIVersion: "v1",
+			Resource:   "persistentvolumeclaims",
+			Kind:       "PersistentVolumeClaim",
+			Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create},
+		},
+		{APIVersion: "v1", Resource: "pods", Kind: "Pod"},
+	})
+	require.Len(t, rules, 2)
+	require.Equal(t, []string{"pods"}, rules[0].Resources)
+	require.Equal(t, []string{"persistentvolumeclaims"}, rules[1].Resources)
+}
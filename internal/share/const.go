@@ -9,4 +9,25 @@ const (
 	MsgUnsupportedCriteriaOperator = "unsupported operator"
 	MsgRuleParsingError            = "failed to parse rule"
 	MsgRuleGenerateKWPolicyError   = "failed to generate Kubewarden policy"
+	MsgRegoPolicyGenerated         = "Rego policy generated (no policy YAML for custom rule)"
+	MsgConversionWarnings          = "with warnings"
+	MsgWasmPolicyGenerated         = "Rego policy compiled to Wasm (no policy YAML for custom rule)"
+	MsgCustomModulePolicyGenerated = "Rego policy generated, policy YAML references the custom module"
+	MsgRegoTestsPassed             = "rego tests passed"
+	MsgRegoTestsFailed             = "rego tests failed"
+	MsgRegoTestsNotRun             = "rego tests not run"
+	MsgPolicyGroupSplit            = "split into policies"
+	MsgPolicyConsolidated          = "consolidated into policy"
+	MsgMixedRulePolicyGenerated    = "Rego policy generated for the custom criteria, policy group references the custom module"
+	MsgRegoPolicySkipped           = "Rego policy skipped, its artifacts aren't written"
+)
+
+// The strategies generating the policies of the rules with criteria enforced by several modules.
+const (
+	// GroupStrategyGroup generates a policy group per rule with several criteria.
+	GroupStrategyGroup = "group"
+	// GroupStrategySplit generates a policy per module, unless the criteria must be evaluated together.
+	GroupStrategySplit = "split"
+	// GroupStrategyAuto generates a policy group only when the criteria are enforced by several modules.
+	GroupStrategyAuto = "auto"
 )
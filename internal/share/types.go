@@ -2,18 +2,48 @@ package share
 
 import (
 	policiesv1 "github.com/kubewarden/adm-controller/api/policies/v1"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/policyserver"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/resources"
 	nvapis "github.com/neuvector/neuvector/controller/api"
+	rbacv1 "k8s.io/api/rbac/v1"
 )
 
 // ConversionConfig holds configuration for the conversion process.
 type ConversionConfig struct {
-	OutputFile         string
-	VulReportNamespace string
-	Platform           string
-	PolicyServer       string
-	Mode               string
-	BackgroundAudit    bool
-	ShowSummary        bool
+	VulReportNamespace   string
+	Platform             string
+	PolicyServer         string
+	Mode                 string
+	BackgroundAudit      bool
+	BuildCustomWasm      bool
+	RunRegoTests         bool
+	CustomModuleRegistry string
+	CustomModuleVersion  string
+	RegoDir              string
+	RegoLayout           string
+	// SkipRego skips the rules converted to Rego instead of writing their Rego artifacts
+	SkipRego bool
+	// RegistryMirrors maps the registries of the modules to the mirrors they're pulled from
+	RegistryMirrors map[string]string
+	// CELPolicyModule overrides the CEL policy module of the criteria operators their module doesn't support
+	CELPolicyModule string
+	// PreferNamespaced generates namespaced policies for the rules targeting a single namespace
+	PreferNamespaced bool
+	// Resources configures the resources the policies apply to, and their operations, by applicable resource type
+	// and by rule
+	Resources resources.Config
+	// Consolidate merges the identical policies of the rules only differing by their namespaces
+	Consolidate bool
+	// GroupStrategy generates the policies of the rules with several criteria as a policy group, or splits
+	// them: GroupStrategyGroup when empty
+	GroupStrategy string
+	// MessageTemplate is the Go template of the rejection message of the policies, executed with the .ID, the
+	// .Comment and the .Criteria summary of the rule. The policies are wrapped in a single-member policy group to
+	// carry it, the policy groups use the default message when empty
+	MessageTemplate string
+	// PolicyServerManifests generates the PolicyServer of the policies, and the RBAC of its service account to
+	// the resources the policies access, when set
+	PolicyServerManifests *policyserver.Config
 }
 
 // PolicyHandler defines the interface that each policy handler must implement
@@ -39,4 +69,61 @@ type PolicyHandler interface {
 
 	// GetContextAwareResources returns the context aware resources for this criterion
 	GetContextAwareResources() []policiesv1.ContextAwareResource
+
+	// GetPolarity returns the decision of the policy module on the resources matching the criterion
+	GetPolarity() Polarity
+}
+
+// Polarity is the decision of the policy module of a criterion on the resources matching the criterion.
+// The expression of the policy groups is derived from the polarity of their members.
+type Polarity int
+
+const (
+	// PolarityUnknown is the polarity of the handlers not declaring it, their criteria can't be enforced.
+	PolarityUnknown Polarity = iota
+	// PolarityRejectOnMatch is the polarity of the modules rejecting the resources matching the criterion.
+	PolarityRejectOnMatch
+	// PolarityAcceptOnMatch is the polarity of the modules accepting the resources matching the criterion only,
+	// they can only be enforced by a policy group negating them.
+	PolarityAcceptOnMatch
+)
+
+// RegoPolicyHandler is implemented by the policy handlers that can fall back to a Rego policy
+// when there is no Kubewarden module for their criterion yet.
+type RegoPolicyHandler interface {
+	// RequiresRegoPolicy returns true if the criterion must be converted to a Rego policy
+	RequiresRegoPolicy() bool
+
+	// BuildRegoPolicy builds the Rego policy code for the criteria of the rule handled by this handler
+	BuildRegoPolicy(rule *nvapis.RESTAdmissionRule, criteria []*nvapis.RESTAdmRuleCriterion) (string, error)
+}
+
+// CELValidation is a validation of the Kubewarden CEL policy settings, the expression must evaluate
+// to true for the resource to be accepted.
+type CELValidation struct {
+	Expression string `json:"expression"`
+	Message    string `json:"message"`
+}
+
+// CELPolicyHandler is implemented by the policy handlers that fall back to the Kubewarden CEL policy
+// for the criteria operators their module doesn't support.
+type CELPolicyHandler interface {
+	// RequiresCELPolicy returns true if the criterion must be enforced by the CEL policy
+	RequiresCELPolicy(criterion *nvapis.RESTAdmRuleCriterion) bool
+
+	// BuildCELValidations builds the CEL policy validations for the criteria handled by this handler
+	BuildCELValidations(criteria []*nvapis.RESTAdmRuleCriterion) ([]CELValidation, error)
+}
+
+// APIAccessPolicyHandler is implemented by the policy handlers whose module calls the Kubernetes API,
+// beyond reading its context aware resources.
+type APIAccessPolicyHandler interface {
+	// GetAPIAccessRules returns the RBAC rules the PolicyServer needs to run the module
+	GetAPIAccessRules() []rbacv1.PolicyRule
+}
+
+// WarningPolicyHandler is implemented by the policy handlers whose conversion may lose precision.
+type WarningPolicyHandler interface {
+	// ConversionWarnings returns the precision losses of the criterion conversion
+	ConversionWarnings(criterion *nvapis.RESTAdmRuleCriterion) []string
 }
@@ -1,6 +1,8 @@
 package share
 
 import (
+	"fmt"
+	"regexp"
 	"strings"
 )
 
@@ -18,3 +20,50 @@ func ExtractModuleName(module string) string {
 	module = strings.ReplaceAll(module, "-", "_")
 	return module
 }
+
+// ConvertToRegexPattern converts a NeuVector value, which may contain the * and ? wildcards, to an anchored regex.
+// The other characters of the value are literals, as in NeuVector: a value without wildcards is compared as a
+// string, and a value with wildcards matches them only.
+func ConvertToRegexPattern(value string) string {
+	cleanValue := regexp.QuoteMeta(value)
+	cleanValue = strings.ReplaceAll(cleanValue, `\?`, ".")
+	cleanValue = strings.ReplaceAll(cleanValue, `\*`, ".*")
+
+	return fmt.Sprintf("^%s$", cleanValue)
+}
+
+// HasWildcard returns true if the NeuVector value contains the * or ? wildcards.
+func HasWildcard(value string) bool {
+	return strings.ContainsAny(value, "?*")
+}
+
+// ParseValuesToMap parses the NeuVector comma separated key=value pairs to a map of the keys
+// to the regex patterns of their values. A key without value matches any value.
+func ParseValuesToMap(input string) (map[string][]string, error) {
+	pairs := strings.Split(input, ",")
+	result := make(map[string][]string)
+	maxSplitParts := 2
+
+	for _, pair := range pairs {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", maxSplitParts)
+		key := strings.TrimSpace(parts[0])
+
+		if key == "" {
+			return nil, fmt.Errorf("empty key found in input: %q", pair)
+		}
+
+		if len(parts) == 1 {
+			// Only key present, treat as "key": ".*"
+			result[key] = append(result[key], ".*")
+		} else {
+			result[key] = append(result[key], ConvertToRegexPattern(strings.TrimSpace(parts[1])))
+		}
+	}
+
+	return result, nil
+}
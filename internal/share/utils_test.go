@@ -1,6 +1,7 @@
 package share
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -39,3 +40,84 @@ func TestExtractModuleName(t *testing.T) {
 		require.Equal(t, tc.expected, output)
 	}
 }
+
+func TestConvertToRegexPattern(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"No Wildcards", "abc", "^abc$"},
+		{"No Wildcards With Dot", "a.c", "^a\\.c$"},
+		{"With Asterisk", "a*", "^a.*$"},
+		{"With Question Mark", "a?.c", "^a.\\.c$"},
+		{"With Star and Dot", "*.svc.local", "^.*\\.svc\\.local$"},
+		{"With Regex Meta Characters", "v1+(beta)", "^v1\\+\\(beta\\)$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ConvertToRegexPattern(tt.input)
+			require.Equal(t, tt.want, got, "input: %q", tt.input)
+			require.Equal(t, strings.ContainsAny(tt.input, "*?"), HasWildcard(tt.input))
+		})
+	}
+}
+
+func TestParseValuesToMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string][]string
+		wantErr bool
+	}{
+		{
+			"Single Key-Value Pair",
+			"app=nginx",
+			map[string][]string{"app": {"^nginx$"}},
+			false,
+		},
+		{
+			"Multiple Key-Value Pairs",
+			"app=nginx, env=prod",
+			map[string][]string{"app": {"^nginx$"}, "env": {"^prod$"}},
+			false,
+		},
+		{
+			"Same Key With Several Values",
+			"env=prod*,env=staging",
+			map[string][]string{"env": {"^prod.*$", "^staging$"}},
+			false,
+		},
+		{
+			"Key With No Value",
+			"role",
+			map[string][]string{"role": {".*"}},
+			false,
+		},
+		{
+			"Key With Empty Value",
+			"team=",
+			map[string][]string{"team": {"^$"}},
+			false,
+		},
+		{
+			"Empty Key Should Error",
+			"=value",
+			nil,
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseValuesToMap(tt.input)
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
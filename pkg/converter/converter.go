@@ -0,0 +1,367 @@
+// Package converter converts NeuVector admission control rules to Kubewarden policies.
+//
+// It's the library behind the nvrules2kw CLI, for the tools embedding the conversion: the policies, the Rego
+// artifacts and the conversion report are returned to the caller, nothing is written to the filesystem.
+package converter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/convert"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/customrule"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/mirror"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/output"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/policy"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/policyserver"
+	"github.com/neuvector/neuvector-kubewarden-policy-converter/internal/share"
+	nvapis "github.com/neuvector/neuvector/controller/api"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// ModeProtect rejects the requests violating the policies.
+	ModeProtect = "protect"
+
+	// ModeMonitor only reports the requests violating the policies.
+	ModeMonitor = "monitor"
+
+	// DefaultPolicyServer is the PolicyServer of the policies when none is set.
+	DefaultPolicyServer = "default"
+
+	// DefaultVulReportNamespace is the namespace of the vulnerability reports when none is set.
+	DefaultVulReportNamespace = "sbomscanner"
+
+	// DefaultPlatform is the platform of the vulnerability reports when none is set.
+	DefaultPlatform = "amd64"
+
+	// DefaultCustomModuleVersion is the tag of the custom modules when none is set.
+	DefaultCustomModuleVersion = "v0.1.0"
+
+	// DefaultMessageTemplate is the rejection message template of the policy groups when none is set.
+	DefaultMessageTemplate = policy.DefaultMessageTemplate
+
+	// DefaultPolicyServerNamespace is the namespace of the service account of the generated PolicyServer when
+	// none is set.
+	DefaultPolicyServerNamespace = policyserver.DefaultNamespace
+
+	// DefaultPolicyServerImage is the image of the generated PolicyServer when none is set.
+	DefaultPolicyServerImage = policyserver.DefaultImage
+
+	// GroupStrategyGroup generates a policy group per rule with several criteria.
+	GroupStrategyGroup = share.GroupStrategyGroup
+
+	// GroupStrategySplit generates a policy per module instead of the policy group of a rule, unless its criteria
+	// must be evaluated together.
+	GroupStrategySplit = share.GroupStrategySplit
+
+	// GroupStrategyAuto generates a policy group only for the rules with criteria enforced by several modules.
+	GroupStrategyAuto = share.GroupStrategyAuto
+
+	// RuleIDsAnnotation is the annotation of the consolidated policies listing the IDs of their rules.
+	RuleIDsAnnotation = convert.RuleIDsAnnotation
+)
+
+// Status is the conversion status of a rule.
+type Status string
+
+const (
+	// StatusConverted reports a rule converted to a policy or a Rego policy.
+	StatusConverted Status = convert.SummaryStatusOK
+
+	// StatusSkipped reports a rule which can't be converted, the notes tell why.
+	StatusSkipped Status = convert.SummaryStatusSkipped
+)
+
+// Options configures the conversion. The zero value converts the rules with the CLI defaults,
+// except for BackgroundAudit which is disabled.
+type Options struct {
+	// Mode overrides the mode of the rules, ModeProtect or ModeMonitor. The mode of the rules is used when empty.
+	Mode string
+
+	// PolicyServer is the PolicyServer of the policies.
+	PolicyServer string
+
+	// BackgroundAudit enables the background audit of the policies.
+	BackgroundAudit bool
+
+	// VulReportNamespace is the namespace of the vulnerability reports checked by the image scan policies.
+	VulReportNamespace string
+
+	// Platform is the platform of the vulnerability reports, as a GOARCH value.
+	Platform string
+
+	// BuildCustomWasm compiles the Rego policies to annotated Wasm modules.
+	BuildCustomWasm bool
+
+	// RunRegoTests runs the unit tests generated for the custom rules.
+	RunRegoTests bool
+
+	// CustomModuleRegistry is the registry of the modules built from the Rego policies. When set, the rules
+	// converted to Rego get a policy referencing their module.
+	CustomModuleRegistry string
+
+	// CustomModuleVersion is the tag of the modules built from the Rego policies.
+	CustomModuleVersion string
+
+	// RegoDir is the directory of the Rego artifact paths, "rego_policies" when empty.
+	RegoDir string
+
+	// RegoLayout is the layout of the Rego artifacts, "flat" or "scaffold", "flat" when empty.
+	RegoLayout string
+
+	// SkipRego skips the rules converted to Rego, for the callers not writing the Rego artifacts: such as the CLI
+	// streaming the policies to stdout. The report notes why the rules are skipped.
+	SkipRego bool
+
+	// HandlersDir is the directory of the handler plugins, YAML files mapping criteria to Kubewarden modules.
+	HandlersDir string
+
+	// ModuleOverrides overrides the modules of the handlers by module name, for example "pod-privileged".
+	// The overrides must be versions of the same module with an embedded settings schema, the settings generated
+	// for them are validated against it.
+	ModuleOverrides map[string]string
+
+	// RegistryMirrors rewrites the modules of the registries, the keys, to their mirror, the values.
+	// A registry may include a path, to only mirror its repositories, for example "ghcr.io/kubewarden".
+	RegistryMirrors map[string]string
+
+	// PreferNamespaced generates an AdmissionPolicy or AdmissionPolicyGroup in the namespace of the rules
+	// targeting a single namespace, instead of a cluster-wide policy.
+	PreferNamespaced bool
+
+	// ResourcesFile is the YAML file configuring the resources the policies apply to, and their operations,
+	// by applicable resource type and by rule. The pods and their controllers are validated when empty.
+	ResourcesFile string
+
+	// Consolidate merges the policies identical but for their namespaces into a policy selecting the namespaces
+	// of all their rules. The report notes the policy each rule is merged into.
+	Consolidate bool
+
+	// GroupStrategy generates the policies of the rules with several criteria, GroupStrategyGroup,
+	// GroupStrategySplit or GroupStrategyAuto. GroupStrategyGroup when empty.
+	GroupStrategy string
+
+	// MessageTemplate is the Go template of the rejection message of the policies, executed with the .ID, the
+	// .Comment and the .Criteria summary of the rule. The policies are wrapped in a single-member policy group
+	// to carry it. The policy groups use DefaultMessageTemplate when empty.
+	MessageTemplate string
+
+	// PolicyServerManifests generates the PolicyServer named after PolicyServer, and the ClusterRole and
+	// ClusterRoleBinding its service account needs to run the policies, when set.
+	PolicyServerManifests *PolicyServerOptions
+
+	// Logger logs the conversion, nothing is logged when nil.
+	Logger *slog.Logger
+}
+
+// PolicyServerOptions configures the generated PolicyServer.
+type PolicyServerOptions struct {
+	// Namespace is the namespace of the service account of the PolicyServer, the namespace of the Kubewarden
+	// controller. DefaultPolicyServerNamespace when empty.
+	Namespace string
+
+	// Image is the image of the PolicyServer, DefaultPolicyServerImage when empty.
+	Image string
+
+	// Replicas is the number of replicas of the PolicyServer, one when zero.
+	Replicas int32
+
+	// SourceAuthorities are the PEM certificates of the registries of the modules, by registry host.
+	SourceAuthorities map[string][]string
+
+	// InsecureSources are the registries the modules are pulled from without TLS verification.
+	InsecureSources []string
+}
+
+// Policy is a generated policy: a *policiesv1.ClusterAdmissionPolicy or a *policiesv1.ClusterAdmissionPolicyGroup,
+// or their namespaced *policiesv1.AdmissionPolicy or *policiesv1.AdmissionPolicyGroup.
+type Policy interface {
+	runtime.Object
+}
+
+// Artifact is a file generated for the rules converted to Rego: a Rego policy, its tests, its Wasm module
+// or a file of its scaffold project. The path is the one the CLI writes it to, under the Rego directory.
+type Artifact struct {
+	Path string
+	Data []byte
+}
+
+// Module is a module referenced by the policies. The mirror is the module the policies reference,
+// when a registry mirror applies to its source.
+type Module struct {
+	Source string
+	Mirror string
+}
+
+// RuleReport is the conversion report of a rule.
+type RuleReport struct {
+	RuleID uint32
+	Status Status
+	Notes  string
+}
+
+// Result is the result of the conversion.
+type Result struct {
+	// Policies are the policies generated for the rules, in the order of the rules.
+	Policies []Policy
+
+	// Artifacts are the files generated for the rules converted to Rego, in the order they were generated.
+	Artifacts []Artifact
+
+	// RegoCount is the number of rules converted to a Rego policy.
+	RegoCount int
+
+	// Report is the conversion report of every rule.
+	Report []RuleReport
+
+	// Modules are the modules referenced by the policies, in the order of the policies.
+	Modules []Module
+
+	// PolicyServerManifests are the PolicyServer, its ServiceAccount, and the ClusterRole and ClusterRoleBinding
+	// granting the service account the access to the resources the policies read, when generated.
+	PolicyServerManifests []runtime.Object
+}
+
+// PullScript returns a kwctl shell script seeding the registry mirrors with the modules of the policies.
+func (r *Result) PullScript() string {
+	modules := make([]mirror.Module, 0, len(r.Modules))
+	for _, module := range r.Modules {
+		modules = append(modules, mirror.Module(module))
+	}
+	return mirror.PullScript(modules)
+}
+
+// Convert converts the rules read from the reader: the JSON rules exported from the NeuVector UI,
+// or the YAML NvAdmissionControlSecurityRule CRDs.
+func Convert(ctx context.Context, reader io.Reader, opts Options) (*Result, error) {
+	rules, err := convert.NewRuleParser("").ParseReader(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse NeuVector Admission rules: %w", err)
+	}
+	return ConvertRules(ctx, rules, opts)
+}
+
+// ConvertRules converts the already decoded rules.
+func ConvertRules(ctx context.Context, rules *nvapis.RESTAdmissionRulesData, opts Options) (*Result, error) {
+	if rules == nil {
+		return nil, errors.New("no NeuVector Admission rules")
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	writer := output.NewMemoryWriter()
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+
+	ruleConverter := convert.NewRuleConverter(opts.config())
+	if opts.HandlersDir != "" {
+		if err := ruleConverter.LoadHandlerPlugins(opts.HandlersDir); err != nil {
+			return nil, fmt.Errorf("failed to load handler plugins: %w", err)
+		}
+	}
+	if opts.ResourcesFile != "" {
+		if err := ruleConverter.LoadResources(opts.ResourcesFile); err != nil {
+			return nil, fmt.Errorf("failed to load resources: %w", err)
+		}
+	}
+	if err := ruleConverter.SetModuleOverrides(opts.ModuleOverrides); err != nil {
+		return nil, fmt.Errorf("invalid module override: %w", err)
+	}
+	ruleConverter.SetWriter(writer)
+	ruleConverter.SetLogger(logger)
+	conversion := ruleConverter.ConvertRules(ctx, rules.Rules)
+
+	result := &Result{RegoCount: conversion.RegoCount}
+	for _, generated := range conversion.Policies {
+		result.Policies = append(result.Policies, generated)
+	}
+	for _, path := range writer.Paths {
+		result.Artifacts = append(result.Artifacts, Artifact{Path: path, Data: writer.Files[path]})
+	}
+	for _, module := range conversion.Modules {
+		result.Modules = append(result.Modules, Module(module))
+	}
+	result.PolicyServerManifests = conversion.PolicyServerManifests
+	for _, entry := range conversion.Summary {
+		result.Report = append(result.Report, RuleReport{
+			RuleID: entry.ID,
+			Status: Status(entry.Status),
+			Notes:  entry.Notes,
+		})
+	}
+	return result, nil
+}
+
+// Validate checks the mode, the Rego layout, the group strategy and the message template of the options.
+func (opts Options) Validate() error {
+	if opts.Mode != "" && opts.Mode != ModeProtect && opts.Mode != ModeMonitor {
+		return fmt.Errorf("invalid mode: %s. Allowed values are \"%s\" or \"%s\"", opts.Mode, ModeProtect, ModeMonitor)
+	}
+	switch opts.RegoLayout {
+	case "", customrule.LayoutFlat, customrule.LayoutScaffold:
+	default:
+		return fmt.Errorf(
+			"invalid rego layout: %s. Allowed values are \"%s\" or \"%s\"",
+			opts.RegoLayout, customrule.LayoutFlat, customrule.LayoutScaffold,
+		)
+	}
+	switch opts.GroupStrategy {
+	case "", GroupStrategyGroup, GroupStrategySplit, GroupStrategyAuto:
+	default:
+		return fmt.Errorf(
+			"invalid group strategy: %s. Allowed values are \"%s\", \"%s\" or \"%s\"",
+			opts.GroupStrategy, GroupStrategyGroup, GroupStrategySplit, GroupStrategyAuto,
+		)
+	}
+	if _, err := policy.ParseMessageTemplate(opts.MessageTemplate); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (opts Options) config() share.ConversionConfig {
+	config := share.ConversionConfig{
+		Mode:                 opts.Mode,
+		PolicyServer:         opts.PolicyServer,
+		BackgroundAudit:      opts.BackgroundAudit,
+		VulReportNamespace:   opts.VulReportNamespace,
+		Platform:             opts.Platform,
+		BuildCustomWasm:      opts.BuildCustomWasm,
+		RunRegoTests:         opts.RunRegoTests,
+		CustomModuleRegistry: opts.CustomModuleRegistry,
+		CustomModuleVersion:  opts.CustomModuleVersion,
+		RegoDir:              opts.RegoDir,
+		RegoLayout:           opts.RegoLayout,
+		SkipRego:             opts.SkipRego,
+		RegistryMirrors:      opts.RegistryMirrors,
+		PreferNamespaced:     opts.PreferNamespaced,
+		Consolidate:          opts.Consolidate,
+		GroupStrategy:        opts.GroupStrategy,
+		MessageTemplate:      opts.MessageTemplate,
+	}
+	if opts.PolicyServerManifests != nil {
+		policyServer := policyserver.Config(*opts.PolicyServerManifests)
+		config.PolicyServerManifests = &policyServer
+	}
+
+	if config.PolicyServer == "" {
+		config.PolicyServer = DefaultPolicyServer
+	}
+	if config.VulReportNamespace == "" {
+		config.VulReportNamespace = DefaultVulReportNamespace
+	}
+	if config.Platform == "" {
+		config.Platform = DefaultPlatform
+	}
+	if config.CustomModuleVersion == "" {
+		config.CustomModuleVersion = DefaultCustomModuleVersion
+	}
+	return config
+}
@@ -0,0 +1,131 @@
+package converter
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	nvapis "github.com/neuvector/neuvector/controller/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/yaml"
+)
+
+func TestConvert(t *testing.T) {
+	ruleDir := "../../test/rules/single_criterion/share_host_ipc/not_allow_share_host_ipc"
+
+	rule, err := os.Open(filepath.Join(ruleDir, "rule.json"))
+	require.NoError(t, err)
+	defer rule.Close()
+
+	expectedPolicy, err := os.ReadFile(filepath.Join(ruleDir, "policy.yaml"))
+	require.NoError(t, err)
+
+	result, err := Convert(context.Background(), rule, Options{Mode: ModeProtect, BackgroundAudit: true})
+	require.NoError(t, err)
+
+	require.Len(t, result.Policies, 1)
+	policy, err := yaml.Marshal(result.Policies[0])
+	require.NoError(t, err)
+	assert.Equal(t, string(expectedPolicy), string(policy))
+
+	assert.Empty(t, result.Artifacts)
+	assert.Equal(t, []RuleReport{{RuleID: 1000, Status: StatusConverted, Notes: "rule converted successfully"}},
+		result.Report)
+}
+
+func TestConvert_PolicyServerManifests(t *testing.T) {
+	rule, err := os.Open("../../test/rules/single_criterion/share_host_ipc/not_allow_share_host_ipc/rule.json")
+	require.NoError(t, err)
+	defer rule.Close()
+
+	result, err := Convert(context.Background(), rule, Options{
+		Mode:                  ModeProtect,
+		PolicyServer:          "neuvector",
+		PolicyServerManifests: &PolicyServerOptions{Replicas: 2, InsecureSources: []string{"registry.internal:5000"}},
+	})
+	require.NoError(t, err)
+	require.Len(t, result.PolicyServerManifests, 2)
+
+	policyServer, err := yaml.Marshal(result.PolicyServerManifests[0])
+	require.NoError(t, err)
+	assert.Equal(t, `apiVersion: policies.kubewarden.io/v1
+kind: PolicyServer
+metadata:
+  name: neuvector
+spec:
+  image: `+DefaultPolicyServerImage+`
+  insecureSources:
+  - registry.internal:5000
+  replicas: 2
+  serviceAccountName: policy-server-neuvector
+status: {}
+`, string(policyServer))
+}
+
+func TestConvertRules_RegoArtifacts(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	rules := &nvapis.RESTAdmissionRulesData{
+		Rules: []*nvapis.RESTAdmissionRule{
+			{
+				ID:       1000,
+				RuleType: nvapis.ValidatingDenyRuleType,
+				Criteria: []*nvapis.RESTAdmRuleCriterion{
+					{
+						Name:      "customPath",
+						Type:      "customPath",
+						Op:        "containsAny",
+						Path:      "item.spec.containers[_].image",
+						Value:     "redis:latest",
+						ValueType: "string",
+					},
+				},
+			},
+			{
+				ID:       1001,
+				RuleType: nvapis.ValidatingExceptRuleType,
+				Criteria: []*nvapis.RESTAdmRuleCriterion{
+					{Name: "shareIpcWithHost", Op: "=", Value: "true"},
+				},
+			},
+		},
+	}
+
+	result, err := ConvertRules(context.Background(), rules, Options{RegoDir: "custom"})
+	require.NoError(t, err)
+
+	assert.Empty(t, result.Policies)
+	assert.Equal(t, 1, result.RegoCount)
+	require.Len(t, result.Artifacts, 2)
+	assert.Equal(t, filepath.Join("custom", "nv_rule_1000.rego"), result.Artifacts[0].Path)
+	assert.Contains(t, string(result.Artifacts[0].Data), "redis:latest")
+	assert.Equal(t, filepath.Join("custom", "nv_rule_1000_test.rego"), result.Artifacts[1].Path)
+
+	require.Len(t, result.Report, 2)
+	assert.Equal(t, StatusConverted, result.Report[0].Status)
+	assert.Equal(t, StatusSkipped, result.Report[1].Status)
+
+	// Nothing is written to the filesystem
+	assert.NoDirExists(t, "custom")
+
+	// The rules converted to Rego are skipped when their artifacts aren't written
+	result, err = ConvertRules(context.Background(), rules, Options{SkipRego: true})
+	require.NoError(t, err)
+	assert.Zero(t, result.RegoCount)
+	assert.Empty(t, result.Artifacts)
+	assert.Equal(t, StatusSkipped, result.Report[0].Status)
+}
+
+func TestConvert_InvalidOptions(t *testing.T) {
+	_, err := Convert(context.Background(), strings.NewReader(`{"rules": []}`), Options{Mode: "audit"})
+	require.ErrorContains(t, err, "invalid mode: audit")
+
+	_, err = Convert(context.Background(), strings.NewReader(`{"rules": []}`), Options{RegoLayout: "nested"})
+	require.ErrorContains(t, err, "invalid rego layout: nested")
+
+	_, err = Convert(context.Background(), strings.NewReader(`{"rules": []}`), Options{MessageTemplate: "{{.ID"})
+	require.ErrorContains(t, err, "invalid message template")
+}
@@ -24,6 +24,11 @@ func TestConvertMultiCriteria_ShareHostPIDAndNetwork(t *testing.T) {
 	testRuleConversion(t, ruleDir)
 }
 
+func TestConvertMultiCriteria_ShareHostIPCNetworkAndPVCStorageClass(t *testing.T) {
+	ruleDir := "../rules/multi_criteria/share_host_ipc_network_pvc_storage_class"
+	testRuleConversion(t, ruleDir)
+}
+
 func TestConvertMultiCriteria_ImageAndImageRegistryNamespaceContainAny(t *testing.T) {
 	ruleDir := "../rules/namespace_selector/image_and_image_registry_namespace_contain_any"
 	testRuleConversion(t, ruleDir)
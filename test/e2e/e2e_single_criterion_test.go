@@ -44,7 +44,9 @@ func TestConvertSingleCriterion_RunAsRoot(t *testing.T) {
 func TestConvertSingleCriterion_ImageRule(t *testing.T) {
 	for _, ruleDir := range []string{
 		"../rules/single_criterion/image/contains_any",
+		"../rules/single_criterion/image/contains_any_wildcard",
 		"../rules/single_criterion/image/not_contains_any",
+		"../rules/single_criterion/image/not_regex",
 	} {
 		testRuleConversion(t, ruleDir)
 	}
@@ -88,8 +90,10 @@ func TestConvertSingleCriterion_LabelsRule(t *testing.T) {
 	for _, ruleDir := range []string{
 		"../rules/single_criterion/labels/contains_all",
 		"../rules/single_criterion/labels/contains_any",
+		"../rules/single_criterion/labels/contains_any_key_value",
 		"../rules/single_criterion/labels/contains_other_than",
 		"../rules/single_criterion/labels/not_contains_any",
+		"../rules/single_criterion/labels/regex",
 	} {
 		testRuleConversion(t, ruleDir)
 	}
@@ -107,8 +111,31 @@ func TestConvertSingleCriterion_AnnotationsRule(t *testing.T) {
 }
 
 func TestConvertSingleCriterion_NamespaceRule(t *testing.T) {
-	ruleDir := "../rules/namespace_selector/image_namespace_contain_any"
-	testRuleConversion(t, ruleDir)
+	for _, ruleDir := range []string{
+		"../rules/namespace_selector/image_namespace_contain_any",
+		"../rules/namespace_selector/image_namespace_not_contain_any",
+		"../rules/namespace_selector/image_namespace_wildcard",
+		"../rules/namespace_selector/image_namespace_multiple_criteria",
+		"../rules/namespace_selector/image_namespace_prefer_namespaced",
+	} {
+		testRuleConversion(t, ruleDir)
+	}
+}
+
+func TestConvertSingleCriterion_Consolidate(t *testing.T) {
+	for _, ruleDir := range []string{
+		"../rules/consolidate/image_namespaces",
+	} {
+		testRuleConversion(t, ruleDir)
+	}
+}
+
+func TestConvertSingleCriterion_Resources(t *testing.T) {
+	for _, ruleDir := range []string{
+		"../rules/resources/image_pods_only",
+	} {
+		testRuleConversion(t, ruleDir)
+	}
 }
 
 func TestConvertSingleCriterion_HighRiskServiceAccount(t *testing.T) {
@@ -164,3 +191,8 @@ func TestConvertSingleCriterion_CVENames(t *testing.T) {
 	ruleDir := "../rules/single_criterion/cve_names"
 	testRuleConversion(t, ruleDir)
 }
+
+func TestConvertSingleCriterion_Modules(t *testing.T) {
+	ruleDir := "../rules/single_criterion/modules/contains_any"
+	testRuleConversion(t, ruleDir)
+}
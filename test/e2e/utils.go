@@ -7,12 +7,20 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/google/cel-go/cel"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
 )
 
 const (
@@ -22,6 +30,10 @@ const (
 	PolicyServer     = "default"
 	BackgroundAudit  = true
 	ConverterBinary  = "../../bin/nvrules2kw"
+	// namespaceNameLabel is the label Kubernetes sets on every namespace to its name
+	namespaceNameLabel = "kubernetes.io/metadata.name"
+	// namespaceMatchConditionName is the match condition of the wildcard namespace criteria
+	namespaceMatchConditionName = "neuvector-namespace"
 )
 
 // Config is the configuration for a rule.
@@ -33,6 +45,9 @@ type Config struct {
 	Reject                             []string `json:"reject"`                             // List of files that should reject after run kwctl
 	RejectHostCapabilitiesInteractions *string  `json:"rejectHostCapabilitiesInteractions"` // Replay kubernetes capabilities interactions for reject resources
 	AcceptHostCapabilitiesInteractions *string  `json:"acceptHostCapabilitiesInteractions"` // Replay kubernetes capabilities interactions for accept resources
+	ConverterFlags                     []string `json:"converterFlags"`                     // Extra flags of the conversion
+	CustomWasm                         bool     `json:"customWasm"`                         // Whether kwctl verifies the Wasm module of the Rego policy
+	Skipped                            bool     `json:"skipped"`                            // Whether the conversion skips the rule, no policy is generated
 }
 
 type kwctlResponse struct {
@@ -43,9 +58,9 @@ type kwctlResponse struct {
 	} `json:"status,omitempty"`
 }
 
-// verifyWithKwctl verifies the output policy with kwctl,
+// verifyWithKwctl verifies the output policy, or the Wasm module of a Rego policy, with kwctl,
 // accept resources should be allowed, deny resources should be denied.
-func verifyWithKwctl(t *testing.T, config *Config, outputPath string) {
+func verifyWithKwctl(t *testing.T, config *Config, policyPath string) {
 	t.Helper()
 	for _, testCase := range []struct {
 		accept    bool
@@ -63,8 +78,17 @@ func verifyWithKwctl(t *testing.T, config *Config, outputPath string) {
 				replayHostCapabilitiesInteractions = filepath.Join(config.TestWorkspace, *testCase.hostCaps)
 			}
 
-			allowed, err := runKwctl(resourcePath, outputPath, replayHostCapabilitiesInteractions)
-			require.NoError(t, err, "error running kwctl for resource %s: %s", resource, err)
+			// The API server only calls the policy for the requests of the resources and namespaces it selects,
+			// the Wasm module is run for every resource
+			allowed := false
+			if !config.CustomWasm {
+				allowed = !inRulesScope(t, policyPath, resourcePath) || !inNamespaceScope(t, policyPath, resourcePath)
+			}
+			if !allowed {
+				var err error
+				allowed, err = runKwctl(resourcePath, policyPath, replayHostCapabilitiesInteractions)
+				require.NoError(t, err, "error running kwctl for resource %s: %s", resource, err)
+			}
 			if testCase.accept {
 				assert.True(t, allowed, "resource %s should be accepted", resource)
 			} else {
@@ -74,6 +98,107 @@ func verifyWithKwctl(t *testing.T, config *Config, outputPath string) {
 	}
 }
 
+// inRulesScope returns true if the rules of the policy select the creation of the resource. The resource of
+// the fixtures is the lowercase plural of their kind.
+func inRulesScope(t *testing.T, policyPath, resourcePath string) bool {
+	t.Helper()
+	var policy struct {
+		Spec struct {
+			Rules []admissionregistrationv1.RuleWithOperations `json:"rules"`
+		} `json:"spec"`
+	}
+	policyData, err := os.ReadFile(policyPath)
+	require.NoError(t, err)
+	require.NoError(t, yaml.Unmarshal(policyData, &policy))
+
+	var resource metav1.PartialObjectMetadata
+	resourceData, err := os.ReadFile(resourcePath)
+	require.NoError(t, err)
+	require.NoError(t, yaml.Unmarshal(resourceData, &resource))
+	gv, err := schema.ParseGroupVersion(resource.APIVersion)
+	require.NoError(t, err)
+	plural := strings.ToLower(resource.Kind) + "s"
+
+	for _, rule := range policy.Spec.Rules {
+		if matchesRule(rule.Operations, admissionregistrationv1.Create) &&
+			matchesRule(rule.APIGroups, gv.Group) && matchesRule(rule.APIVersions, gv.Version) &&
+			matchesRule(rule.Resources, plural) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesRule returns true if the values of a rule contain the value, or the "*" wildcard.
+func matchesRule[T ~string](values []T, value T) bool {
+	return slices.Contains(values, value) || slices.Contains(values, "*")
+}
+
+// inNamespaceScope returns true if the namespace selector and the namespace match condition of the policy select
+// the namespace of the resource, labelled as Kubernetes labels every namespace. Without them, every namespace is
+// selected. A namespaced policy only selects its namespace.
+func inNamespaceScope(t *testing.T, policyPath, resourcePath string) bool {
+	t.Helper()
+	var policy struct {
+		Metadata struct {
+			Namespace string `json:"namespace"`
+		} `json:"metadata"`
+		Spec struct {
+			NamespaceSelector *metav1.LabelSelector                    `json:"namespaceSelector"`
+			MatchConditions   []admissionregistrationv1.MatchCondition `json:"matchConditions"`
+		} `json:"spec"`
+	}
+	policyData, err := os.ReadFile(policyPath)
+	require.NoError(t, err)
+	require.NoError(t, yaml.Unmarshal(policyData, &policy))
+
+	var resource metav1.PartialObjectMetadata
+	resourceData, err := os.ReadFile(resourcePath)
+	require.NoError(t, err)
+	require.NoError(t, yaml.Unmarshal(resourceData, &resource))
+	namespace := resource.Namespace
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+
+	if policy.Metadata.Namespace != "" && policy.Metadata.Namespace != namespace {
+		return false
+	}
+
+	if policy.Spec.NamespaceSelector != nil {
+		selector, selectorErr := metav1.LabelSelectorAsSelector(policy.Spec.NamespaceSelector)
+		require.NoError(t, selectorErr)
+		if !selector.Matches(labels.Set{namespaceNameLabel: namespace}) {
+			return false
+		}
+	}
+
+	for _, condition := range policy.Spec.MatchConditions {
+		if condition.Name == namespaceMatchConditionName && !evalNamespaceMatchCondition(t, condition, namespace) {
+			return false
+		}
+	}
+	return true
+}
+
+// evalNamespaceMatchCondition evaluates the CEL expression of the namespace match condition, as the API server
+// does, for a request of the namespace.
+func evalNamespaceMatchCondition(t *testing.T, condition admissionregistrationv1.MatchCondition, namespace string) bool {
+	t.Helper()
+	env, err := cel.NewEnv(cel.Variable("request", cel.DynType))
+	require.NoError(t, err)
+	ast, issues := env.Compile(condition.Expression)
+	require.NoError(t, issues.Err())
+	program, err := env.Program(ast)
+	require.NoError(t, err)
+
+	result, _, err := program.Eval(map[string]any{"request": map[string]any{"namespace": namespace}})
+	require.NoError(t, err)
+	matched, ok := result.Value().(bool)
+	require.True(t, ok, "match condition %s is not a boolean", condition.Name)
+	return matched
+}
+
 func loadConfig(ruleDir string) (*Config, error) {
 	configPath := filepath.Join(ruleDir, "config.json")
 	if _, err := os.Stat(configPath); err != nil {
@@ -133,6 +258,10 @@ func runKwctl(resourcePath, policyPath, replayHostCapabilitiesInteractions strin
 	if replayHostCapabilitiesInteractions != "" {
 		args = append(args, "--replay-host-capabilities-interactions", replayHostCapabilitiesInteractions)
 	}
+	// The context aware resources of a Wasm module are granted from its metadata
+	if filepath.Ext(policyPath) == ".wasm" {
+		args = append(args, "--allow-context-aware")
+	}
 
 	kwctlCmd := exec.CommandContext(ctx, kwctlExecPath, args...)
 	output, err = kwctlCmd.Output()
@@ -148,7 +277,7 @@ func runKwctl(resourcePath, policyPath, replayHostCapabilitiesInteractions strin
 	return response.Allowed, nil
 }
 
-func runConverterBinary(rule, policies string) error {
+func runConverterBinary(rule, policies string, flags ...string) error {
 	// Create context with timeout for security
 	ctx, cancel := context.WithTimeout(context.Background(), converterTimeout)
 	defer cancel()
@@ -161,8 +290,9 @@ func runConverterBinary(rule, policies string) error {
 		"--backgroundaudit", strconv.FormatBool(BackgroundAudit),
 		"--vulreportnamespace", "default",
 		"--platform", "amd64",
-		rule,
 	}
+	args = append(args, flags...)
+	args = append(args, rule)
 
 	cmd := exec.CommandContext(ctx, ConverterBinary, args...)
 	output, err := cmd.CombinedOutput()
@@ -180,12 +310,31 @@ func testRuleConversion(t *testing.T, ruleDir string) {
 
 	rulePath := filepath.Join(ruleDir, "rule.json")
 	outputPath := filepath.Join(ruleDir, "output.yaml")
+	regoDir := filepath.Join(ruleDir, "rego_policies")
 
-	err = runConverterBinary(rulePath, outputPath)
+	flags := config.ConverterFlags
+	if config.CustomWasm {
+		flags = append(slices.Clone(flags), "--build-custom-wasm", "--rego-dir", regoDir)
+		defer os.RemoveAll(regoDir)
+	}
+	err = runConverterBinary(rulePath, outputPath, flags...)
 	require.NoError(t, err)
 	defer os.Remove(outputPath)
 
-	if config.RunKwctl {
-		verifyWithKwctl(t, config, outputPath)
+	if config.Skipped {
+		require.NoFileExists(t, outputPath)
+		return
+	}
+
+	if !config.RunKwctl {
+		return
+	}
+	policyPath := outputPath
+	if config.CustomWasm {
+		wasmModules, globErr := filepath.Glob(filepath.Join(regoDir, "*.wasm"))
+		require.NoError(t, globErr)
+		require.Len(t, wasmModules, 1)
+		policyPath = wasmModules[0]
 	}
+	verifyWithKwctl(t, config, policyPath)
 }
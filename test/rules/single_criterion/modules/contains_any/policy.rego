@@ -0,0 +1,99 @@
+package kubernetes.admission
+
+# Generated from NeuVector admission rule #1000 (modules).
+# The policy must be deployed with the following context aware resource:
+#   - apiVersion: storage.sbomscanner.kubewarden.io/v1alpha1
+#     kind: VulnerabilityReport
+
+deny[msg] {
+	container := _containers[_]
+	report := _reports[_]
+	_report_matches_image(report, container.image)
+	packages := {p | p := report.report.results[_].vulnerabilities[_].packageName}
+	not doesNotContainAnyOf(packages)
+	msg := sprintf("Denied by NeuVector rule #1000: image %s packages violate the modules criterion", [container.image])
+}
+
+_values := {"apk-tools", "musl"}
+
+doesNotContainAnyOf(packages) {
+	count(packages & _values) == 0
+}
+
+_reports[report] {
+	report := data.kubernetes.vulnerabilityreports["default"][_]
+}
+
+_report_matches_image(report, image) {
+	metadata := report.imageMetadata
+	_normalized_image(image) == sprintf("%s/%s:%s", [metadata.registryURI, metadata.repository, metadata.tag])
+}
+
+_report_matches_image(report, image) {
+	metadata := report.imageMetadata
+	_normalized_image(image) == sprintf("%s/%s@%s", [metadata.registryURI, metadata.repository, metadata.digest])
+}
+
+_report_matches_image(report, image) {
+	metadata := report.imageMetadata
+	normalized := _normalized_image(image)
+	normalized == sprintf("%s/%s:%s@%s", [metadata.registryURI, metadata.repository, metadata.tag, metadata.digest])
+}
+
+# The images are normalized with the Docker Hub registry prefix and the latest tag
+_normalized_image(image) = normalized {
+	normalized := _image_with_tag(_image_with_registry(image))
+}
+
+_image_with_registry(image) = image {
+	_is_registry_host(split(image, "/")[0])
+	contains(image, "/")
+} else = concat("/", ["docker.io", image]) {
+	contains(image, "/")
+} else = concat("/", ["docker.io", "library", image]) {
+	true
+}
+
+_is_registry_host(host) {
+	contains(host, ".")
+}
+
+_is_registry_host(host) {
+	contains(host, ":")
+}
+
+_is_registry_host(host) {
+	host == "localhost"
+}
+
+_image_with_tag(image) = image {
+	contains(image, "@")
+} else = image {
+	parts := split(image, "/")
+	contains(parts[count(parts) - 1], ":")
+} else = concat(":", [image, "latest"]) {
+	true
+}
+
+_containers[container] {
+	container := _get_input("get").spec.containers[_]
+}
+
+_get_input(w) := x {
+	w == "get"
+	supportedKind := ["Deployment", "DaemonSet", "Job", "ReplicaSet", "ReplicationController", "StatefulSet"]
+	input.request.kind.kind == supportedKind[_]
+	x := input.request.object.spec.template
+}
+
+_get_input(w) := x {
+	w == "get"
+	input.request.kind.kind == "CronJob"
+	x := input.request.object.spec.jobTemplate.spec.template
+}
+
+_get_input(w) := x {
+	w == "get"
+	input.request.kind.kind == "Pod"
+	x := input.request.object
+}